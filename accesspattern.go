@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	accessSequential = "sequential"
+	accessUniform    = "uniform"
+	accessZipfian    = "zipfian"
+	accessHotspot    = "hotspot"
+
+	// Share of the reads sent to the hot keys of a hotspot pattern
+	hotspotReadFraction = 0.9
+	// Skew of a zipfian pattern when none is given
+	defaultZipfExponent = 1.1
+)
+
+// How the read test chooses which object each read targets
+type AccessPattern struct {
+	kind string
+	// Share of the keys which are hot in a hotspot pattern
+	hotFraction float64
+	// Exponent of a zipfian pattern, greater than 1
+	zipfExponent float64
+}
+
+// Parses sequential, uniform, zipfian[:EXPONENT] or hotspot:N%
+func ParseAccessPattern(spec string) (*AccessPattern, error) {
+	kind, arg := spec, ""
+	invalid := fmt.Errorf("invalid access pattern %q, expected sequential, uniform, zipfian[:1.1] or hotspot:10%%", spec)
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, arg = spec[:i], spec[i+1:]
+		if arg == "" {
+			return nil, invalid
+		}
+	}
+	p := &AccessPattern{kind: kind}
+	switch kind {
+	case accessSequential, accessUniform:
+		if arg != "" {
+			return nil, invalid
+		}
+	case accessZipfian:
+		p.zipfExponent = defaultZipfExponent
+		if arg != "" {
+			exponent, err := strconv.ParseFloat(arg, 64)
+			if err != nil || exponent <= 1 {
+				return nil, invalid
+			}
+			p.zipfExponent = exponent
+		}
+	case accessHotspot:
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(arg, "%"), 64)
+		if err != nil || percent <= 0 || percent >= 100 {
+			return nil, invalid
+		}
+		p.hotFraction = percent / 100
+	default:
+		return nil, invalid
+	}
+	return p, nil
+}
+
+// Returns a function choosing the index of the object targeted by the i-th
+// read among n objects. The function is not safe for concurrent use.
+func (p *AccessPattern) picker(n int) func(i int) int {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	switch p.kind {
+	case accessUniform:
+		return func(int) int { return r.Intn(n) }
+	case accessZipfian:
+		// Key 0 is the most popular, then key 1 and so on
+		zipf := rand.NewZipf(r, p.zipfExponent, 1, uint64(n-1))
+		return func(int) int { return int(zipf.Uint64()) }
+	case accessHotspot:
+		numHot := int(float64(n) * p.hotFraction)
+		if numHot < 1 {
+			numHot = 1
+		}
+		return func(int) int {
+			if numHot == n || r.Float64() < hotspotReadFraction {
+				return r.Intn(numHot)
+			}
+			return numHot + r.Intn(n-numHot)
+		}
+	}
+	return func(i int) int { return i % n }
+}
+
+func (p *AccessPattern) String() string {
+	switch p.kind {
+	case accessZipfian:
+		return fmt.Sprintf("%s (exponent %g)", p.kind, p.zipfExponent)
+	case accessHotspot:
+		return fmt.Sprintf("%s (%g%% of reads to %g%% of keys)", p.kind, hotspotReadFraction*100, p.hotFraction*100)
+	}
+	return p.kind
+}
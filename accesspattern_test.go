@@ -0,0 +1,89 @@
+package main
+
+import "testing"
+
+func TestParseAccessPattern(t *testing.T) {
+	tests := []struct {
+		spec     string
+		kind     string
+		hot      float64
+		exponent float64
+		ok       bool
+	}{
+		{"sequential", accessSequential, 0, 0, true},
+		{"uniform", accessUniform, 0, 0, true},
+		{"zipfian", accessZipfian, 0, defaultZipfExponent, true},
+		{"zipfian:1.5", accessZipfian, 0, 1.5, true},
+		{"hotspot:10%", accessHotspot, 0.1, 0, true},
+		{"hotspot:2.5", accessHotspot, 0.025, 0, true},
+		{"sequential:1", "", 0, 0, false},
+		{"uniform:", "", 0, 0, false},
+		{"zipfian:", "", 0, 0, false},
+		{"zipfian:1", "", 0, 0, false},
+		{"zipfian:0.5", "", 0, 0, false},
+		{"zipfian:steep", "", 0, 0, false},
+		{"hotspot", "", 0, 0, false},
+		{"hotspot:0%", "", 0, 0, false},
+		{"hotspot:100%", "", 0, 0, false},
+		{"hotspot:x%", "", 0, 0, false},
+		{"random", "", 0, 0, false},
+		{"", "", 0, 0, false},
+	}
+	for _, test := range tests {
+		p, err := ParseAccessPattern(test.spec)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %s", test.spec, p)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+			continue
+		}
+		if p.kind != test.kind || p.hotFraction != test.hot || p.zipfExponent != test.exponent {
+			t.Errorf("%q: %+v, expected kind %s, hot fraction %g and exponent %g", test.spec, *p, test.kind, test.hot, test.exponent)
+		}
+	}
+}
+
+func TestAccessPatternPicker(t *testing.T) {
+	const n, numReads = 100, 20000
+	tests := []struct {
+		spec string
+		// Share of the reads expected to go to the first hot keys
+		hot        int
+		minHotRate float64
+		maxHotRate float64
+	}{
+		{"sequential", 10, 0.1, 0.1},
+		{"uniform", 10, 0.05, 0.15},
+		{"hotspot:10%", 10, 0.85, 0.95},
+		{"hotspot:50%", 50, 0.85, 0.95},
+		{"zipfian", 1, 0.2, 1},
+	}
+	for _, test := range tests {
+		p, err := ParseAccessPattern(test.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pick := p.picker(n)
+		numHot := 0
+		for i := 0; i < numReads; i++ {
+			index := pick(i)
+			if index < 0 || index >= n {
+				t.Fatalf("%s: read %d targets object %d of %d", test.spec, i, index, n)
+			}
+			if p.kind == accessSequential && index != i%n {
+				t.Fatalf("%s: read %d targets object %d", test.spec, i, index)
+			}
+			if index < test.hot {
+				numHot++
+			}
+		}
+		rate := float64(numHot) / numReads
+		if rate < test.minHotRate || rate > test.maxHotRate {
+			t.Errorf("%s: %0.3f of reads to the first %d objects, expected %g to %g", test.spec, rate, test.hot, test.minHotRate, test.maxHotRate)
+		}
+	}
+}
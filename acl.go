@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	opPutAcl = "PutObjectAcl"
+	opGetAcl = "GetObjectAcl"
+)
+
+// The canned ACLs the PutObjectAcl test sets on the objects, cycling through
+// them so that every pass over the objects changes their ACLs
+type CannedACLs []types.ObjectCannedACL
+
+func ParseCannedACLs(spec string) (CannedACLs, error) {
+	var acls CannedACLs
+	for _, name := range strings.Split(spec, ",") {
+		acl := types.ObjectCannedACL(name)
+		valid := false
+		for _, value := range acl.Values() {
+			valid = valid || acl == value
+		}
+		if !valid {
+			return nil, fmt.Errorf("invalid canned ACL %q, expected one of %v", name, acl.Values())
+		}
+		acls = append(acls, acl)
+	}
+	return acls, nil
+}
+
+func (acls CannedACLs) String() string {
+	names := make([]string, len(acls))
+	for i, acl := range acls {
+		names[i] = string(acl)
+	}
+	return strings.Join(names, ",")
+}
+
+// Returns the request of an ACL test for the object of the i-th request of
+// the test
+func (params *Params) aclInput(op string, i, keyIndex int, key, versionID string) Req {
+	bucket := aws.String(params.bucketFor(key))
+	var version *string
+	if versionID != "" {
+		version = aws.String(versionID)
+	}
+	if op == opGetAcl {
+		return &s3.GetObjectAclInput{Bucket: bucket, Key: aws.String(key), VersionId: version}
+	}
+	// Objects are given the next ACL on each pass of a timed test
+	pass := 0
+	if params.numKeys > 0 {
+		pass = i / params.numKeys
+	}
+	return &s3.PutObjectAclInput{
+		Bucket:    bucket,
+		Key:       aws.String(key),
+		VersionId: version,
+		ACL:       params.objAcls[(keyIndex+pass)%len(params.objAcls)],
+	}
+}
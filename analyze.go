@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Operations completed during one second of a test
+type TimelinePoint struct {
+	numOps           int
+	numErrors        int
+	bytesTransmitted int64
+}
+
+// Operations sent to one endpoint, or by one client, during a test
+type EndpointStats struct {
+	numOps           int
+	numErrors        int
+	bytesTransmitted int64
+	opDurations      Histogram
+}
+
+func (r *Result) addToTimeline(resp Resp, elapsed time.Duration) {
+	second := int(elapsed / time.Second)
+	for len(r.timeline) <= second {
+		r.timeline = append(r.timeline, TimelinePoint{})
+	}
+	point := &r.timeline[second]
+	point.numOps++
+	if resp.err != nil {
+		point.numErrors++
+	} else {
+		point.bytesTransmitted += resp.numBytes
+	}
+	r.addToStreak(resp)
+
+	if r.endpoints == nil {
+		r.endpoints = make(map[string]*EndpointStats)
+	}
+	stats, ok := r.endpoints[resp.endpoint]
+	if !ok {
+		stats = &EndpointStats{}
+		r.endpoints[resp.endpoint] = stats
+	}
+	stats.numOps++
+	if resp.err != nil {
+		stats.numErrors++
+	} else {
+		stats.bytesTransmitted += resp.numBytes
+		stats.opDurations.Record(resp.duration.Seconds())
+	}
+}
+
+// Thresholds above which something is worth pointing out
+const (
+	tailRatioFinding       = 5
+	throughputTrendFinding = 0.15
+	errorRateFinding       = 0.01
+	clockDriftFinding      = 1.0
+)
+
+// Produces plain language findings about the results of a run
+func analyze(results []Result, clockOffset *ClockOffsetTracker) []string {
+	var findings []string
+	for _, r := range results {
+		total := r.numErrors + r.opDurations.Count()
+		if total == 0 {
+			continue
+		}
+		if r.aborted != "" {
+			findings = append(findings, fmt.Sprintf("%s test was aborted: %s", r.operation, r.aborted))
+		}
+
+		errorRate := float64(r.numErrors) / float64(total)
+		if errorRate >= errorRateFinding {
+			findings = append(findings, fmt.Sprintf("%0.1f%% of %s operations failed", errorRate*100, r.operation))
+		}
+		if finding := r.errorConcentration(); finding != "" {
+			findings = append(findings, finding)
+		}
+
+		if r.opDurations.Count() > 0 {
+			p50, p99 := r.percentile(50), r.percentile(99)
+			if p50 > 0 && p99/p50 >= tailRatioFinding {
+				findings = append(findings, fmt.Sprintf("%s p99 is %0.0fx p50 (%0.3f s vs %0.3f s) - long tail present",
+					r.operation, p99/p50, p99, p50))
+			}
+		}
+
+		if change, ok := r.throughputTrend(); ok {
+			if change <= -throughputTrendFinding {
+				findings = append(findings, fmt.Sprintf("%s throughput declined %0.0f%% over the run", r.operation, -change*100))
+			} else if change >= throughputTrendFinding {
+				findings = append(findings, fmt.Sprintf("%s throughput increased %0.0f%% over the run - warm up effects present",
+					r.operation, change*100))
+			}
+		}
+	}
+
+	if drift, ok := clockOffset.DriftPerHour(); ok && (drift >= clockDriftFinding || drift <= -clockDriftFinding) {
+		findings = append(findings, fmt.Sprintf("server clock drifted %+0.1f s/hour relative to the client", drift))
+	}
+	return findings
+}
+
+// Compares the throughput of the first and last quarters of the test,
+// returning the relative change. Tests shorter than 8 seconds are too short
+// for the comparison to mean anything.
+func (r Result) throughputTrend() (float64, bool) {
+	// The last second is usually partial, leave it out
+	seconds := len(r.timeline) - 1
+	if seconds < 8 {
+		return 0, false
+	}
+	quarter := seconds / 4
+	var first, last int64
+	for i := 0; i < quarter; i++ {
+		first += r.timeline[i].bytesTransmitted
+		last += r.timeline[seconds-quarter+i].bytesTransmitted
+	}
+	if first == 0 {
+		return 0, false
+	}
+	return float64(last-first) / float64(first), true
+}
+
+// Reports an endpoint receiving a disproportionate share of the errors
+func (r Result) errorConcentration() string {
+	if r.numErrors == 0 || len(r.endpoints) < 2 {
+		return ""
+	}
+	endpoints := make([]string, 0, len(r.endpoints))
+	for endpoint := range r.endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return r.endpoints[endpoints[i]].numErrors > r.endpoints[endpoints[j]].numErrors
+	})
+
+	worst := r.endpoints[endpoints[0]]
+	totalOps := r.numErrors + r.opDurations.Count()
+	errorShare := float64(worst.numErrors) / float64(r.numErrors)
+	opShare := float64(worst.numOps) / float64(totalOps)
+	if errorShare < 2*opShare {
+		return ""
+	}
+	return fmt.Sprintf("%s errors concentrated on endpoint %s (%0.0f%% of errors, %0.0f%% of operations)",
+		r.operation, endpoints[0], errorShare*100, opShare*100)
+}
+
+func findingsReport(findings []string) string {
+	report := fmt.Sprintln("Findings")
+	if len(findings) == 0 {
+		report += fmt.Sprintln("- nothing notable")
+	}
+	for _, finding := range findings {
+		report += fmt.Sprintf("- %s\n", finding)
+	}
+	return report
+}
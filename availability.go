@@ -0,0 +1,111 @@
+package main
+
+import "fmt"
+
+// Availability of the service over a run, in the terms of an SLA: the share
+// of operations which succeeded, the longest streak of operations without an
+// error and the longest outage, a stretch of seconds of a test in which
+// operations failed and none succeeded. Given a target, the errors it allows
+// are the error budget of the run.
+type Availability struct {
+	Percent              float64 `json:"percent"`
+	LongestStreak        int     `json:"longestErrorFreeStreak"`
+	LongestOutageSeconds int     `json:"longestOutageSeconds"`
+	OutageOperation      string  `json:"outageOperation,omitempty"`
+	OutageStartSeconds   int     `json:"outageStartSeconds,omitempty"`
+	// Only with availabilityTarget, the budget in errors
+	TargetPercent float64 `json:"targetPercent,omitempty"`
+	ErrorBudget   float64 `json:"errorBudget,omitempty"`
+	BudgetUsed    float64 `json:"budgetUsed,omitempty"`
+	Met           *bool   `json:"met,omitempty"`
+	numOps        int
+	numErrors     int
+}
+
+// Counts the operations since the last error
+func (r *Result) addToStreak(resp Resp) {
+	if resp.err != nil {
+		r.streak = 0
+		return
+	}
+	r.streak++
+	if r.streak > r.longestStreak {
+		r.longestStreak = r.streak
+	}
+}
+
+// Returns the length in seconds and start of the longest stretch of the test
+// in which operations failed and none succeeded. Seconds without any
+// operation completing extend an outage, as requests were hanging.
+func (r Result) longestOutage() (length, start int) {
+	current, currentStart := 0, 0
+	for second, point := range r.timeline {
+		if point.numOps > point.numErrors {
+			current = 0
+			continue
+		}
+		if current == 0 && point.numErrors == 0 {
+			continue
+		}
+		if current == 0 {
+			currentStart = second
+		}
+		current++
+		if current > length {
+			length, start = current, currentStart
+		}
+	}
+	return length, start
+}
+
+// Computes the availability over the results of a run, nil when no operation
+// was made. A target of 0 sets none.
+func computeAvailability(results []Result, targetPercent float64) *Availability {
+	a := &Availability{TargetPercent: targetPercent}
+	for _, r := range results {
+		a.numOps += r.opDurations.Count() + r.numErrors
+		a.numErrors += r.numErrors
+		if r.longestStreak > a.LongestStreak {
+			a.LongestStreak = r.longestStreak
+		}
+		if length, start := r.longestOutage(); length > a.LongestOutageSeconds {
+			a.LongestOutageSeconds, a.OutageOperation, a.OutageStartSeconds = length, r.operation, start
+		}
+	}
+	if a.numOps == 0 {
+		return nil
+	}
+	a.Percent = 100 * float64(a.numOps-a.numErrors) / float64(a.numOps)
+	if targetPercent > 0 {
+		a.ErrorBudget = (1 - targetPercent/100) * float64(a.numOps)
+		if a.ErrorBudget > 0 {
+			a.BudgetUsed = float64(a.numErrors) / a.ErrorBudget
+		}
+		met := a.Percent >= targetPercent
+		a.Met = &met
+	}
+	return a
+}
+
+func (a *Availability) String() string {
+	report := fmt.Sprintf("Availability:      %0.3f%% (%d of %d operations failed)\n", a.Percent, a.numErrors, a.numOps)
+	report += fmt.Sprintf("Longest Streak:    %d operations without an error\n", a.LongestStreak)
+	if a.LongestOutageSeconds > 0 {
+		report += fmt.Sprintf("Longest Outage:    %d s, %s test from +%d s\n", a.LongestOutageSeconds, a.OutageOperation, a.OutageStartSeconds)
+	} else {
+		report += fmt.Sprintln("Longest Outage:    none")
+	}
+	if a.TargetPercent > 0 {
+		status := "met"
+		if !*a.Met {
+			status = "missed"
+		}
+		if a.ErrorBudget > 0 {
+			report += fmt.Sprintf("Error Budget:      %0.1f%% used, %d of %0.1f errors allowed by %g%%, target %s\n",
+				100*a.BudgetUsed, a.numErrors, a.ErrorBudget, a.TargetPercent, status)
+		} else {
+			report += fmt.Sprintf("Error Budget:      no errors allowed by %g%%, target %s\n", a.TargetPercent, status)
+		}
+	}
+	return report
+}
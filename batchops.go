@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"github.com/aws/aws-sdk-go-v2/service/s3control/types"
+)
+
+const (
+	batchOpTagging = "tagging"
+	batchOpRestore = "restore"
+)
+
+// Number of DescribeJob calls in a row which may fail before the job is given
+// up on
+const batchMaxDescribeErrors = 10
+
+// Settings of an S3 Batch Operations job run over the test objects
+type BatchJobParams struct {
+	operation    string
+	accountID    string
+	roleArn      string
+	pollInterval time.Duration
+	timeout      time.Duration
+	tags         map[string]string
+	restoreDays  int64
+}
+
+// Outcome and timing of a Batch Operations job
+type BatchJobReport struct {
+	operation      string
+	jobID          string
+	status         string
+	numTasks       int64
+	numSucceeded   int64
+	numFailed      int64
+	manifestTime   time.Duration
+	submitTime     time.Duration
+	completionTime time.Duration
+	activeTime     time.Duration
+	failureReasons []string
+}
+
+// Parses "key=value,key=value" into the tags applied by the tagging job
+func parseTags(spec string) (map[string]string, error) {
+	tags := make(map[string]string)
+	if spec == "" {
+		return tags, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid tag %q, expected key=value", pair)
+		}
+		tags[kv[0]] = kv[1]
+	}
+	return tags, nil
+}
+
+// Uploads a CSV manifest of the given keys next to the test objects, submits
+// a Batch Operations job over them and polls it until it finishes
+func (params *Params) RunBatchJob(svc *s3.Client, control *s3control.Client, keys []string) BatchJobReport {
+	ctx := context.Background()
+	job := params.batchJob
+	report := BatchJobReport{operation: job.operation}
+
+	// Keys in Batch Operations CSV manifests must be URL encoded
+	startTime := time.Now()
+	var manifest bytes.Buffer
+	for _, key := range keys {
+		fmt.Fprintf(&manifest, "%s,%s\n", params.bucketName, strings.Replace(url.QueryEscape(key), "+", "%20", -1))
+	}
+	manifestKey := fmt.Sprintf("%sbatch-manifest-%d.csv", params.objectNamePrefix, startTime.Unix())
+	put, err := svc.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(params.bucketName),
+		Key:    aws.String(manifestKey),
+		Body:   bytes.NewReader(manifest.Bytes()),
+	})
+	if err != nil {
+		report.status = fmt.Sprintf("failed to upload manifest (%v)", err)
+		return report
+	}
+	defer svc.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(params.bucketName), Key: aws.String(manifestKey)})
+	report.manifestTime = time.Since(startTime)
+
+	operation := &types.JobOperation{}
+	switch job.operation {
+	case batchOpTagging:
+		tagSet := make([]types.S3Tag, 0, len(job.tags))
+		for k, v := range job.tags {
+			tagSet = append(tagSet, types.S3Tag{Key: aws.String(k), Value: aws.String(v)})
+		}
+		operation.S3PutObjectTagging = &types.S3SetObjectTaggingOperation{TagSet: tagSet}
+	case batchOpRestore:
+		operation.S3InitiateRestoreObject = &types.S3InitiateRestoreObjectOperation{
+			ExpirationInDays: aws.Int32(int32(job.restoreDays)),
+		}
+	}
+
+	submitStart := time.Now()
+	created, err := control.CreateJob(ctx, &s3control.CreateJobInput{
+		AccountId:            aws.String(job.accountID),
+		ConfirmationRequired: aws.Bool(false),
+		Description:          aws.String("s3bench " + job.operation),
+		Operation:            operation,
+		Priority:             aws.Int32(10),
+		RoleArn:              aws.String(job.roleArn),
+		Report:               &types.JobReport{Enabled: false},
+		Manifest: &types.JobManifest{
+			Spec: &types.JobManifestSpec{
+				Format: types.JobManifestFormatS3BatchOperationsCsv20180820,
+				Fields: []types.JobManifestFieldName{types.JobManifestFieldNameBucket, types.JobManifestFieldNameKey},
+			},
+			Location: &types.JobManifestLocation{
+				ObjectArn: aws.String(fmt.Sprintf("arn:aws:s3:::%s/%s", params.bucketName, manifestKey)),
+				ETag:      aws.String(strings.Trim(aws.ToString(put.ETag), "\"")),
+			},
+		},
+	})
+	if err != nil {
+		report.status = fmt.Sprintf("failed to create job (%v)", err)
+		return report
+	}
+	report.jobID = aws.ToString(created.JobId)
+	report.submitTime = time.Since(submitStart)
+	fmt.Printf("Created %s job %s with %d objects\n", job.operation, report.jobID, len(keys))
+
+	// Jobs may also stay suspended, paused or new, waiting for confirmation
+	// or a change of priority, so the job is only polled until the timeout
+	numDescribeErrors := 0
+	for {
+		time.Sleep(job.pollInterval)
+		if job.timeout > 0 && time.Since(submitStart) >= job.timeout {
+			status := fmt.Sprintf("timed out after %s", job.timeout)
+			if report.status != "" {
+				status += ", last " + report.status
+			}
+			report.status = status
+			return report
+		}
+		described, err := control.DescribeJob(ctx, &s3control.DescribeJobInput{
+			AccountId: aws.String(job.accountID),
+			JobId:     created.JobId,
+		})
+		if err != nil {
+			fmt.Printf("Failed to describe job %s (%v)\n", report.jobID, err)
+			numDescribeErrors++
+			if numDescribeErrors >= batchMaxDescribeErrors {
+				report.status = fmt.Sprintf("unknown, %d DescribeJob calls in a row failed", numDescribeErrors)
+				return report
+			}
+			continue
+		}
+		numDescribeErrors = 0
+		desc := described.Job
+		report.status = string(desc.Status)
+		if progress := desc.ProgressSummary; progress != nil {
+			report.numTasks = aws.ToInt64(progress.TotalNumberOfTasks)
+			report.numSucceeded = aws.ToInt64(progress.NumberOfTasksSucceeded)
+			report.numFailed = aws.ToInt64(progress.NumberOfTasksFailed)
+			if progress.Timers != nil {
+				report.activeTime = time.Duration(aws.ToInt64(progress.Timers.ElapsedTimeInActiveSeconds)) * time.Second
+			}
+		}
+		fmt.Printf("Job %s: %s, %d/%d tasks succeeded, %d failed (%s)\n", report.jobID, report.status,
+			report.numSucceeded, report.numTasks, report.numFailed, time.Since(submitStart).Round(time.Second))
+
+		switch desc.Status {
+		case types.JobStatusComplete, types.JobStatusFailed, types.JobStatusCancelled:
+			report.completionTime = time.Since(submitStart)
+			for _, failure := range desc.FailureReasons {
+				report.failureReasons = append(report.failureReasons,
+					fmt.Sprintf("%s: %s", aws.ToString(failure.FailureCode), aws.ToString(failure.FailureReason)))
+			}
+			return report
+		}
+	}
+}
+
+func (r BatchJobReport) String() string {
+	report := fmt.Sprintf("Results Summary for Batch Operations %s job %s\n", r.operation, r.jobID)
+	report += fmt.Sprintf("Status:            %s\n", r.status)
+	report += fmt.Sprintf("Tasks:             %d (%d succeeded, %d failed)\n", r.numTasks, r.numSucceeded, r.numFailed)
+	report += fmt.Sprintf("Manifest Upload:   %0.3f s\n", r.manifestTime.Seconds())
+	report += fmt.Sprintf("Job Submission:    %0.3f s\n", r.submitTime.Seconds())
+	if r.completionTime > 0 {
+		// Completion is only noticed when polling, the time the job spent
+		// active as reported by the service is more precise
+		report += fmt.Sprintf("Job Duration:      %0.3f s\n", r.completionTime.Seconds())
+		duration := r.completionTime
+		if r.activeTime > 0 {
+			report += fmt.Sprintf("Job Active Time:   %0.3f s\n", r.activeTime.Seconds())
+			duration = r.activeTime
+		}
+		report += fmt.Sprintf("Job Throughput:    %0.2f tasks/s\n", float64(r.numSucceeded+r.numFailed)/duration.Seconds())
+	}
+	for _, reason := range r.failureReasons {
+		report += fmt.Sprintf("Failure:           %s\n", reason)
+	}
+	return report
+}
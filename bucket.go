@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Value of locationConstraint creating the bucket without a constraint
+const locationConstraintNone = "none"
+
+// Returns the location constraint to create a bucket in region with, empty
+// for none. Only AWS knows its regions, other stores tend to reject any
+// constraint they do not expect with InvalidLocationConstraint, and AWS
+// itself rejects us-east-1 which is where buckets without one are created.
+func defaultLocationConstraint(region, endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || !strings.HasSuffix(u.Hostname(), ".amazonaws.com") || region == "us-east-1" {
+		return ""
+	}
+	return region
+}
+
+// Creates a bucket, which is fine if it is already ours
+func (params *Params) createBucket(svc *s3.Client, bucket, constraint string) error {
+	input := &s3.CreateBucketInput{Bucket: aws.String(bucket)}
+	if constraint != "" {
+		input.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+			LocationConstraint: types.BucketLocationConstraint(constraint),
+		}
+	}
+	_, err := svc.CreateBucket(context.Background(), input)
+	var owned *types.BucketAlreadyOwnedByYou
+	if errors.As(err, &owned) {
+		fmt.Printf("Bucket %s already exists\n", bucket)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if constraint == "" {
+		fmt.Printf("Created bucket %s\n", bucket)
+	} else {
+		fmt.Printf("Created bucket %s in %s\n", bucket, constraint)
+	}
+	return nil
+}
+
+// Returns the region AWS says the bucket is in, and the status of the
+// HeadBucket request asking. AWS returns the region with the 301 or 400
+// AuthorizationHeaderMalformed refusing a request signed for the wrong region,
+// other stores return none.
+func (params *Params) bucketRegion(cfg aws.Config) (string, int) {
+	svc := params.newS3Client(cfg, params.endpoints[0])
+	_, err := svc.HeadBucket(context.Background(), &s3.HeadBucketInput{Bucket: aws.String(params.bucketName)})
+	var respErr *awshttp.ResponseError
+	if err == nil || !errors.As(err, &respErr) {
+		return "", http.StatusOK
+	}
+	return respErr.Response.Header.Get("X-Amz-Bucket-Region"), respErr.HTTPStatusCode()
+}
+
+// Signs requests for the region of the bucket when it is not the one given,
+// the most common failure of a first run against AWS. Exits when the endpoint
+// still redirects, as it then belongs to another region.
+func (params *Params) detectRegion(cfg *aws.Config) {
+	region, status := params.bucketRegion(*cfg)
+	if region == "" || region == cfg.Region || (status != http.StatusMovedPermanently && status != http.StatusBadRequest) {
+		return
+	}
+	fmt.Printf("Bucket %s is in region %s rather than %s, signing requests for %s\n\n",
+		params.bucketName, region, cfg.Region, region)
+	cfg.Region = region
+	if _, status = params.bucketRegion(*cfg); status == http.StatusMovedPermanently {
+		fmt.Printf("Endpoint %s redirects requests for bucket %s, use the endpoint of %s, eg: https://s3.%s.amazonaws.com\n",
+			params.endpoints[0], params.bucketName, region, region)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const opBucketCycle = "BucketCycle"
+
+// Phases of a bucket cycle, in the order they run
+var bucketCyclePhases = []string{"create", "delete"}
+
+// Longest prefix of the cycled buckets, leaving room for the run's token and
+// the bucket number within the 63 characters of a bucket name
+const maxBucketCyclePrefix = 30
+
+// Specifies the bucket cycle test, which creates and deletes buckets as
+// provisioning a bucket per customer does, to measure the control plane
+type BucketCycleParams struct {
+	// Every bucket created is named prefix, a token unique to the run and its
+	// number, so that only buckets of the run are ever deleted
+	prefix     string
+	token      string
+	cycles     int
+	constraint string
+}
+
+// Creates a bucket and deletes it again, timed as one operation
+type BucketCycleInput struct {
+	Bucket     string
+	Constraint string
+}
+
+func ParseBucketCycleParams(prefix string, cycles int, runID string) (*BucketCycleParams, error) {
+	if cycles < 1 {
+		return nil, fmt.Errorf("bucketCycles needs to be greater than 0")
+	}
+	if prefix == "" || len(prefix) > maxBucketCyclePrefix {
+		return nil, fmt.Errorf("bucketCyclePrefix needs between 1 and %d characters", maxBucketCyclePrefix)
+	}
+	for i, c := range prefix {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' && i > 0) {
+			return nil, fmt.Errorf("invalid bucketCyclePrefix %q, expected lowercase letters, digits and dashes", prefix)
+		}
+	}
+	if runID == "" {
+		var err error
+		if runID, err = newRunID(); err != nil {
+			return nil, fmt.Errorf("could not generate the token of the cycled buckets: %v", err)
+		}
+	}
+	return &BucketCycleParams{prefix: prefix, token: strings.ToLower(runID), cycles: cycles}, nil
+}
+
+// Returns the name of the i-th bucket cycled
+func (b *BucketCycleParams) bucketName(i int) string {
+	return fmt.Sprintf("%s%s-%d", b.prefix, b.token, i)
+}
+
+// Runs the phases of a bucket cycle, returning the duration of every phase
+// completed and the bucket when it was created but could not be deleted. A
+// bucket which could not be created, say because the name is taken, is left
+// alone.
+func (params *Params) cycleBucket(ctx context.Context, svc *s3.Client, input *BucketCycleInput, capture *responseCapture, traceID, spanID string) ([]float64, []string, error) {
+	var phaseDurations []float64
+	create := &s3.CreateBucketInput{Bucket: aws.String(input.Bucket)}
+	if input.Constraint != "" {
+		create.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+			LocationConstraint: types.BucketLocationConstraint(input.Constraint),
+		}
+	}
+	phaseStartTime := time.Now()
+	if _, err := svc.CreateBucket(ctx, create, requestOptions(traceID, spanID, capture, false)...); err != nil {
+		return phaseDurations, nil, err
+	}
+	phaseDurations = append(phaseDurations, time.Since(phaseStartTime).Seconds())
+
+	phaseStartTime = time.Now()
+	_, err := svc.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String(input.Bucket)},
+		requestOptions(traceID, spanID, capture, false)...)
+	if err != nil {
+		return phaseDurations, []string{input.Bucket}, err
+	}
+	phaseDurations = append(phaseDurations, time.Since(phaseStartTime).Seconds())
+	return phaseDurations, nil, nil
+}
+
+// Cycles bucketCycles buckets, up to numClients at a time. The buckets which
+// could not be deleted during the test are deleted again at the end, those
+// still there are listed by the report.
+func (params *Params) RunBucketCycle(svc *s3.Client) Result {
+	b := params.bucketCycle
+	result := Result{operation: opBucketCycle}
+	startTime := time.Now()
+
+	var left []string
+	started, inFlight := 0, 0
+	for started < b.cycles || inFlight > 0 {
+		// Only offer a request to the clients when one is pending
+		var requests chan Req
+		var next Req
+		if started < b.cycles {
+			requests = params.requests
+			next = &BucketCycleInput{Bucket: b.bucketName(started), Constraint: b.constraint}
+		}
+
+		select {
+		case requests <- next:
+			started++
+			inFlight++
+		case resp := <-params.responses:
+			inFlight--
+			params.logRequest(resp)
+			params.clockOffset.Add(resp)
+			result.addToTimeline(resp, time.Since(startTime))
+			left = append(left, resp.undeleted...)
+			if resp.err != nil {
+				result.numErrors++
+				if params.verbose {
+					fmt.Printf("Failed to cycle bucket %s (%v)\n", resp.key, resp.err)
+				}
+				continue
+			}
+			result.opDurations.Record(resp.duration.Seconds())
+			result.addPhases(resp.phases)
+		}
+	}
+	result.totalDuration = time.Since(startTime)
+
+	for _, bucket := range left {
+		if _, err := svc.DeleteBucket(context.Background(), &s3.DeleteBucketInput{Bucket: aws.String(bucket)}); err != nil {
+			result.bucketsLeft = append(result.bucketsLeft, bucket)
+		}
+	}
+	return result
+}
+
+func (r Result) bucketCycleReport() string {
+	report := fmt.Sprintf("Buckets Cycled:    %d (%0.1f buckets/s)\n", r.opDurations.Count(), float64(r.opDurations.Count())/r.totalDuration.Seconds())
+	if len(r.bucketsLeft) > 0 {
+		report += fmt.Sprintf("Buckets Left:      %d, which could not be deleted:\n", len(r.bucketsLeft))
+		for _, bucket := range r.bucketsLeft {
+			report += fmt.Sprintf("  %s\n", bucket)
+		}
+	}
+	return report
+}
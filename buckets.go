@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+const (
+	bucketSpreadRoundRobin = "roundRobin"
+	bucketSpreadHash       = "hash"
+)
+
+// Returns the buckets objects are spread over: those of a comma separated
+// list, or numBuckets buckets named after the bucket followed by their
+// number, eg: bench-0, bench-1
+func parseBuckets(names string, numBuckets int) ([]string, error) {
+	buckets := strings.Split(names, ",")
+	for _, bucket := range buckets {
+		if bucket == "" {
+			return nil, fmt.Errorf("invalid bucket %q, expected a comma separated list of buckets", names)
+		}
+	}
+	if numBuckets == 0 {
+		return buckets, nil
+	}
+	if len(buckets) > 1 || numBuckets < 0 {
+		return nil, fmt.Errorf("numBuckets needs a single bucket to name the buckets after and to be greater than 0")
+	}
+	buckets = make([]string, numBuckets)
+	for i := range buckets {
+		buckets[i] = fmt.Sprintf("%s-%d", names, i)
+	}
+	return buckets, nil
+}
+
+// Returns the bucket of an object: given the object numbers in turn, or by
+// a hash of the key for keys without a number
+func (params *Params) bucketFor(key string) string {
+	n := len(params.buckets)
+	if n <= 1 {
+		return params.bucketName
+	}
+	if params.bucketSpread == bucketSpreadRoundRobin {
+		if i, ok := params.keyNumber(key); ok {
+			return params.buckets[i%n]
+		}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return params.buckets[h.Sum32()%uint32(n)]
+}
+
+// Returns the keys of every bucket, in the order of buckets
+func (params *Params) keysByBucket(keys []string) [][]string {
+	if len(params.buckets) <= 1 {
+		return [][]string{keys}
+	}
+	index := make(map[string]int, len(params.buckets))
+	for i, bucket := range params.buckets {
+		index[bucket] = i
+	}
+	byBucket := make([][]string, len(params.buckets))
+	for _, key := range keys {
+		i := index[params.bucketFor(key)]
+		byBucket[i] = append(byBucket[i], key)
+	}
+	return byBucket
+}
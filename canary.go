@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/signal"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	opHead = "Head"
+	// Size of the probe object written by the canary
+	canaryObjectSize = 1024
+)
+
+// Probes a bucket at a low rate until interrupted, writing, reading and
+// heading a tiny object every interval, as an availability prober would
+type Canary struct {
+	key         string
+	interval    time.Duration
+	reportEvery time.Duration
+	maxLatency  time.Duration
+	maxErrors   int
+	webhook     string
+	readOnly    bool
+	breached    bool
+	numRounds   int
+	numBreaches int
+}
+
+// The probes of one operation made during a report interval
+type canaryInterval struct {
+	op string
+	InfluxInterval
+	// Probes which did not complete within the probe timeout, also counted
+	// as errors
+	numTimeouts int
+}
+
+// The JSON body posted to the webhook when a breach starts or ends
+type CanaryAlert struct {
+	Status     string    `json:"status"`
+	Bucket     string    `json:"bucket"`
+	Key        string    `json:"key"`
+	Endpoint   string    `json:"endpoint"`
+	Reason     string    `json:"reason,omitempty"`
+	Errors     int       `json:"errors"`
+	MaxLatency float64   `json:"maxLatencySeconds"`
+	Time       time.Time `json:"time"`
+}
+
+func NewCanary(key string, interval, reportEvery, maxLatency time.Duration, maxErrors int, webhook string, readOnly bool) (*Canary, error) {
+	if interval <= 0 || maxLatency <= 0 {
+		return nil, fmt.Errorf("canaryInterval and canaryMaxLatency need to be greater than 0")
+	}
+	if maxErrors < 0 {
+		return nil, fmt.Errorf("canaryMaxErrors can not be negative")
+	}
+	if reportEvery < interval {
+		reportEvery = interval
+	}
+	return &Canary{
+		key:         key,
+		interval:    interval,
+		reportEvery: reportEvery,
+		maxLatency:  maxLatency,
+		maxErrors:   maxErrors,
+		webhook:     webhook,
+		readOnly:    readOnly,
+	}, nil
+}
+
+// Probes until interrupted, printing the probes of every report interval and
+// streaming them to InfluxDB when enabled. A breach of the error or latency
+// bounds is posted to the webhook, once when it starts and once when it ends,
+// or stops the canary when there is no webhook. Returns whether no breach
+// occurred.
+func (params *Params) RunCanary(svc *s3.Client, canary *Canary) bool {
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	defer signal.Stop(interrupted)
+
+	probes := time.NewTicker(canary.interval)
+	defer probes.Stop()
+	reports := time.NewTicker(canary.reportEvery)
+	defer reports.Stop()
+
+	fmt.Printf("Probing %s/%s every %s until interrupted, breaching over %d errors or %s per probe...\n",
+		params.bucketName, canary.key, canary.interval, canary.maxErrors, canary.maxLatency)
+	intervals := canary.newIntervals(time.Now())
+	canary.probe(svc, params.bucketName, intervals)
+	for {
+		select {
+		case <-probes.C:
+			canary.probe(svc, params.bucketName, intervals)
+		case <-reports.C:
+			for _, interval := range intervals {
+				if params.influx != nil {
+					params.influx.Write(interval.op, params.bucketName, &interval.InfluxInterval)
+				}
+			}
+			reason, maxLatency, numErrors := canary.check(intervals)
+			fmt.Println(canaryLine(intervals, reason))
+			if reason != "" {
+				canary.numBreaches++
+			}
+			if (reason != "") != canary.breached {
+				canary.breached = reason != ""
+				if canary.webhook == "" {
+					canary.cleanup(svc, params.bucketName)
+					return false
+				}
+				status := "resolved"
+				if canary.breached {
+					status = "firing"
+				}
+				alert := CanaryAlert{
+					Status:     status,
+					Bucket:     params.bucketName,
+					Key:        canary.key,
+					Endpoint:   params.endpoints[0],
+					Reason:     reason,
+					Errors:     numErrors,
+					MaxLatency: maxLatency,
+					Time:       time.Now(),
+				}
+				if err := postWebhook(canary.webhook, alert); err != nil {
+					fmt.Printf("Failed to post %s alert to canaryWebhook: %v\n", status, err)
+				}
+			}
+			intervals = canary.newIntervals(time.Now())
+		case <-interrupted:
+			fmt.Println()
+			canary.cleanup(svc, params.bucketName)
+			return canary.numBreaches == 0
+		}
+	}
+}
+
+func (canary *Canary) newIntervals(start time.Time) []*canaryInterval {
+	ops := []string{opWrite, opRead, opHead}
+	if canary.readOnly {
+		ops = ops[1:]
+	}
+	intervals := make([]*canaryInterval, 0, len(ops))
+	for _, op := range ops {
+		intervals = append(intervals, &canaryInterval{op: op, InfluxInterval: InfluxInterval{start: start}})
+	}
+	return intervals
+}
+
+// Returns how long a probe may take before it is abandoned, so that an
+// endpoint which hangs breaches rather than stalls the canary: the latency
+// bound, or the interval between probes when it is longer
+func (canary *Canary) probeTimeout() time.Duration {
+	if canary.interval > canary.maxLatency {
+		return canary.interval
+	}
+	return canary.maxLatency
+}
+
+// Makes one probe of each operation, in order, so that the read sees the
+// object just written
+func (canary *Canary) probe(svc *s3.Client, bucket string, intervals []*canaryInterval) {
+	canary.numRounds++
+	for _, interval := range intervals {
+		var err error
+		var numBytes int64
+		ctx, cancel := context.WithTimeout(context.Background(), canary.probeTimeout())
+		start := time.Now()
+		switch interval.op {
+		case opWrite:
+			_, err = svc.PutObject(ctx, &s3.PutObjectInput{
+				Bucket:        aws.String(bucket),
+				Key:           aws.String(canary.key),
+				Body:          NewRandomReader(dataSeed, 0, canaryObjectSize),
+				ContentLength: aws.Int64(canaryObjectSize),
+			}, requestOptions("", "", nil, true)...)
+			numBytes = canaryObjectSize
+		case opRead:
+			var output *s3.GetObjectOutput
+			output, err = svc.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(canary.key)})
+			if err == nil {
+				numBytes, err = io.Copy(ioutil.Discard, output.Body)
+				output.Body.Close()
+			}
+		case opHead:
+			_, err = svc.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(canary.key)})
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			interval.numTimeouts++
+			err = fmt.Errorf("probe timed out after %s", canary.probeTimeout())
+		}
+		cancel()
+		interval.add(Resp{err: err, numBytes: numBytes, duration: time.Since(start)})
+	}
+}
+
+// Returns why the probes of an interval breach the bounds, empty when they
+// do not, along with their slowest time and number of errors
+func (canary *Canary) check(intervals []*canaryInterval) (string, float64, int) {
+	numErrors, numTimeouts, maxLatency := 0, 0, 0.0
+	for _, interval := range intervals {
+		numErrors += interval.numErrors
+		numTimeouts += interval.numTimeouts
+		for _, d := range interval.opDurations {
+			maxLatency = math.Max(maxLatency, d)
+		}
+	}
+	if numTimeouts > 0 {
+		// Timed out probes took longer than the latency bound
+		return fmt.Sprintf("%d probes timed out after %s", numTimeouts, canary.probeTimeout()), canary.probeTimeout().Seconds(), numErrors
+	}
+	if numErrors > canary.maxErrors {
+		return fmt.Sprintf("%d errors, more than %d", numErrors, canary.maxErrors), maxLatency, numErrors
+	}
+	if maxLatency > canary.maxLatency.Seconds() {
+		return fmt.Sprintf("a probe took %0.3f s, more than %s", maxLatency, canary.maxLatency), maxLatency, numErrors
+	}
+	return "", maxLatency, numErrors
+}
+
+func canaryLine(intervals []*canaryInterval, reason string) string {
+	line := time.Now().Format("15:04:05")
+	for _, interval := range intervals {
+		sort.Float64s(interval.opDurations)
+		line += fmt.Sprintf(" | %s %d ok %d err", interval.op, len(interval.opDurations), interval.numErrors)
+		if len(interval.opDurations) > 0 {
+			line += fmt.Sprintf(" p50 %0.3f s max %0.3f s",
+				percentile(interval.opDurations, 50), interval.opDurations[len(interval.opDurations)-1])
+		}
+	}
+	if reason != "" {
+		line += " - BREACH: " + reason
+	}
+	return line
+}
+
+func (canary *Canary) cleanup(svc *s3.Client, bucket string) {
+	fmt.Printf("Canary made %d probe rounds, %d report intervals breached\n", canary.numRounds, canary.numBreaches)
+	if canary.readOnly {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), canary.probeTimeout())
+	defer cancel()
+	if _, err := svc.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(canary.key)}); err != nil {
+		fmt.Printf("Failed to delete the canary object %s: %v\n", canary.key, err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// The response headers of one request kept for the report
+type CapturedHeaders struct {
+	index  int
+	key    string
+	err    error
+	header http.Header
+}
+
+// Keeps the response headers of the first and last n requests of a stage
+type HeaderCapture struct {
+	n     int
+	first []CapturedHeaders
+	last  []CapturedHeaders
+	// Position of the oldest entry once last is full
+	next int
+}
+
+func (r *Result) addHeaderCapture(resp Resp, index, n int) {
+	if r.headers == nil {
+		r.headers = &HeaderCapture{n: n}
+	}
+	c := r.headers
+	captured := CapturedHeaders{index: index, key: resp.key, err: resp.err, header: resp.header}
+	if len(c.first) < c.n {
+		c.first = append(c.first, captured)
+		return
+	}
+	if len(c.last) < c.n {
+		c.last = append(c.last, captured)
+		return
+	}
+	c.last[c.next] = captured
+	c.next = (c.next + 1) % c.n
+}
+
+// Returns the headers kept, in the order of the requests
+func (c *HeaderCapture) captured() []CapturedHeaders {
+	last := append(append([]CapturedHeaders(nil), c.last[c.next:]...), c.last[:c.next]...)
+	return append(append([]CapturedHeaders(nil), c.first...), last...)
+}
+
+// The response headers of one request, as exported by the machine readable
+// sinks
+type HeadersSummary struct {
+	Index  int                 `json:"index"`
+	Key    string              `json:"key"`
+	Error  string              `json:"error,omitempty"`
+	Header map[string][]string `json:"header"`
+}
+
+func (c *HeaderCapture) summary() []HeadersSummary {
+	var summaries []HeadersSummary
+	for _, captured := range c.captured() {
+		summary := HeadersSummary{Index: captured.index, Key: captured.key, Header: captured.header}
+		if captured.err != nil {
+			summary.Error = captured.err.Error()
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+func (c *HeaderCapture) report(op string) string {
+	report := fmt.Sprintf("%s response headers of the first and last %d requests:\n", op, c.n)
+	for _, captured := range c.captured() {
+		report += fmt.Sprintf("#%d %s\n", captured.index, captured.key)
+		if captured.err != nil {
+			report += fmt.Sprintf("  error: %v\n", captured.err)
+		}
+		names := make([]string, 0, len(captured.header))
+		for name := range captured.header {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			report += fmt.Sprintf("  %s: %s\n", name, strings.Join(captured.header[name], ", "))
+		}
+	}
+	return report
+}
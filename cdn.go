@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Response headers reporting whether a CDN served a request from its cache,
+// in order of preference
+var cacheStatusHeaders = []string{"X-Cache", "CF-Cache-Status", "X-Cache-Status"}
+
+// Controls the caching of reads when the endpoint is a CDN distribution
+type CDNParams struct {
+	// Name of the query parameter given a unique value to miss the cache,
+	// on bustPercent percent of the reads
+	bustQuery   string
+	bustPercent float64
+	// Cache-Control directives sent with every read, eg: no-cache
+	cacheControl string
+}
+
+// Returns the options of a read, and whether it is to miss the cache
+func (c *CDNParams) readOptions() ([]func(*s3.Options), bool) {
+	var optFns []func(*s3.Options)
+	if c.cacheControl != "" {
+		optFns = append(optFns, func(o *s3.Options) {
+			o.APIOptions = append(o.APIOptions, smithyhttp.SetHeaderValue("Cache-Control", c.cacheControl))
+		})
+	}
+	busted := c.bustQuery != "" && rand.Float64()*100 < c.bustPercent
+	if busted {
+		param := url.QueryEscape(c.bustQuery) + "=" + strconv.FormatInt(rand.Int63(), 36)
+		optFns = append(optFns, func(o *s3.Options) {
+			o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+				return stack.Build.Add(middleware.BuildMiddlewareFunc("s3benchCacheBust",
+					func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+						if req, ok := in.Request.(*smithyhttp.Request); ok {
+							if req.URL.RawQuery != "" {
+								req.URL.RawQuery += "&"
+							}
+							req.URL.RawQuery += param
+						}
+						return next.HandleBuild(ctx, in)
+					}), middleware.After)
+			})
+		})
+	}
+	return optFns, busted
+}
+
+// Returns whether the CDN served a response from its cache, and false when
+// it did not say. CloudFront reports eg: "Hit from cloudfront", Fastly the
+// status of each cache layer the last being the edge, eg: "MISS, HIT".
+// Anything else than a hit, such as EXPIRED or BYPASS, went to the origin.
+func cacheStatus(header http.Header) (hit bool, ok bool) {
+	for _, name := range cacheStatusHeaders {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+		layers := strings.Split(value, ",")
+		return strings.Contains(strings.ToUpper(layers[len(layers)-1]), "HIT"), true
+	}
+	return false, false
+}
+
+// The cache status of the successful reads of a test
+type CacheStats struct {
+	hitTimes  Histogram
+	missTimes Histogram
+	// Age of the cached copies served, in seconds
+	ages       Histogram
+	numBusted  int
+	numUnknown int
+}
+
+func (r *Result) addCacheStatus(resp Resp) {
+	if resp.err != nil {
+		return
+	}
+	hit, ok := cacheStatus(resp.header)
+	age, ageErr := strconv.ParseFloat(resp.header.Get("Age"), 64)
+	if !ok && ageErr != nil && !resp.cacheBusted {
+		return
+	}
+	if r.cache == nil {
+		r.cache = &CacheStats{}
+	}
+	s := r.cache
+	if resp.cacheBusted {
+		s.numBusted++
+	}
+	switch {
+	case !ok:
+		s.numUnknown++
+	case hit:
+		s.hitTimes.Record(resp.duration.Seconds())
+	default:
+		s.missTimes.Record(resp.duration.Seconds())
+	}
+	if ageErr == nil {
+		s.ages.Record(age)
+	}
+}
+
+// The cache status of a result, as exported by the machine readable sinks
+type CacheSummary struct {
+	Hits     int     `json:"hits"`
+	Misses   int     `json:"misses"`
+	Unknown  int     `json:"unknown"`
+	Busted   int     `json:"busted"`
+	HitRatio float64 `json:"hitRatio"`
+	// Median operation time of the hits and of the misses
+	HitP50Seconds  float64 `json:"hitP50Seconds,omitempty"`
+	MissP50Seconds float64 `json:"missP50Seconds,omitempty"`
+}
+
+func (s *CacheStats) summary() *CacheSummary {
+	summary := &CacheSummary{
+		Hits:    s.hitTimes.Count(),
+		Misses:  s.missTimes.Count(),
+		Unknown: s.numUnknown,
+		Busted:  s.numBusted,
+	}
+	if summary.Hits+summary.Misses > 0 {
+		summary.HitRatio = float64(summary.Hits) / float64(summary.Hits+summary.Misses)
+	}
+	if summary.Hits > 0 {
+		summary.HitP50Seconds = s.hitTimes.Percentile(50)
+	}
+	if summary.Misses > 0 {
+		summary.MissP50Seconds = s.missTimes.Percentile(50)
+	}
+	return summary
+}
+
+func (r Result) cacheReport() string {
+	s := r.cache
+	summary := s.summary()
+	report := fmt.Sprintf("%s cache status (%s):\n", r.operation, strings.Join(cacheStatusHeaders, ", "))
+	report += fmt.Sprintf("Hit ratio:   %0.1f%% of %d ops reporting a status\n", 100*summary.HitRatio, summary.Hits+summary.Misses)
+	for _, times := range []struct {
+		name string
+		h    *Histogram
+	}{{"Hits:", &s.hitTimes}, {"Misses:", &s.missTimes}} {
+		if times.h.Count() > 0 {
+			report += fmt.Sprintf("%-12s %d ops, 50th %%ile %0.3f s, 99th %%ile %0.3f s\n",
+				times.name, times.h.Count(), times.h.Percentile(50), times.h.Percentile(99))
+		}
+	}
+	if s.numUnknown > 0 {
+		report += fmt.Sprintf("No status:   %d ops\n", s.numUnknown)
+	}
+	if s.numBusted > 0 {
+		report += fmt.Sprintf("Busted:      %d ops\n", s.numBusted)
+	}
+	if s.ages.Count() > 0 {
+		report += fmt.Sprintf("Age:         50th %%ile %0.0f s, max %0.0f s\n", s.ages.Percentile(50), s.ages.Percentile(100))
+	}
+	return report
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Runs micro-benchmarks of reads, HEADs and listings every so many objects
+// written, while the write test goes on, for a curve of the performance of
+// the bucket against the number of objects it holds
+type Checkpoints struct {
+	every   int
+	samples int
+	next    int
+	svc     *s3.Client
+	sse     *SSE
+	prefix  string
+	bucket  string
+	start   time.Time
+	pending chan []string
+	done    chan struct{}
+	results []Checkpoint
+}
+
+// The outcome of the micro-benchmarks run at one checkpoint
+type Checkpoint struct {
+	numObjects int
+	// Since the start of the write test
+	at        time.Duration
+	reads     Histogram
+	heads     Histogram
+	lists     Histogram
+	numErrors int
+}
+
+// Starts running a checkpoint of samples reads, HEADs and listings after
+// every objects written
+func (params *Params) NewCheckpoints(svc *s3.Client, every, samples int) *Checkpoints {
+	c := &Checkpoints{
+		every:   every,
+		samples: samples,
+		next:    every,
+		svc:     svc,
+		sse:     params.sse,
+		prefix:  params.objectNamePrefix,
+		bucket:  params.bucketName,
+		start:   time.Now(),
+		// Checkpoints are run one at a time, those falling due meanwhile
+		// are run in turn
+		pending: make(chan []string, 16),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		defer close(c.done)
+		for keys := range c.pending {
+			checkpoint := c.run(keys)
+			fmt.Printf("Checkpoint at %d objects: %s\n", checkpoint.numObjects, checkpoint.summary())
+			c.results = append(c.results, checkpoint)
+		}
+	}()
+	return c
+}
+
+// Notes the keys written so far, which are only ever appended to, and runs a
+// checkpoint when the next is due
+func (c *Checkpoints) Add(keys []string) {
+	if len(keys) < c.next {
+		return
+	}
+	c.next += c.every
+	c.pending <- keys
+}
+
+// Waits for the checkpoints due to complete and returns their report
+func (c *Checkpoints) Wait() CheckpointReport {
+	close(c.pending)
+	<-c.done
+	return CheckpointReport{checkpoints: c.results, samples: c.samples}
+}
+
+func (c *Checkpoints) run(keys []string) Checkpoint {
+	ctx := context.Background()
+	checkpoint := Checkpoint{numObjects: len(keys), at: time.Since(c.start)}
+	timed := func(h *Histogram, request func() error) {
+		start := time.Now()
+		if err := request(); err != nil {
+			checkpoint.numErrors++
+			return
+		}
+		h.Record(time.Since(start).Seconds())
+	}
+	for i := 0; i < c.samples; i++ {
+		key := aws.String(keys[rand.Intn(len(keys))])
+		timed(&checkpoint.reads, func() error {
+			input := &s3.GetObjectInput{Bucket: aws.String(c.bucket), Key: key}
+			if c.sse != nil {
+				c.sse.applyGet(input)
+			}
+			output, err := c.svc.GetObject(ctx, input)
+			if err != nil {
+				return err
+			}
+			defer output.Body.Close()
+			_, err = io.Copy(ioutil.Discard, output.Body)
+			return err
+		})
+		timed(&checkpoint.heads, func() error {
+			input := &s3.HeadObjectInput{Bucket: aws.String(c.bucket), Key: key}
+			if c.sse != nil {
+				c.sse.applyHead(input)
+			}
+			_, err := c.svc.HeadObject(ctx, input)
+			return err
+		})
+		// A page from anywhere in the prefix, not only its start
+		timed(&checkpoint.lists, func() error {
+			_, err := c.svc.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+				Bucket:     aws.String(c.bucket),
+				Prefix:     aws.String(c.prefix),
+				StartAfter: aws.String(keys[rand.Intn(len(keys))]),
+				MaxKeys:    aws.Int32(1000),
+			})
+			return err
+		})
+	}
+	return checkpoint
+}
+
+func (c Checkpoint) summary() string {
+	p50 := func(h *Histogram) float64 {
+		if h.Count() == 0 {
+			return 0
+		}
+		return h.Percentile(50)
+	}
+	return fmt.Sprintf("read p50 %0.3f s, head p50 %0.3f s, list p50 %0.3f s, %d errors",
+		p50(&c.reads), p50(&c.heads), p50(&c.lists), c.numErrors)
+}
+
+// The checkpoints of a write test
+type CheckpointReport struct {
+	checkpoints []Checkpoint
+	samples     int
+}
+
+func (r CheckpointReport) String() string {
+	report := fmt.Sprintf("Results Summary for Checkpoints of %d reads, HEADs and listings\n", r.samples)
+	report += fmt.Sprintf("%10s %9s %9s %9s %9s %9s %9s %9s %8s\n",
+		"objects", "at s", "read 50th", "read 99th", "head 50th", "head 99th", "list 50th", "list 99th", "errors")
+	percentile := func(h *Histogram, p float64) float64 {
+		if h.Count() == 0 {
+			return 0
+		}
+		return h.Percentile(p)
+	}
+	for _, c := range r.checkpoints {
+		report += fmt.Sprintf("%10d %9.1f %9.3f %9.3f %9.3f %9.3f %9.3f %9.3f %8d\n",
+			c.numObjects, c.at.Seconds(),
+			percentile(&c.reads, 50), percentile(&c.reads, 99),
+			percentile(&c.heads, 50), percentile(&c.heads, 99),
+			percentile(&c.lists, 50), percentile(&c.lists, 99), c.numErrors)
+	}
+	return report
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// How payloads are checksummed: not at all, with a Content-MD5 header, or
+// with a flexible checksum computed by the SDK
+const (
+	checksumNone   = "none"
+	checksumMD5    = "md5"
+	checksumSHA256 = "sha256"
+	checksumCRC32C = "crc32c"
+
+	// Outcomes of the verification of a read
+	checksumVerified   = "verified"
+	checksumUnverified = "unverified"
+)
+
+func validChecksum(mode string) bool {
+	return mode == checksumNone || mode == checksumMD5 || mode == checksumSHA256 || mode == checksumCRC32C
+}
+
+// The flexible checksum algorithm of the mode, none for the others
+func (params *Params) checksumAlgorithm() types.ChecksumAlgorithm {
+	switch params.checksum {
+	case checksumSHA256:
+		return types.ChecksumAlgorithmSha256
+	case checksumCRC32C:
+		return types.ChecksumAlgorithmCrc32c
+	}
+	return ""
+}
+
+// Sets the checksum of a write on its input. The Content-MD5 of the payload
+// is computed for every request, as clients do, and counts in its time.
+func (params *Params) addChecksum(input *s3.PutObjectInput) {
+	input.ChecksumAlgorithm = params.checksumAlgorithm()
+	if body, ok := input.Body.(io.ReadSeeker); ok && params.checksum == checksumMD5 {
+		input.ContentMD5 = contentMD5(body)
+	}
+}
+
+// Returns the base64 encoded MD5 of a payload, rewound afterwards
+func contentMD5(body io.ReadSeeker) *string {
+	sum := md5.New()
+	io.Copy(sum, body)
+	body.Seek(0, io.SeekStart)
+	return aws.String(base64.StdEncoding.EncodeToString(sum.Sum(nil)))
+}
+
+// Reads the body of a read, verifying its checksum. The SDK verifies a
+// flexible checksum returned by the server as the body is read, failing the
+// read on a mismatch, while MD5 can only be verified against the ETag of
+// objects written in one part without SSE-KMS or SSE-C, whose ETag is the MD5
+// of their data. Returns the bytes read and whether the checksum was
+// verified.
+func (params *Params) readVerified(output *s3.GetObjectOutput) (int64, string, error) {
+	var sum hash.Hash
+	writer := ioutil.Discard
+	etag := strings.Trim(aws.ToString(output.ETag), `"`)
+	encrypted := params.sse != nil && params.sse.inventoryStatus() != "SSE-S3"
+	if params.checksum == checksumMD5 && len(etag) == 2*md5.Size && !encrypted {
+		sum = md5.New()
+		writer = sum
+	}
+	n, err := io.Copy(writer, output.Body)
+	if err != nil {
+		return n, "", err
+	}
+	switch {
+	case sum != nil:
+		if got := hex.EncodeToString(sum.Sum(nil)); got != etag {
+			return n, "", fmt.Errorf("MD5 %s of the data does not match ETag %s", got, etag)
+		}
+		return n, checksumVerified, nil
+	case params.checksum == checksumMD5:
+		return n, checksumUnverified, nil
+	}
+	// Checksums of objects uploaded in parts are checksums of the checksums
+	// of the parts, which the SDK does not verify
+	for _, checksum := range []*string{output.ChecksumCRC32, output.ChecksumCRC32C, output.ChecksumCRC64NVME,
+		output.ChecksumSHA1, output.ChecksumSHA256} {
+		if checksum != nil && !strings.Contains(*checksum, "-") {
+			return n, checksumVerified, nil
+		}
+	}
+	return n, checksumUnverified, nil
+}
+
+func (r *Result) addChecksum(resp Resp) {
+	if resp.checksum == "" {
+		return
+	}
+	if r.checksums == nil {
+		r.checksums = make(map[string]int)
+	}
+	r.checksums[resp.checksum]++
+}
+
+func (r Result) checksumReport() string {
+	report := fmt.Sprintf("Checksums Verified:   %d reads\n", r.checksums[checksumVerified])
+	if n := r.checksums[checksumUnverified]; n > 0 {
+		report += fmt.Sprintf("Checksums Unverified: %d reads, without a checksum of the whole object to verify\n", n)
+	}
+	return report
+}
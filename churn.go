@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const opDelete = "Delete"
+
+// The state of the keys churned, shared by the clients' dispatcher and the
+// lister. A key is only checked against a listing when it was not changing
+// when the listing started and did not change until it ended.
+type churnState struct {
+	mu   sync.Mutex
+	keys []churnKey
+}
+
+type churnKey struct {
+	exists   bool
+	inFlight bool
+	// Unknown after a failed request, until the next succeeds
+	uncertain bool
+	// Incremented whenever a request on the key is sent or completes
+	epoch int
+}
+
+// The anomalies found by one listing
+type churnListing struct {
+	start      time.Duration
+	numChecked int
+	numMissing int
+	numGhosts  int
+	err        error
+}
+
+// The outcome of a churn test
+type ChurnReport struct {
+	prefix        string
+	numKeys       int
+	writeTimes    Histogram
+	deleteTimes   Histogram
+	numErrors     int
+	listings      []churnListing
+	interval      time.Duration
+	totalDuration time.Duration
+}
+
+func (params *Params) churnKey(i int) string {
+	return fmt.Sprintf("%schurn/%d", params.objectNamePrefix, i)
+}
+
+// Writes and deletes numSamples keys at full rate for duration, every idle key
+// being written when absent and deleted when present, while listing them over
+// and over in the background to count the keys missing from, or ghosts still
+// present in, listings started after they were written or deleted
+func (params *Params) RunChurn(svc *s3.Client, duration time.Duration) ChurnReport {
+	report := ChurnReport{prefix: params.objectNamePrefix + "churn/", numKeys: params.numSamples, interval: params.statsInterval}
+	state := &churnState{keys: make([]churnKey, params.numSamples)}
+	startTime := time.Now()
+	expired := time.After(duration)
+
+	listings := make(chan churnListing)
+	stop := make(chan struct{})
+	go func() {
+		defer close(listings)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			listings <- params.churnList(svc, state, time.Since(startTime))
+		}
+	}()
+
+	idle := make([]int, params.numSamples)
+	for i := range idle {
+		idle[i] = i
+	}
+	outstanding := 0
+	for outstanding > 0 || expired != nil {
+		var requests chan Req
+		var next Req
+		var pick int
+		if len(idle) > 0 && expired != nil {
+			requests = params.requests
+			pick = rand.Intn(len(idle))
+			i := idle[pick]
+			state.mu.Lock()
+			exists := state.keys[i].exists
+			state.mu.Unlock()
+			if exists {
+				next = &s3.DeleteObjectInput{Bucket: aws.String(params.bucketName), Key: aws.String(params.churnKey(i))}
+			} else {
+				size := params.objectSizeOf(i)
+				input := &s3.PutObjectInput{
+					Bucket:        aws.String(params.bucketName),
+					Key:           aws.String(params.churnKey(i)),
+					Body:          params.objectData(params.churnKey(i), 0, size),
+					ContentLength: aws.Int64(size),
+				}
+				if params.sse != nil {
+					params.sse.applyPut(input)
+				}
+				next = input
+			}
+		}
+		select {
+		case requests <- next:
+			i := idle[pick]
+			idle[pick] = idle[len(idle)-1]
+			idle = idle[:len(idle)-1]
+			state.mu.Lock()
+			state.keys[i].inFlight = true
+			state.keys[i].epoch++
+			state.mu.Unlock()
+			outstanding++
+		case resp := <-params.responses:
+			outstanding--
+			n, _ := strconv.Atoi(resp.key[len(report.prefix):])
+			state.mu.Lock()
+			key := &state.keys[n]
+			key.inFlight = false
+			key.epoch++
+			key.uncertain = resp.err != nil
+			if resp.err == nil {
+				key.exists = resp.op == opWrite
+			}
+			state.mu.Unlock()
+			idle = append(idle, n)
+			if resp.err != nil {
+				report.numErrors++
+			} else if resp.op == opWrite {
+				report.writeTimes.Record(resp.duration.Seconds())
+			} else {
+				report.deleteTimes.Record(resp.duration.Seconds())
+			}
+		case listing := <-listings:
+			report.addListing(listing, params.verbose)
+		case <-expired:
+			expired = nil
+		}
+	}
+	close(stop)
+	for listing := range listings {
+		report.addListing(listing, params.verbose)
+	}
+	report.totalDuration = time.Since(startTime)
+
+	// Whatever may exist is deleted with the objects of the other tests
+	for i, key := range state.keys {
+		if key.exists || key.uncertain {
+			params.writtenKeys = append(params.writtenKeys, params.churnKey(i))
+		}
+	}
+	return report
+}
+
+// Lists the churned keys once and checks the listing against the keys which
+// did not change while it was made
+func (params *Params) churnList(svc *s3.Client, state *churnState, start time.Duration) churnListing {
+	listing := churnListing{start: start}
+	state.mu.Lock()
+	before := make([]churnKey, len(state.keys))
+	copy(before, state.keys)
+	state.mu.Unlock()
+
+	listed := make(map[string]bool)
+	pages := s3.NewListObjectsV2Paginator(svc, &s3.ListObjectsV2Input{
+		Bucket: aws.String(params.bucketName),
+		Prefix: aws.String(params.objectNamePrefix + "churn/"),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(context.Background())
+		if err != nil {
+			listing.err = err
+			return listing
+		}
+		for _, obj := range page.Contents {
+			listed[*obj.Key] = true
+		}
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	for i, key := range before {
+		if key.inFlight || key.uncertain || state.keys[i].epoch != key.epoch {
+			continue
+		}
+		listing.numChecked++
+		found := listed[params.churnKey(i)]
+		if key.exists && !found {
+			listing.numMissing++
+		} else if !key.exists && found {
+			listing.numGhosts++
+		}
+	}
+	return listing
+}
+
+func (r *ChurnReport) addListing(listing churnListing, verbose bool) {
+	r.listings = append(r.listings, listing)
+	if !verbose {
+		return
+	}
+	if listing.err != nil {
+		fmt.Printf("Listing at %0.1f s failed: %v\n", listing.start.Seconds(), listing.err)
+		return
+	}
+	fmt.Printf("Listing at %0.1f s checked %d keys: %d missing, %d ghosts\n",
+		listing.start.Seconds(), listing.numChecked, listing.numMissing, listing.numGhosts)
+}
+
+func (r ChurnReport) String() string {
+	report := fmt.Sprintf("Results Summary for Churn of %d keys under %s\n", r.numKeys, r.prefix)
+	report += fmt.Sprintf("Total Duration:    %0.3f s\n", r.totalDuration.Seconds())
+	report += fmt.Sprintf("Writes:            %d\n", r.writeTimes.Count())
+	report += fmt.Sprintf("Deletes:           %d\n", r.deleteTimes.Count())
+	report += fmt.Sprintf("Number of Errors:  %d\n", r.numErrors)
+	if r.writeTimes.Count() > 0 {
+		report += fmt.Sprintf("Write times:       50th %%ile %0.3f s, 99th %%ile %0.3f s\n", r.writeTimes.Percentile(50), r.writeTimes.Percentile(99))
+	}
+	if r.deleteTimes.Count() > 0 {
+		report += fmt.Sprintf("Delete times:      50th %%ile %0.3f s, 99th %%ile %0.3f s\n", r.deleteTimes.Percentile(50), r.deleteTimes.Percentile(99))
+	}
+
+	var numListings, numFailed, numChecked, numMissing, numGhosts int
+	for _, l := range r.listings {
+		if l.err != nil {
+			numFailed++
+			continue
+		}
+		numListings++
+		numChecked += l.numChecked
+		numMissing += l.numMissing
+		numGhosts += l.numGhosts
+	}
+	report += fmt.Sprintln("------------------------------------")
+	report += fmt.Sprintf("Listings:          %d (%d failed)\n", numListings, numFailed)
+	report += fmt.Sprintf("Keys Checked:      %d\n", numChecked)
+	report += fmt.Sprintf("Missing Keys:      %d\n", numMissing)
+	report += fmt.Sprintf("Ghost Keys:        %d\n", numGhosts)
+	if numMissing+numGhosts == 0 || r.interval <= 0 {
+		return report
+	}
+
+	// When the anomalies occurred, by listing start time
+	report += fmt.Sprintf("Anomalies every %s:\n", r.interval)
+	report += fmt.Sprintf("%8s %8s %8s %8s\n", "start s", "listings", "missing", "ghosts")
+	var bucket, listings, missing, ghosts int
+	flush := func() {
+		if listings > 0 {
+			report += fmt.Sprintf("%8.1f %8d %8d %8d\n", (time.Duration(bucket) * r.interval).Seconds(), listings, missing, ghosts)
+		}
+	}
+	for _, l := range r.listings {
+		if l.err != nil {
+			continue
+		}
+		if b := int(l.start / r.interval); b != bucket {
+			flush()
+			bucket, listings, missing, ghosts = b, 0, 0, 0
+		}
+		listings++
+		missing += l.numMissing
+		ghosts += l.numGhosts
+	}
+	flush()
+	return report
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+)
+
+// A client which completed less than this fraction of the average number of
+// operations per client is pointed out as stalled
+const clientStallFraction = 0.5
+
+// Operations completed by one client goroutine during a test
+type ClientStats struct {
+	endpoint string
+	EndpointStats
+}
+
+func (r *Result) addToClient(resp Resp) {
+	for len(r.clients) <= resp.client {
+		r.clients = append(r.clients, &ClientStats{})
+	}
+	stats := r.clients[resp.client]
+	stats.endpoint = resp.endpoint
+	stats.numOps++
+	if resp.err != nil {
+		stats.numErrors++
+	} else {
+		stats.bytesTransmitted += resp.numBytes
+		stats.opDurations.Record(resp.duration.Seconds())
+	}
+}
+
+// The summary of one client, as exported by the machine readable sinks
+type ClientSummary struct {
+	Client   int    `json:"client"`
+	Endpoint string `json:"endpoint"`
+	ResultSummary
+}
+
+func (r Result) clientSummaries() []ClientSummary {
+	summaries := make([]ClientSummary, 0, len(r.clients))
+	for i, stats := range r.clients {
+		summaries = append(summaries, ClientSummary{
+			Client:        i,
+			Endpoint:      stats.endpoint,
+			ResultSummary: r.statsSummary(&stats.EndpointStats),
+		})
+	}
+	return summaries
+}
+
+func (r Result) clientReport() string {
+	report := fmt.Sprintf("%s results by client:\n", r.operation)
+	report += fmt.Sprintf("%6s %-32s %8s %8s %10s %9s %9s %9s\n", "client", "endpoint", "ops", "errors", "MB/s", "50th s", "99th s", "max s")
+	seconds := r.totalDuration.Seconds()
+	mean := float64(r.opDurations.Count()+r.numErrors) / float64(len(r.clients))
+	var stalled []int
+	for i, c := range r.clients {
+		mark := ""
+		if float64(c.numOps) < clientStallFraction*mean {
+			mark = " *"
+			stalled = append(stalled, i)
+		}
+		report += fmt.Sprintf("%6d %-32s %8d %8d %10.2f %9.3f %9.3f %9.3f%s\n",
+			i, c.endpoint, c.numOps, c.numErrors, (float64(c.bytesTransmitted)/(1024*1024))/seconds,
+			c.opDurations.Percentile(50), c.opDurations.Percentile(99), c.opDurations.Percentile(100), mark)
+	}
+	if len(stalled) > 0 {
+		report += fmt.Sprintf("* %d client(s) completed less than %0.0f%% of the average of %0.1f operations per client\n",
+			len(stalled), 100*clientStallFraction, mean)
+	}
+	return report
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Length of the windows over which the clock offset is estimated
+const clockOffsetWindow = time.Minute
+
+// Estimates the offset between the client clock and the servers' clocks from
+// the Date header of every response, and how that offset drifts during the
+// run. Date only has a resolution of one second, but each response bounds the
+// offset: the server stamped it at some point between the request being sent
+// and the response being received, within the second it reports. Combining
+// the bounds of all responses within a window narrows the estimate down to a
+// few milliseconds, and the drift is the trend of the estimates over windows.
+type ClockOffsetTracker struct {
+	numSamples int
+	first      time.Time
+	windows    []clockOffsetWindowBounds
+}
+
+type clockOffsetWindowBounds struct {
+	lower float64
+	upper float64
+}
+
+// Record the offset bounds given by a response
+func (c *ClockOffsetTracker) Add(resp Resp) {
+	if resp.serverDate.IsZero() {
+		return
+	}
+	end := resp.startTime.Add(resp.duration)
+	lower := resp.serverDate.Sub(end).Seconds()
+	upper := resp.serverDate.Add(time.Second).Sub(resp.startTime).Seconds()
+
+	if c.numSamples == 0 {
+		c.first = resp.startTime
+	}
+	c.numSamples++
+	if resp.startTime.Before(c.first) {
+		// Responses arrive in the order they complete, so a request may have
+		// started before the first one recorded: shift the windows so that
+		// the first starts with it
+		shift := int((c.first.Sub(resp.startTime) + clockOffsetWindow - 1) / clockOffsetWindow)
+		empty := make([]clockOffsetWindowBounds, shift)
+		for i := range empty {
+			empty[i] = clockOffsetWindowBounds{lower: -1e9, upper: 1e9}
+		}
+		c.windows = append(empty, c.windows...)
+		c.first = c.first.Add(-time.Duration(shift) * clockOffsetWindow)
+	}
+	index := int(resp.startTime.Sub(c.first) / clockOffsetWindow)
+	for len(c.windows) <= index {
+		c.windows = append(c.windows, clockOffsetWindowBounds{lower: -1e9, upper: 1e9})
+	}
+	w := &c.windows[index]
+	if lower > w.lower {
+		w.lower = lower
+	}
+	if upper < w.upper {
+		w.upper = upper
+	}
+}
+
+// Offset estimates in seconds for every window which saw responses, with the
+// time of the window in seconds since the first window
+func (c *ClockOffsetTracker) estimates() (times []float64, offsets []float64) {
+	for i, w := range c.windows {
+		if w.upper == 1e9 {
+			continue
+		}
+		times = append(times, (time.Duration(i) * clockOffsetWindow).Seconds())
+		offsets = append(offsets, (w.lower+w.upper)/2)
+	}
+	return times, offsets
+}
+
+// Average offset of the servers' clocks ahead of the client, in seconds
+func (c *ClockOffsetTracker) MeanOffset() float64 {
+	_, offsets := c.estimates()
+	var sum float64
+	for _, offset := range offsets {
+		sum += offset
+	}
+	return sum / float64(len(offsets))
+}
+
+// Least squares slope of the offset in seconds per hour of run time, only
+// meaningful once the run spans several windows
+func (c *ClockOffsetTracker) DriftPerHour() (float64, bool) {
+	times, offsets := c.estimates()
+	if len(times) < 2 {
+		return 0, false
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for i := range times {
+		sumX += times[i]
+		sumY += offsets[i]
+		sumXY += times[i] * offsets[i]
+		sumXX += times[i] * times[i]
+	}
+	n := float64(len(times))
+	return (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX) * 3600, true
+}
+
+func (c *ClockOffsetTracker) String() string {
+	_, offsets := c.estimates()
+	minOffset, maxOffset := offsets[0], offsets[0]
+	for _, offset := range offsets {
+		if offset < minOffset {
+			minOffset = offset
+		}
+		if offset > maxOffset {
+			maxOffset = offset
+		}
+	}
+
+	report := fmt.Sprintln("Server clock offset (server ahead of client)")
+	report += fmt.Sprintf("Samples: %d\n", c.numSamples)
+	report += fmt.Sprintf("Mean:    %+0.3f s\n", c.MeanOffset())
+	report += fmt.Sprintf("Range:   %+0.3f s to %+0.3f s over %s windows\n", minOffset, maxOffset, clockOffsetWindow)
+	if drift, ok := c.DriftPerHour(); ok {
+		report += fmt.Sprintf("Drift:   %+0.3f s/hour\n", drift)
+	} else {
+		report += fmt.Sprintf("Drift:   n/a, the run is shorter than two %s windows\n", clockOffsetWindow)
+	}
+	return report
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClockOffsetOutOfOrder(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	var c ClockOffsetTracker
+	// Completion order differs from start order: the first response
+	// recorded is of a request started 90s after the others
+	for _, at := range []time.Duration{90 * time.Second, 0, 30 * time.Second, 150 * time.Second} {
+		c.Add(Resp{
+			startTime:  start.Add(at),
+			duration:   100 * time.Millisecond,
+			serverDate: start.Add(at + 2*time.Second).Truncate(time.Second),
+		})
+	}
+	if c.numSamples != 4 {
+		t.Fatalf("%d samples, expected 4", c.numSamples)
+	}
+	// Windows stay aligned on the first response recorded
+	times, offsets := c.estimates()
+	if len(times) != 4 {
+		t.Fatalf("%d windows with responses, expected 4", len(times))
+	}
+	if times[3]-times[0] != 180 {
+		t.Errorf("windows span %gs, expected 180s", times[3]-times[0])
+	}
+	for i, offset := range offsets {
+		if offset < 1 || offset > 3 {
+			t.Errorf("window %d: offset %gs, expected about 2s", i, offset)
+		}
+	}
+}
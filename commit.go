@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const opCommit = "Commit"
+
+// Phases of a committed write, in the order they run
+var commitPhases = []string{"write", "verify", "promote", "delete"}
+
+// Writes an object under a staging name, checks it landed and promotes it to
+// its final name with a copy and a delete, as the S3 committers of Spark and
+// Hive do. The whole sequence is timed as one operation.
+type CommitInput struct {
+	Bucket     *string
+	StagingKey *string
+	Key        *string
+	Size       int64
+	Body       io.ReadSeeker
+}
+
+// Returns the staging and final names of the i-th committed object
+func (params *Params) commitKeys(i int) (string, string) {
+	return fmt.Sprintf("%s_temporary/%d", params.objectNamePrefix, i),
+		fmt.Sprintf("%scommitted/%d", params.objectNamePrefix, i)
+}
+
+// Runs the phases of a commit, returning the duration of every phase
+// completed, and the output of the copy once the object is committed. The
+// response to the last request sent is kept in capture. The staged object is
+// deleted when a later phase fails so that it does not linger in the bucket.
+func (params *Params) commitObject(ctx context.Context, svc *s3.Client, input *CommitInput, capture *responseCapture, traceID, spanID string) (*s3.PutObjectOutput, []float64, error) {
+	var phaseDurations []float64
+	timed := func(send func() error) error {
+		phaseStartTime := time.Now()
+		err := send()
+		if err == nil {
+			phaseDurations = append(phaseDurations, time.Since(phaseStartTime).Seconds())
+		}
+		return err
+	}
+	abort := func(err error) (*s3.PutObjectOutput, []float64, error) {
+		svc.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: input.Bucket, Key: input.StagingKey})
+		return nil, phaseDurations, err
+	}
+
+	err := timed(func() error {
+		staged := &s3.PutObjectInput{
+			Bucket:        input.Bucket,
+			Key:           input.StagingKey,
+			Body:          input.Body,
+			ContentLength: aws.Int64(input.Size),
+		}
+		if params.metadata != nil {
+			params.metadata.applyAs(staged, aws.ToString(input.Key))
+		}
+		if params.sse != nil {
+			params.sse.applyPut(staged)
+		}
+		params.addChecksum(staged)
+		optFns, err := params.writeOptions(traceID, spanID, capture, input.Body)
+		if err != nil {
+			return err
+		}
+		_, err = svc.PutObject(ctx, staged, optFns...)
+		return err
+	})
+	if err != nil {
+		return nil, phaseDurations, err
+	}
+
+	var head *s3.HeadObjectOutput
+	err = timed(func() (err error) {
+		staged := &s3.HeadObjectInput{Bucket: input.Bucket, Key: input.StagingKey}
+		if params.sse != nil {
+			params.sse.applyHead(staged)
+		}
+		head, err = svc.HeadObject(ctx, staged, requestOptions(traceID, spanID, capture, false)...)
+		return err
+	})
+	if err != nil {
+		return abort(err)
+	}
+	if size := aws.ToInt64(head.ContentLength); size != input.Size {
+		return abort(fmt.Errorf("staged object length %d, expected %d", size, input.Size))
+	}
+
+	var copied *s3.CopyObjectOutput
+	err = timed(func() (err error) {
+		commit := &s3.CopyObjectInput{
+			Bucket:     input.Bucket,
+			Key:        input.Key,
+			CopySource: aws.String(url.PathEscape(aws.ToString(input.Bucket) + "/" + aws.ToString(input.StagingKey))),
+		}
+		if params.sse != nil {
+			params.sse.applyCopy(commit)
+		}
+		copied, err = svc.CopyObject(ctx, commit, requestOptions(traceID, spanID, capture, false)...)
+		return err
+	})
+	if err != nil {
+		return abort(err)
+	}
+
+	output := &s3.PutObjectOutput{VersionId: copied.VersionId}
+	if copied.CopyObjectResult != nil {
+		output.ETag = copied.CopyObjectResult.ETag
+	}
+
+	// The object is committed even when the staged one can not be deleted,
+	// so its output is returned along with the error
+	err = timed(func() error {
+		_, err := svc.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: input.Bucket, Key: input.StagingKey},
+			requestOptions(traceID, spanID, capture, false)...)
+		return err
+	})
+	return output, phaseDurations, err
+}
+
+// Returns the phases of the operations of a test made of several requests
+func phaseNames(op string) []string {
+	if op == opBucketCycle {
+		return bucketCyclePhases
+	}
+	return commitPhases
+}
+
+func (r *Result) addPhases(phaseDurations []float64) {
+	if r.phases == nil {
+		r.phases = make([]Histogram, len(phaseNames(r.operation)))
+	}
+	for i, d := range phaseDurations {
+		r.phases[i].Record(d)
+	}
+}
+
+func (r Result) phaseReport() string {
+	report := fmt.Sprintf("%s times by phase:\n", r.operation)
+	report += fmt.Sprintf("%-8s %8s %9s %9s %9s %9s\n", "phase", "count", "50th s", "90th s", "99th s", "max s")
+	for i, phase := range phaseNames(r.operation) {
+		durations := &r.phases[i]
+		if durations.Count() == 0 {
+			continue
+		}
+		report += fmt.Sprintf("%-8s %8d %9.3f %9.3f %9.3f %9.3f\n", phase, durations.Count(),
+			durations.Percentile(50), durations.Percentile(90), durations.Percentile(99), durations.Percentile(100))
+	}
+	return report
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const opCopy = "Copy"
+
+// Where the copy test copies the objects to, a bucket and a prefix replacing
+// objectNamePrefix in their names
+type CopyParams struct {
+	bucket string
+	prefix string
+}
+
+// Parses a copy destination of bucket/prefix, copying under copies/ within
+// objectNamePrefix when empty
+func (params *Params) parseCopyDestination(spec string) *CopyParams {
+	if spec == "" {
+		return &CopyParams{bucket: params.bucketName, prefix: params.objectNamePrefix + "copies/"}
+	}
+	parts := strings.SplitN(strings.TrimPrefix(spec, "s3://"), "/", 2)
+	c := &CopyParams{bucket: parts[0]}
+	if len(parts) == 2 {
+		c.prefix = parts[1]
+	}
+	return c
+}
+
+// A server-side copy of an object, of the given size
+type CopyInput struct {
+	s3.CopyObjectInput
+	Size int64
+}
+
+// Returns the copy of the object of the given key
+func (params *Params) copyInput(key, versionID string) *CopyInput {
+	source := url.PathEscape(params.bucketName + "/" + key)
+	if versionID != "" {
+		source += "?versionId=" + url.QueryEscape(versionID)
+	}
+	input := &CopyInput{
+		CopyObjectInput: s3.CopyObjectInput{
+			Bucket:     aws.String(params.copy.bucket),
+			Key:        aws.String(params.copy.prefix + strings.TrimPrefix(key, params.objectNamePrefix)),
+			CopySource: aws.String(source),
+		},
+		Size: params.expectedSize(key, versionID),
+	}
+	if params.sse != nil {
+		params.sse.applyCopy(&input.CopyObjectInput)
+	}
+	return input
+}
+
+// Remembers a copy for cleanup, with the objects written when it was made in
+// the same bucket
+func (params *Params) recordCopy(resp Resp) {
+	if params.copy.bucket == params.bucketName {
+		params.writtenKeys = append(params.writtenKeys, resp.key)
+	} else {
+		params.copiedKeys = append(params.copiedKeys, resp.key)
+	}
+}
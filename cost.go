@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Length of the month the cost of a continuously running workload is
+// projected over
+const costMonth = 30 * 24 * time.Hour
+
+// Cloud prices, in any currency, of the requests, transfer and storage used
+// by a run. PUT, COPY, LIST and PutObjectAcl requests are charged as PUTs,
+// GET, HEAD and GetObjectAcl as GETs and DELETE is free, as most providers
+// do. The flat prices of any request and any byte written or read are for a
+// rough estimate, and add to the others.
+type CostModel struct {
+	perGB             float64
+	perRequest        float64
+	storagePerGBMonth float64
+	per1kPut          float64
+	per1kGet          float64
+	egressPerGB       float64
+}
+
+func (m CostModel) isSet() bool {
+	return m.perGB > 0 || m.perRequest > 0 || m.storagePerGBMonth > 0 || m.per1kPut > 0 || m.per1kGet > 0 || m.egressPerGB > 0
+}
+
+// One priced item of a cost estimate, for the run and for a month of the
+// same workload
+type CostItem struct {
+	Name            string  `json:"name"`
+	Unit            string  `json:"unit"`
+	Price           float64 `json:"price"`
+	RunQuantity     float64 `json:"runQuantity"`
+	RunCost         float64 `json:"runCost"`
+	MonthlyQuantity float64 `json:"monthlyQuantity"`
+	MonthlyCost     float64 `json:"monthlyCost"`
+}
+
+type CostEstimate struct {
+	Items       []CostItem `json:"items"`
+	RunCost     float64    `json:"runCost"`
+	MonthlyCost float64    `json:"monthlyCost"`
+}
+
+// Adds an item, unless it has no price
+func (e *CostEstimate) add(name, unit string, price, runQuantity, monthlyQuantity float64) {
+	if price == 0 {
+		return
+	}
+	item := CostItem{
+		Name:            name,
+		Unit:            unit,
+		Price:           price,
+		RunQuantity:     runQuantity,
+		RunCost:         runQuantity * price,
+		MonthlyQuantity: monthlyQuantity,
+		MonthlyCost:     monthlyQuantity * price,
+	}
+	e.Items = append(e.Items, item)
+	e.RunCost += item.RunCost
+	e.MonthlyCost += item.MonthlyCost
+}
+
+// Prices the requests and transfer of the tests, and storage of the objects
+// written for as long as the run lasted. The monthly projection repeats the
+// tests back to back for a month over a dataset of the size written.
+func (m CostModel) estimate(results []Result, wallClock time.Duration) *CostEstimate {
+	var requests, transferred, puts, gets, egress, stored, testSeconds float64
+	for _, r := range results {
+		numOps := float64(r.opDurations.Count() + r.numErrors)
+		requests += numOps
+		switch r.operation {
+		case opWrite, opCommit, opVersionWrite, opRead, opVersionRead:
+			transferred += float64(r.bytesTransmitted)
+		}
+		switch r.operation {
+		case opWrite, opVersionWrite:
+			// Every part of a multipart upload is a PUT of its own
+			puts += numOps + float64(r.partDurations.Count())
+			stored += float64(r.bytesTransmitted)
+		case opCommit:
+			// The staging PUT and the COPY, and the HEAD verifying it
+			puts += 2 * numOps
+			gets += numOps
+			stored += float64(r.bytesTransmitted)
+		case opCopy:
+			// Copies are billed as PUTs, without transfer
+			puts += numOps
+			stored += float64(r.bytesTransmitted)
+		case opPutAcl, opList, opListVersions:
+			// Every page listed is a LIST request
+			puts += numOps
+		case opRead, opVersionRead, opGetAcl:
+			gets += numOps
+			egress += float64(r.bytesTransmitted)
+		}
+		testSeconds += r.totalDuration.Seconds()
+	}
+	gigabyte := float64(1024 * 1024 * 1024)
+	repeats := 0.0
+	if testSeconds > 0 {
+		repeats = costMonth.Seconds() / testSeconds
+	}
+
+	estimate := &CostEstimate{}
+	estimate.add("Requests", "requests", m.perRequest, requests, repeats*requests)
+	estimate.add("Transfer", "GB", m.perGB, transferred/gigabyte, repeats*transferred/gigabyte)
+	estimate.add("PUT requests", "1k requests", m.per1kPut, puts/1000, repeats*puts/1000)
+	estimate.add("GET requests", "1k requests", m.per1kGet, gets/1000, repeats*gets/1000)
+	estimate.add("Egress", "GB", m.egressPerGB, egress/gigabyte, repeats*egress/gigabyte)
+	estimate.add("Storage", "GB stored", m.storagePerGBMonth,
+		stored/gigabyte*wallClock.Seconds()/costMonth.Seconds(), stored/gigabyte)
+	return estimate
+}
+
+func (e *CostEstimate) String() string {
+	report := fmt.Sprintln("Cost Estimate          this run        per month")
+	for _, item := range e.Items {
+		report += fmt.Sprintf("%-14s %16.4f %16.2f   (%0.3f %s a month at %g)\n",
+			item.Name+":", item.RunCost, item.MonthlyCost, item.MonthlyQuantity, item.Unit, item.Price)
+	}
+	report += fmt.Sprintf("%-14s %16.4f %16.2f\n", "Total:", e.RunCost, e.MonthlyCost)
+	return report
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+)
+
+// Generates object data on the fly so that objects do not need to fit in
+// memory. The data is a deterministic pseudo-random stream, the same seed and
+// position always yield the same bytes, so a reader can seek anywhere and
+// parts of an object can be generated independently.
+type RandomReader struct {
+	seed   uint64
+	start  int64
+	size   int64
+	offset int64
+}
+
+// Returns a reader of the size bytes found at start in the stream of seed
+func NewRandomReader(seed uint64, start, size int64) *RandomReader {
+	return &RandomReader{seed: seed, start: start, size: size}
+}
+
+// The splitmix64 generator, indexed by the position of each 8 byte word
+func (r *RandomReader) word(i int64) uint64 {
+	z := r.seed + uint64(i+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func (r *RandomReader) byteAt(pos int64) byte {
+	return byte(r.word(pos/8) >> (8 * uint(pos%8)))
+}
+
+func (r *RandomReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if remaining := r.size - r.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	pos := r.start + r.offset
+	n := 0
+	for ; n < len(p) && (pos+int64(n))%8 != 0; n++ {
+		p[n] = r.byteAt(pos + int64(n))
+	}
+	for ; n+8 <= len(p); n += 8 {
+		binary.LittleEndian.PutUint64(p[n:], r.word((pos+int64(n))/8))
+	}
+	for ; n < len(p); n++ {
+		p[n] = r.byteAt(pos + int64(n))
+	}
+	r.offset += int64(n)
+	return n, nil
+}
+
+func (r *RandomReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// Returns a reader of the size bytes found at start in the data of key. All
+// objects share the data stream of dataSeed, unless verifyContent gives each
+// key a stream of its own so that reads can tell objects apart.
+func (params *Params) objectData(key string, start, size int64) *RandomReader {
+	seed := dataSeed
+	if params.verifyContent {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		seed ^= h.Sum64()
+	}
+	return NewRandomReader(seed, start, size)
+}
+
+// Compares the data read from a body with the expected data as it is read,
+// whoever reads it
+type DataCheck struct {
+	io.ReadCloser
+	expected *RandomReader
+	want     []byte
+	matches  bool
+}
+
+func NewDataCheck(body io.ReadCloser, expected *RandomReader) *DataCheck {
+	return &DataCheck{ReadCloser: body, expected: expected, matches: true}
+}
+
+func (c *DataCheck) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if n > 0 && c.matches {
+		if len(c.want) < n {
+			c.want = make([]byte, n)
+		}
+		expected, _ := io.ReadFull(c.expected, c.want[:n])
+		c.matches = expected == n && bytes.Equal(p[:n], c.want[:n])
+	}
+	return n, err
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Returns the number of objects of the run's sizes needed to write about
+// datasetSize bytes, at least one
+func (params *Params) samplesForDataset(datasetSize int64) int {
+	mean := float64(params.objectSize)
+	if params.sizeDist != nil {
+		mean = params.sizeDist.Mean()
+	}
+	if mean < 1 {
+		mean = 1
+	}
+	return int(math.Max(1, math.Ceil(float64(datasetSize)/mean)))
+}
+
+// Describes how a dataset of datasetSize bytes is laid out over the objects
+// and clients of the run
+func (params *Params) datasetPlan(datasetSize int64) string {
+	plan := fmt.Sprintf("Planned dataset of about %d bytes:\n", datasetSize)
+	if params.sizeDist != nil {
+		plan += fmt.Sprintf("  %d objects of %s, averaging %s\n", params.numSamples, params.sizeDist, formatSize(int64(params.sizeDist.Mean())))
+	} else {
+		plan += fmt.Sprintf("  %d objects of %s\n", params.numSamples, formatSize(params.objectSize))
+	}
+	perClient := float64(params.numSamples) / float64(params.numClients)
+	plan += fmt.Sprintf("  about %0.0f objects written by each of %d clients\n", math.Round(perClient), params.numClients)
+	plan += fmt.Sprintf("  under %s in bucket %s\n", params.objectNamePrefix, params.bucketName)
+	return plan
+}
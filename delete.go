@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Runs the delete test over the objects written by the run. They are taken
+// off writtenKeys, so that cleanup only deletes those the test failed to.
+func (params *Params) RunDelete() Result {
+	seen := make(map[string]bool, len(params.writtenKeys))
+	params.deleteKeys = params.deleteKeys[:0]
+	// A timed write test may have written the same key several times
+	for _, key := range params.writtenKeys {
+		if !seen[key] {
+			seen[key] = true
+			params.deleteKeys = append(params.deleteKeys, key)
+		}
+	}
+	params.writtenKeys = nil
+	if len(params.buckets) > 1 {
+		// Batches are of the objects of one bucket
+		var grouped []string
+		for _, keys := range params.keysByBucket(params.deleteKeys) {
+			grouped = append(grouped, keys...)
+		}
+		params.deleteKeys = grouped
+	}
+	result := params.Run(opDelete)
+	// The objects submitted are a prefix of deleteKeys, the others are left
+	// for cleanup when the test is aborted
+	handled := result.numDeleted + len(params.writtenKeys)
+	params.writtenKeys = append(params.writtenKeys, params.deleteKeys[handled:]...)
+	return result
+}
+
+// Returns the number of requests the delete test sends
+func (params *Params) numDeleteRequests() int {
+	n := 0
+	for keys := params.deleteKeys; len(keys) > 0; n++ {
+		keys = keys[params.deleteBatchLen(keys):]
+	}
+	return n
+}
+
+// Returns the number of keys the next delete request is for, the following
+// keys of the same bucket up to deleteBatchSize
+func (params *Params) deleteBatchLen(keys []string) int {
+	bucket := params.bucketFor(keys[0])
+	n := 1
+	for n < len(keys) && n < params.deleteBatchSize && params.bucketFor(keys[n]) == bucket {
+		n++
+	}
+	return n
+}
+
+// Submits a DeleteObject request per object when deleteBatchSize is 1, and
+// DeleteObjects requests of deleteBatchSize objects otherwise, until all are
+// submitted or stop is closed, returning the number submitted
+func (params *Params) submitDeletes(startTime time.Time, stop <-chan struct{}) int {
+	keys := params.deleteKeys
+	for i := 0; len(keys) > 0; i++ {
+		bucket := aws.String(params.bucketFor(keys[0]))
+		var request Req
+		if params.deleteBatchSize == 1 {
+			request = &s3.DeleteObjectInput{Bucket: bucket, Key: aws.String(keys[0])}
+			keys = keys[1:]
+		} else {
+			batch := keys[:params.deleteBatchLen(keys)]
+			keys = keys[len(batch):]
+			objects := make([]types.ObjectIdentifier, len(batch))
+			for j, key := range batch {
+				objects[j] = types.ObjectIdentifier{Key: aws.String(key)}
+			}
+			request = &s3.DeleteObjectsInput{Bucket: bucket, Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)}}
+		}
+
+		if params.quiet != nil {
+			params.waitQuiet(startTime)
+		}
+		if params.rateLimit != nil {
+			params.rateLimit.Wait()
+		}
+		select {
+		case params.requests <- request:
+		case <-stop:
+			return i
+		}
+	}
+	return params.numDeleteRequests()
+}
+
+// Returns the number of objects a delete request is for
+func deleteCount(request Req) int {
+	if batch, ok := request.(*s3.DeleteObjectsInput); ok {
+		return len(batch.Delete.Objects)
+	}
+	return 1
+}
+
+// Returns the keys a DeleteObjects request failed to delete, all of them when
+// the request itself failed
+func undeletedKeys(input *s3.DeleteObjectsInput, output *s3.DeleteObjectsOutput, err error) ([]string, error) {
+	var keys []string
+	if err != nil {
+		for _, object := range input.Delete.Objects {
+			keys = append(keys, aws.ToString(object.Key))
+		}
+		return keys, err
+	}
+	for _, e := range output.Errors {
+		keys = append(keys, aws.ToString(e.Key))
+	}
+	if len(keys) > 0 {
+		e := output.Errors[0]
+		err = fmt.Errorf("%d of %d objects not deleted, eg: %s: %s %s",
+			len(keys), len(input.Delete.Objects), aws.ToString(e.Key), aws.ToString(e.Code), aws.ToString(e.Message))
+	}
+	return keys, err
+}
+
+// Puts the objects a delete request failed to delete back for cleanup,
+// returning the number deleted
+func (params *Params) recordDelete(resp Resp) int {
+	params.writtenKeys = append(params.writtenKeys, resp.undeleted...)
+	return deleteCount(resp.request) - len(resp.undeleted)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Routes the requests of each bucket, or key prefix of a bucket, to the
+// endpoint serving it, following the sharding of the target system. Requests
+// matching no route go to the endpoint of their client.
+type EndpointMap struct {
+	// Longest prefix first, so that the first match is the most specific
+	routes []endpointRoute
+}
+
+// The shard is named after the bucket and prefix it matches
+type endpointRoute struct {
+	shard    string
+	bucket   string
+	prefix   string
+	endpoint string
+}
+
+// Reads an endpoint map file, one route per line:
+//
+//	bucket[/prefix] endpoint
+//
+// A bucket of * matches every bucket. Empty lines and lines starting with #
+// are ignored.
+func LoadEndpointMap(path string) (*EndpointMap, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	m := &EndpointMap{}
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected bucket[/prefix] and endpoint", path, lineNum)
+		}
+		if u, err := url.Parse(fields[1]); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("%s:%d: invalid endpoint %q, expected eg: http://IP:PORT", path, lineNum, fields[1])
+		}
+		if seen[fields[0]] {
+			return nil, fmt.Errorf("%s:%d: %s is routed twice", path, lineNum, fields[0])
+		}
+		seen[fields[0]] = true
+		parts := strings.SplitN(fields[0], "/", 2)
+		route := endpointRoute{shard: fields[0], bucket: parts[0], endpoint: fields[1]}
+		if len(parts) == 2 {
+			route.prefix = parts[1]
+		}
+		m.routes = append(m.routes, route)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(m.routes) == 0 {
+		return nil, fmt.Errorf("%s: no routes defined", path)
+	}
+	sort.SliceStable(m.routes, func(i, j int) bool {
+		if len(m.routes[i].prefix) != len(m.routes[j].prefix) {
+			return len(m.routes[i].prefix) > len(m.routes[j].prefix)
+		}
+		// A named bucket wins over * for the same prefix
+		return m.routes[i].bucket != "*" && m.routes[j].bucket == "*"
+	})
+	return m, nil
+}
+
+// Returns the route of a key of bucket, if any
+func (m *EndpointMap) route(bucket, key string) (endpointRoute, bool) {
+	for _, route := range m.routes {
+		if (route.bucket == bucket || route.bucket == "*") && strings.HasPrefix(key, route.prefix) {
+			return route, true
+		}
+	}
+	return endpointRoute{}, false
+}
+
+// Returns the endpoints routed to, to set up the transports for
+func (m *EndpointMap) endpoints() []string {
+	var endpoints []string
+	for _, route := range m.routes {
+		endpoints = append(endpoints, route.endpoint)
+	}
+	return endpoints
+}
+
+// Returns the bucket and key, or prefix, a request is for
+func requestTarget(request Req) (string, string) {
+	switch r := request.(type) {
+	case *s3.PutObjectInput:
+		return aws.ToString(r.Bucket), aws.ToString(r.Key)
+	case *CommitInput:
+		return aws.ToString(r.Bucket), aws.ToString(r.Key)
+	case *CopyInput:
+		return aws.ToString(r.Bucket), aws.ToString(r.Key)
+	case *s3.GetObjectInput:
+		return aws.ToString(r.Bucket), aws.ToString(r.Key)
+	case *s3.ListObjectsV2Input:
+		return aws.ToString(r.Bucket), aws.ToString(r.Prefix)
+	case *s3.ListObjectVersionsInput:
+		return aws.ToString(r.Bucket), aws.ToString(r.Prefix)
+	case *s3.GetObjectTaggingInput:
+		return aws.ToString(r.Bucket), aws.ToString(r.Key)
+	case *s3.DeleteObjectInput:
+		return aws.ToString(r.Bucket), aws.ToString(r.Key)
+	case *s3.DeleteObjectsInput:
+		return aws.ToString(r.Bucket), aws.ToString(r.Delete.Objects[0].Key)
+	case *s3.HeadObjectInput:
+		return aws.ToString(r.Bucket), aws.ToString(r.Key)
+	case *PresignedInput:
+		return requestTarget(r.input)
+	case *KeepWarmInput:
+		return aws.ToString(r.Bucket), ""
+	case *BucketCycleInput:
+		return r.Bucket, ""
+	}
+	return "", ""
+}
+
+func (r *Result) addToShard(resp Resp) {
+	if r.shards == nil {
+		r.shards = make(map[string]*EndpointStats)
+	}
+	stats, ok := r.shards[resp.shard]
+	if !ok {
+		stats = &EndpointStats{}
+		r.shards[resp.shard] = stats
+	}
+	stats.numOps++
+	if resp.err != nil {
+		stats.numErrors++
+		return
+	}
+	stats.bytesTransmitted += resp.numBytes
+	stats.opDurations.Record(resp.duration.Seconds())
+}
+
+// Summarizes the operations of each shard, those matching no route under an
+// empty name
+func (r Result) shardSummaries() map[string]ResultSummary {
+	summaries := make(map[string]ResultSummary, len(r.shards))
+	for shard, stats := range r.shards {
+		summaries[shard] = r.statsSummary(stats)
+	}
+	return summaries
+}
+
+func (r Result) shardReport() string {
+	shards := make([]string, 0, len(r.shards))
+	for shard := range r.shards {
+		shards = append(shards, shard)
+	}
+	sort.Strings(shards)
+
+	report := fmt.Sprintf("%s results by shard:\n", r.operation)
+	report += fmt.Sprintf("%-32s %8s %8s %10s %9s %9s %9s\n", "shard", "ops", "errors", "MB/s", "50th s", "90th s", "99th s")
+	seconds := r.totalDuration.Seconds()
+	for _, shard := range shards {
+		s := r.shards[shard]
+		name := shard
+		if name == "" {
+			name = "(unrouted)"
+		}
+		report += fmt.Sprintf("%-32s %8d %8d %10.2f %9.3f %9.3f %9.3f\n",
+			name, s.numOps, s.numErrors, (float64(s.bytesTransmitted)/(1024*1024))/seconds,
+			s.opDurations.Percentile(50), s.opDurations.Percentile(90), s.opDurations.Percentile(99))
+	}
+	return report
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Summarizes the operations sent to each endpoint the way the whole result
+// is, so that a slow node stands out
+func (r Result) endpointSummaries() map[string]ResultSummary {
+	summaries := make(map[string]ResultSummary, len(r.endpoints))
+	for endpoint, stats := range r.endpoints {
+		summaries[endpoint] = r.statsSummary(stats)
+	}
+	return summaries
+}
+
+// Summarizes a share of the operations of the result
+func (r Result) statsSummary(stats *EndpointStats) ResultSummary {
+	summary := ResultSummary{
+		Operation:       r.operation,
+		Operations:      stats.numOps,
+		Errors:          stats.numErrors,
+		Bytes:           stats.bytesTransmitted,
+		DurationSeconds: r.totalDuration.Seconds(),
+		ThroughputMBps:  (float64(stats.bytesTransmitted) / (1024 * 1024)) / r.totalDuration.Seconds(),
+	}
+	if stats.opDurations.Count() > 0 {
+		summary.Latency = make(map[string]float64)
+		for _, p := range summaryPercentiles {
+			summary.Latency[p.name] = stats.opDurations.Percentile(p.percentile)
+		}
+	}
+	return summary
+}
+
+func (r Result) endpointReport() string {
+	endpoints := make([]string, 0, len(r.endpoints))
+	for endpoint := range r.endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	report := fmt.Sprintf("%s results by endpoint:\n", r.operation)
+	report += fmt.Sprintf("%-32s %8s %8s %10s %9s %9s %9s\n", "endpoint", "ops", "errors", "MB/s", "50th s", "90th s", "99th s")
+	seconds := r.totalDuration.Seconds()
+	for _, endpoint := range endpoints {
+		e := r.endpoints[endpoint]
+		report += fmt.Sprintf("%-32s %8d %8d %10.2f %9.3f %9.3f %9.3f\n",
+			endpoint, e.numOps, e.numErrors, (float64(e.bytesTransmitted)/(1024*1024))/seconds,
+			e.opDurations.Percentile(50), e.opDurations.Percentile(90), e.opDurations.Percentile(99))
+	}
+	return report
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tracks the error rate of the operations completed during a rolling window
+// of time, used to abort runs which do nothing but generate failures
+type ErrorRateMonitor struct {
+	threshold float64
+	window    time.Duration
+	start     time.Time
+	events    []errorEvent
+	numErrors int
+}
+
+type errorEvent struct {
+	at    time.Time
+	error bool
+}
+
+// Parses thresholds of the form "20%/30s", meaning abort when more than 20%
+// of the operations completed in the last 30 seconds failed
+func ParseErrorRateMonitor(spec string) (*ErrorRateMonitor, error) {
+	parts := strings.SplitN(spec, "/", 2)
+	if len(parts) != 2 || !strings.HasSuffix(parts[0], "%") {
+		return nil, fmt.Errorf("expected <percent>%%/<window>, eg: 20%%/30s, got %q", spec)
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(parts[0], "%"), 64)
+	if err != nil || percent <= 0 || percent > 100 {
+		return nil, fmt.Errorf("invalid error rate percentage %q", parts[0])
+	}
+	window, err := time.ParseDuration(parts[1])
+	if err != nil || window <= 0 {
+		return nil, fmt.Errorf("invalid error rate window %q", parts[1])
+	}
+	return &ErrorRateMonitor{threshold: percent / 100, window: window}, nil
+}
+
+// Start a new stage, the rate is only evaluated once a full window of
+// operations has been observed
+func (m *ErrorRateMonitor) Reset() {
+	m.start = time.Now()
+	m.events = m.events[:0]
+	m.numErrors = 0
+}
+
+// Record a completed operation and report whether the error rate over the
+// window now exceeds the threshold
+func (m *ErrorRateMonitor) Add(isError bool) bool {
+	now := time.Now()
+	m.events = append(m.events, errorEvent{now, isError})
+	if isError {
+		m.numErrors++
+	}
+
+	expired := 0
+	for expired < len(m.events) && now.Sub(m.events[expired].at) > m.window {
+		if m.events[expired].error {
+			m.numErrors--
+		}
+		expired++
+	}
+	m.events = m.events[expired:]
+
+	return now.Sub(m.start) >= m.window && m.Rate() > m.threshold
+}
+
+// Fraction of the operations in the window which failed
+func (m *ErrorRateMonitor) Rate() float64 {
+	if len(m.events) == 0 {
+		return 0
+	}
+	return float64(m.numErrors) / float64(len(m.events))
+}
+
+func (m *ErrorRateMonitor) String() string {
+	return fmt.Sprintf("%0.1f%%/%s", m.threshold*100, m.window)
+}
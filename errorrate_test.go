@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseErrorRateMonitor(t *testing.T) {
+	tests := []struct {
+		spec      string
+		threshold float64
+		window    time.Duration
+		ok        bool
+	}{
+		{"20%/30s", 0.2, 30 * time.Second, true},
+		{"100%/1m", 1, time.Minute, true},
+		{"0.5%/500ms", 0.005, 500 * time.Millisecond, true},
+		{"20/30s", 0, 0, false},
+		{"20%", 0, 0, false},
+		{"0%/30s", 0, 0, false},
+		{"101%/30s", 0, 0, false},
+		{"x%/30s", 0, 0, false},
+		{"20%/30", 0, 0, false},
+		{"20%/0s", 0, 0, false},
+		{"20%/-1s", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, test := range tests {
+		m, err := ParseErrorRateMonitor(test.spec)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %s", test.spec, m)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+			continue
+		}
+		if m.threshold != test.threshold || m.window != test.window {
+			t.Errorf("%q: threshold %g over %s, expected %g over %s", test.spec, m.threshold, m.window, test.threshold, test.window)
+		}
+	}
+}
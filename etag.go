@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Mismatches listed in the report, the first ones found
+const etagExamples = 5
+
+// Remembers the ETags of the objects written, or listed by the manifest read,
+// keyed by key and by key and version. Reads then check that they get the
+// same ETag back, catching objects corrupted or served from the wrong place
+// whose size still matches. Only used by the goroutine collecting responses.
+type ETags map[string]string
+
+func etagKey(key, versionID string) string {
+	if versionID == "" {
+		return key
+	}
+	return key + "\x00" + versionID
+}
+
+func trimETag(etag *string) string {
+	return strings.Trim(aws.ToString(etag), `"`)
+}
+
+// Records the ETag returned by a write, which is then that of the latest
+// version of the key
+func (e ETags) add(key string, output *s3.PutObjectOutput) {
+	etag := trimETag(output.ETag)
+	if etag == "" {
+		return
+	}
+	e[key] = etag
+	if versionID := aws.ToString(output.VersionId); versionID != "" {
+		e[etagKey(key, versionID)] = etag
+	}
+}
+
+// Compares the ETag returned by a GET or HEAD with the one recorded for the
+// object, failing the response on a mismatch. Objects without a recorded
+// ETag, and those found under a legacy name, are not checked.
+func (e ETags) check(resp *Resp, result *Result) {
+	if resp.err != nil || resp.keyFormat != "" {
+		return
+	}
+	var got *string
+	var versionID string
+	switch output := resp.output.(type) {
+	case *s3.GetObjectOutput:
+		got, versionID = output.ETag, aws.ToString(readInput(resp.request).VersionId)
+	case *s3.HeadObjectOutput:
+		got, versionID = output.ETag, aws.ToString(resp.request.(*s3.HeadObjectInput).VersionId)
+	default:
+		return
+	}
+	want, ok := e[etagKey(resp.key, versionID)]
+	if !ok {
+		return
+	}
+	result.etagsChecked++
+	if etag := trimETag(got); etag != want {
+		result.etagMismatches++
+		if len(result.etagExamples) < etagExamples {
+			result.etagExamples = append(result.etagExamples, fmt.Sprintf("%s: written %s, read %s", resp.key, want, etag))
+		}
+		resp.err = fmt.Errorf("ETag %s does not match %s returned by the write", etag, want)
+		resp.corrupt = true
+	}
+}
+
+func (r Result) etagReport() string {
+	report := fmt.Sprintf("ETags Checked:     %d\n", r.etagsChecked)
+	report += fmt.Sprintf("ETag Mismatches:   %d\n", r.etagMismatches)
+	for _, example := range r.etagExamples {
+		report += fmt.Sprintf("  %s\n", example)
+	}
+	return report
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// How the ETag returned by a write relates to the data written. Clients
+// relying on S3's conventions take the ETag of an object written in one part
+// for the MD5 of its data, and that of an object written in parts for the MD5
+// of the MD5s of the parts followed by the number of parts.
+const (
+	etagFormatMD5          = "single part, MD5 of the data"
+	etagFormatNotMD5       = "single part, not the MD5 of the data"
+	etagFormatMultipart    = "multipart, MD5 of the part MD5s-N"
+	etagFormatPartHash     = "multipart, hash-N of another hash"
+	etagFormatPartCount    = "multipart, hash-N of another number of parts"
+	etagFormatNotMultipart = "multipart, not hash-N"
+	etagFormatEncrypted    = "SSE-KMS or SSE-C, not checked"
+)
+
+// Classifies the ETag returned by the write of an object, whose data is the
+// size bytes of the object's data stream. The ETags of objects encrypted with
+// SSE-KMS or SSE-C are not MD5s of their data.
+func (params *Params) etagFormat(key string, size int64, etag *string) string {
+	if params.sse != nil && params.sse.inventoryStatus() != "SSE-S3" {
+		return etagFormatEncrypted
+	}
+	got := trimETag(etag)
+	if params.multipartSize <= 0 || size <= params.multipartSize {
+		if got == params.etagMD5s.get(params.objectData(key, 0, size)) {
+			return etagFormatMD5
+		}
+		return etagFormatNotMD5
+	}
+	i := strings.LastIndex(got, "-")
+	if i != 2*md5.Size {
+		return etagFormatNotMultipart
+	}
+	if _, err := hex.DecodeString(got[:i]); err != nil {
+		return etagFormatNotMultipart
+	}
+	count, err := strconv.Atoi(got[i+1:])
+	if err != nil {
+		return etagFormatNotMultipart
+	}
+	var parts []byte
+	numParts := 0
+	for start := int64(0); start < size; start += params.multipartSize {
+		partSize := params.multipartSize
+		if start+partSize > size {
+			partSize = size - start
+		}
+		sum, _ := hex.DecodeString(params.etagMD5s.get(params.objectData(key, start, partSize)))
+		parts = append(parts, sum...)
+		numParts++
+	}
+	if count != numParts {
+		return etagFormatPartCount
+	}
+	if sum := md5.Sum(parts); got[:i] != hex.EncodeToString(sum[:]) {
+		return etagFormatPartHash
+	}
+	return etagFormatMultipart
+}
+
+func (r *Result) addETagFormat(resp Resp) {
+	if resp.etagFormat == "" {
+		return
+	}
+	if r.etagFormats == nil {
+		r.etagFormats = make(map[string]int)
+	}
+	r.etagFormats[resp.etagFormat]++
+}
+
+// Returns the share of the ETags checked which follow S3's conventions
+func (r Result) etagConformance() (conforming, checked int) {
+	for format, n := range r.etagFormats {
+		switch format {
+		case etagFormatEncrypted:
+			continue
+		case etagFormatMD5, etagFormatMultipart:
+			conforming += n
+		}
+		checked += n
+	}
+	return conforming, checked
+}
+
+func (r Result) etagFormatReport() string {
+	report := fmt.Sprintln("ETag Format:")
+	formats := make([]string, 0, len(r.etagFormats))
+	for format := range r.etagFormats {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	for _, format := range formats {
+		report += fmt.Sprintf("  %-45s %d\n", format+":", r.etagFormats[format])
+	}
+	if conforming, checked := r.etagConformance(); checked > 0 {
+		report += fmt.Sprintf("ETag Conformance:  %0.2f%% (%d of %d writes)\n", 100*float64(conforming)/float64(checked), conforming, checked)
+	}
+	return report
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	// A probe fails when fewer operations than this fraction of the offered
+	// rate completed per second, meaning the clients could not keep up
+	minAchievedRatio = 0.95
+	// or when more than this fraction of its operations failed
+	maxProbeErrorRate = 0.01
+	// Most bisections made once the search has found a failing rate
+	maxBisections = 6
+)
+
+// A latency percentile that must stay under a bound, e.g. p99<100ms
+type LatencyTarget struct {
+	percentile float64
+	max        time.Duration
+}
+
+var latencyTargetPattern = regexp.MustCompile(`^p(\d{1,3}(?:\.\d+)?)<(.+)$`)
+
+func ParseLatencyTarget(spec string) (LatencyTarget, error) {
+	match := latencyTargetPattern.FindStringSubmatch(spec)
+	if match == nil {
+		return LatencyTarget{}, fmt.Errorf("invalid latency target %q, expected e.g. p99<100ms", spec)
+	}
+	p, _ := strconv.ParseFloat(match[1], 64)
+	max, err := time.ParseDuration(match[2])
+	if err != nil || p > 100 || max <= 0 {
+		return LatencyTarget{}, fmt.Errorf("invalid latency target %q, expected e.g. p99<100ms", spec)
+	}
+	return LatencyTarget{percentile: p, max: max}, nil
+}
+
+func (t LatencyTarget) String() string {
+	return fmt.Sprintf("p%g<%s", t.percentile, t.max)
+}
+
+// Searches for the highest read rate meeting a latency target
+type RateSearch struct {
+	target        LatencyTarget
+	probeDuration time.Duration
+	startRate     float64
+	probes        []RateProbe
+	maxRate       float64
+}
+
+// The outcome of reading at one offered rate
+type RateProbe struct {
+	rate      float64
+	achieved  float64
+	latency   float64
+	errorRate float64
+	passed    bool
+}
+
+// Reads at increasing offered rates, doubling from the start rate until the
+// target is missed and then bisecting between the last rate which met it and
+// the first which did not. Each probe reads for the probe duration, cycling
+// over the objects written by the write test.
+func (params *Params) FindMaxRate(search *RateSearch) {
+	numSamples, numKeys, duration, rateLimit := params.numSamples, params.numKeys, params.duration, params.rateLimit
+	defer func() {
+		params.numSamples, params.numKeys, params.duration = numSamples, numKeys, duration
+		params.rateLimit = rateLimit
+	}()
+	if params.numKeys == 0 {
+		params.numKeys = numSamples
+	}
+	params.duration = 0
+
+	search.run(func(rate float64) RateProbe {
+		probe := params.probeRate(search.target, search.probeDuration, rate)
+		fmt.Printf("Offered %0.1f ops/s: achieved %0.1f ops/s, %s %0.3f s, %0.1f%% errors - %s\n",
+			probe.rate, probe.achieved, search.target, probe.latency, probe.errorRate*100, passFail(probe.passed))
+		return probe
+	})
+}
+
+// Runs the search over the outcomes of probe at each rate tried
+func (s *RateSearch) run(probeRate func(rate float64) RateProbe) {
+	passed, failed := 0.0, 0.0
+	for rate, bisections := s.startRate, 0; bisections <= maxBisections; {
+		probe := probeRate(rate)
+		s.probes = append(s.probes, probe)
+
+		if probe.passed {
+			passed = rate
+		} else {
+			failed = rate
+		}
+		if failed == 0 {
+			rate *= 2
+			continue
+		}
+		// Close enough once the bounds are within 2% of each other
+		if failed-passed <= failed*0.02 {
+			break
+		}
+		rate = (passed + failed) / 2
+		bisections++
+	}
+	s.maxRate = passed
+}
+
+func (params *Params) probeRate(target LatencyTarget, duration time.Duration, rate float64) RateProbe {
+	params.numSamples = int(rate * duration.Seconds())
+	if params.numSamples < 1 {
+		params.numSamples = 1
+	}
+	params.rateLimit = NewRateLimiter(rate)
+	result := params.Run(opRead)
+
+	probe := RateProbe{
+		rate:      rate,
+		achieved:  float64(params.numSamples) / result.totalDuration.Seconds(),
+		errorRate: float64(result.numErrors) / float64(params.numSamples),
+	}
+	if result.opDurations.Count() > 0 {
+		probe.latency = result.percentile(target.percentile)
+	}
+	probe.passed = result.opDurations.Count() > 0 && result.aborted == "" &&
+		probe.latency < target.max.Seconds() &&
+		probe.achieved >= rate*minAchievedRatio &&
+		probe.errorRate <= maxProbeErrorRate
+	return probe
+}
+
+func passFail(passed bool) string {
+	if passed {
+		return "pass"
+	}
+	return "fail"
+}
+
+func (s RateSearch) String() string {
+	report := fmt.Sprintf("Results Summary for Max Rate Search (%s)\n", s.target)
+	report += fmt.Sprintf("%12s %12s %10s %8s\n", "offered/s", "achieved/s", fmt.Sprintf("p%g s", s.target.percentile), "errors")
+	for _, probe := range s.probes {
+		report += fmt.Sprintf("%12.1f %12.1f %10.3f %7.1f%% %s\n",
+			probe.rate, probe.achieved, probe.latency, probe.errorRate*100, passFail(probe.passed))
+	}
+	if s.maxRate > 0 {
+		report += fmt.Sprintf("Max Sustainable Rate: %0.1f ops/s\n", s.maxRate)
+	} else {
+		report += fmt.Sprintf("Max Sustainable Rate: none, %0.1f ops/s already misses the target\n", s.startRate)
+	}
+	return report
+}
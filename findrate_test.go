@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLatencyTarget(t *testing.T) {
+	tests := []struct {
+		spec       string
+		percentile float64
+		max        time.Duration
+		ok         bool
+	}{
+		{"p99<100ms", 99, 100 * time.Millisecond, true},
+		{"p99.9<1s", 99.9, time.Second, true},
+		{"p50<250us", 50, 250 * time.Microsecond, true},
+		{"p100<2s", 100, 2 * time.Second, true},
+		{"p101<2s", 0, 0, false},
+		{"p99<0s", 0, 0, false},
+		{"p99<100", 0, 0, false},
+		{"p99>100ms", 0, 0, false},
+		{"99<100ms", 0, 0, false},
+		{"p<100ms", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, test := range tests {
+		target, err := ParseLatencyTarget(test.spec)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %s", test.spec, target)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+			continue
+		}
+		if target.percentile != test.percentile || target.max != test.max {
+			t.Errorf("%q: %s, expected p%g<%s", test.spec, target, test.percentile, test.max)
+		}
+	}
+}
+
+func TestRateSearch(t *testing.T) {
+	tests := []struct {
+		name      string
+		startRate float64
+		// Highest rate the simulated service sustains
+		capacity float64
+		// Bounds of the rate found
+		min, max float64
+		// Most probes the search may take
+		maxProbes int
+	}{
+		{"doubles then bisects", 10, 100, 98, 100, 12},
+		{"capacity on a doubling", 10, 80, 78.4, 80, 12},
+		{"below the start rate", 10, 5, 4.9, 5, 12},
+		{"nothing sustained", 10, 0, 0, 0, 7},
+		{"fractional rates", 0.5, 3, 2.94, 3, 12},
+	}
+	for _, test := range tests {
+		search := &RateSearch{startRate: test.startRate}
+		search.run(func(rate float64) RateProbe {
+			return RateProbe{rate: rate, passed: rate <= test.capacity}
+		})
+		if search.maxRate < test.min || search.maxRate > test.max {
+			t.Errorf("%s: found %g ops/s, expected between %g and %g", test.name, search.maxRate, test.min, test.max)
+		}
+		if len(search.probes) > test.maxProbes {
+			t.Errorf("%s: %d probes, expected at most %d", test.name, len(search.probes), test.maxProbes)
+		}
+		for _, probe := range search.probes {
+			if probe.passed && probe.rate > search.maxRate {
+				t.Errorf("%s: %g ops/s passed but the max found is %g", test.name, probe.rate, search.maxRate)
+			}
+		}
+	}
+}
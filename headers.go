@@ -0,0 +1,31 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Alternative values for a header sent on PUT requests, separated by '|'
+// since header values such as Cache-Control may themselves contain commas
+type HeaderVariants []string
+
+func parseHeaderVariants(value string) HeaderVariants {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, "|")
+}
+
+// Picks the value to send for the i-th object, either at random or by
+// cycling through the variants, nil means the header is not sent
+func (h HeaderVariants) pick(i int, randomize bool) *string {
+	if len(h) == 0 {
+		return nil
+	}
+	if randomize {
+		return aws.String(h[rand.Intn(len(h))])
+	}
+	return aws.String(h[i%len(h)])
+}
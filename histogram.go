@@ -0,0 +1,122 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// Values below twice this many microseconds are recorded exactly, larger ones
+// to within 1/histogramSubBuckets of their value, about three significant
+// digits
+const histogramSubBuckets = 1024
+
+const (
+	statsModeSketch = "sketch"
+	statsModeExact  = "exact"
+)
+
+// Whether histograms keep every duration instead of counting them in buckets,
+// for percentiles exact to the nanosecond at the cost of memory growing with
+// the number of operations. Set once from statsMode before any is recorded.
+var exactStats bool
+
+// A high dynamic range histogram of durations in seconds. Memory is bounded
+// by the range of the durations rather than their number, so that runs of
+// tens of millions of operations can keep every one, unless exactStats keeps
+// the durations themselves. The zero value is an empty histogram.
+type Histogram struct {
+	counts   []int64
+	samples  []float64 // Only with exactStats
+	sorted   bool
+	count    int64
+	sum      float64
+	min, max float64
+}
+
+// Returns the index of the bucket of the given number of microseconds
+func histogramIndex(v uint64) int {
+	if v < 2*histogramSubBuckets {
+		return int(v)
+	}
+	// Shift v into [histogramSubBuckets, 2*histogramSubBuckets)
+	shift := bits.Len64(v) - bits.Len64(2*histogramSubBuckets-1)
+	return 2*histogramSubBuckets + (shift-1)*histogramSubBuckets + int(v>>uint(shift)) - histogramSubBuckets
+}
+
+// Returns the middle of the range of microseconds of a bucket
+func histogramValue(index int) float64 {
+	if index < 2*histogramSubBuckets {
+		return float64(index)
+	}
+	shift := uint((index-2*histogramSubBuckets)/histogramSubBuckets + 1)
+	mantissa := uint64((index-2*histogramSubBuckets)%histogramSubBuckets + histogramSubBuckets)
+	low := mantissa << shift
+	return float64(low) + float64(uint64(1)<<shift-1)/2
+}
+
+func (h *Histogram) Record(seconds float64) {
+	if seconds < 0 {
+		seconds = 0
+	}
+	if exactStats {
+		h.samples = append(h.samples, seconds)
+		h.sorted = false
+	} else {
+		index := histogramIndex(uint64(math.Round(seconds * 1e6)))
+		if index >= len(h.counts) {
+			counts := make([]int64, index+1, index+1+histogramSubBuckets)
+			copy(counts, h.counts)
+			h.counts = counts
+		}
+		h.counts[index]++
+	}
+	if h.count == 0 || seconds < h.min {
+		h.min = seconds
+	}
+	if seconds > h.max {
+		h.max = seconds
+	}
+	h.count++
+	h.sum += seconds
+}
+
+func (h *Histogram) Count() int {
+	return int(h.count)
+}
+
+// Returns the total of the recorded durations
+func (h *Histogram) Sum() float64 {
+	return h.sum
+}
+
+// Returns the p-th percentile by nearest rank, the exact minimum and maximum
+// for 0 and 100
+func (h *Histogram) Percentile(p float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+	if p <= 0 {
+		return h.min
+	}
+	if p >= 100 {
+		return h.max
+	}
+	if h.samples != nil {
+		if !h.sorted {
+			sort.Float64s(h.samples)
+			h.sorted = true
+		}
+		return percentile(h.samples, p)
+	}
+	rank := int64(math.Ceil(p / 100 * float64(h.count)))
+	var seen int64
+	for index, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			value := histogramValue(index) / 1e6
+			return math.Min(math.Max(value, h.min), h.max)
+		}
+	}
+	return h.max
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestHistogramPercentiles(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name string
+		// Duration in seconds of the i-th operation
+		duration func(i int) float64
+		count    int
+	}{
+		{"single", func(int) float64 { return 0.25 }, 1},
+		{"sub-millisecond", func(i int) float64 { return float64(i%2000) / 1e6 }, 5000},
+		{"linear", func(i int) float64 { return float64(i) / 1000 }, 10000},
+		{"lognormal", func(int) float64 { return math.Exp(r.NormFloat64()) / 100 }, 50000},
+		{"bimodal", func(i int) float64 {
+			if i%100 == 0 {
+				return 2 + r.Float64()
+			}
+			return 0.005 + r.Float64()/1000
+		}, 20000},
+		{"long tail", func(int) float64 { return 0.001 / math.Pow(1-r.Float64(), 2) }, 20000},
+	}
+	percentiles := []float64{0, 1, 25, 50, 75, 90, 99, 99.9, 99.99, 100}
+	defer func() { exactStats = false }()
+	for _, test := range tests {
+		var h, e Histogram
+		exact := make([]float64, test.count)
+		var sum float64
+		for i := range exact {
+			exact[i] = test.duration(i)
+			exactStats = false
+			h.Record(exact[i])
+			exactStats = true
+			e.Record(exact[i])
+			sum += exact[i]
+		}
+		sort.Float64s(exact)
+		if h.Count() != test.count {
+			t.Errorf("%s: count %d, expected %d", test.name, h.Count(), test.count)
+		}
+		if math.Abs(h.Sum()-sum) > 1e-9*sum {
+			t.Errorf("%s: sum %g, expected %g", test.name, h.Sum(), sum)
+		}
+		for _, p := range percentiles {
+			got, want := h.Percentile(p), percentile(exact, p)
+			// Values are kept to the microsecond, and beyond 2048us to
+			// within 1/histogramSubBuckets
+			tolerance := math.Max(0.5e-6, want/histogramSubBuckets)
+			if math.Abs(got-want) > tolerance {
+				t.Errorf("%s: p%g %g s, expected %g s", test.name, p, got, want)
+			}
+			if got := e.Percentile(p); got != want {
+				t.Errorf("%s: p%g %g s with exact stats, expected %g s", test.name, p, got, want)
+			}
+		}
+	}
+}
+
+func TestHistogramEmpty(t *testing.T) {
+	var h Histogram
+	if h.Count() != 0 || h.Percentile(50) != 0 || h.Percentile(100) != 0 {
+		t.Errorf("empty histogram: count %d, p50 %g, max %g", h.Count(), h.Percentile(50), h.Percentile(100))
+	}
+	h.Record(-1)
+	if h.Percentile(0) != 0 || h.Percentile(100) != 0 {
+		t.Errorf("negative duration recorded as %g to %g, expected 0", h.Percentile(0), h.Percentile(100))
+	}
+}
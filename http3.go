@@ -0,0 +1,57 @@
+//go:build http3
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// Returns a round tripper speaking HTTP/3 over QUIC, recording the duration
+// of every QUIC handshake, whether it resumed a session, and the transfer
+// counters of every connection in stats
+func newHTTP3Transport(stats *TransportStats, tlsConfig *tls.Config, disableResumption bool) (http.RoundTripper, error) {
+	tlsConfig = tlsConfig.Clone()
+	if disableResumption {
+		tlsConfig.SessionTicketsDisabled = true
+	} else {
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+	return &http3.Transport{
+		TLSClientConfig: tlsConfig,
+		Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+			start := time.Now()
+			conn, err := quic.DialAddrEarly(ctx, addr, tlsCfg, cfg)
+			if err != nil {
+				stats.addHandshake(addr, time.Since(start), false, err)
+				return nil, err
+			}
+			stats.addConnection(addr, func() transferStats {
+				s := conn.ConnectionStats()
+				return transferStats{
+					bytesSent:     s.BytesSent,
+					bytesReceived: s.BytesReceived,
+					packetsSent:   s.PacketsSent,
+					packetsLost:   s.PacketsLost,
+					smoothedRTT:   s.SmoothedRTT,
+				}
+			})
+			// Requests may already be sent using 0-RTT, so wait for the
+			// handshake to complete without holding them back
+			go func() {
+				select {
+				case <-conn.HandshakeComplete():
+					stats.addHandshake(addr, time.Since(start), conn.ConnectionState().TLS.DidResume, nil)
+				case <-conn.Context().Done():
+					stats.addHandshake(addr, time.Since(start), false, conn.Context().Err())
+				}
+			}()
+			return conn, nil
+		},
+	}, nil
+}
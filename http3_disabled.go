@@ -0,0 +1,15 @@
+//go:build !http3
+
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+)
+
+// HTTP/3 pulls in the QUIC stack, so it is only available in binaries built
+// with the http3 tag
+func newHTTP3Transport(stats *TransportStats, tlsConfig *tls.Config, disableResumption bool) (http.RoundTripper, error) {
+	return nil, errors.New("s3bench was built without HTTP/3 support, rebuild it with -tags http3")
+}
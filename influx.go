@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Number of interval points queued for posting before new ones are dropped
+const influxQueueSize = 64
+
+// Streams a point per operation type and interval to InfluxDB while the tests
+// run. Points are posted in the background so that a slow database never
+// holds up the benchmark.
+type InfluxWriter struct {
+	url      string
+	token    string
+	tags     string
+	interval time.Duration
+	points   chan []byte
+	done     chan struct{}
+	mu       sync.Mutex
+	err      error
+	dropped  int
+}
+
+// Throughput and latency of the operations completed during one interval
+type InfluxInterval struct {
+	start       time.Time
+	numErrors   int
+	bytes       int64
+	opDurations []float64
+}
+
+// Writes to the database of an InfluxDB server, e.g. http://influx:8086, with
+// tags such as firmware=1.2,cluster=lab added to every point. InfluxDB 2
+// tokens are taken from INFLUXDB_TOKEN.
+func NewInfluxWriter(baseURL, database, tags string, interval time.Duration) (*InfluxWriter, error) {
+	if database == "" {
+		return nil, fmt.Errorf("influxURL needs influxDB")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("influxInterval needs to be greater than 0")
+	}
+	tagMap, err := parseTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	w := &InfluxWriter{
+		url:      strings.TrimSuffix(baseURL, "/") + "/write?db=" + url.QueryEscape(database),
+		token:    os.Getenv("INFLUXDB_TOKEN"),
+		tags:     formatInfluxTags(tagMap),
+		interval: interval,
+		points:   make(chan []byte, influxQueueSize),
+		done:     make(chan struct{}),
+	}
+	go w.post()
+	return w, nil
+}
+
+// Formats tags sorted by key, as InfluxDB recommends, each preceded by a comma
+func formatInfluxTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	formatted := ""
+	for _, key := range keys {
+		formatted += "," + influxTagEscaper.Replace(key) + "=" + influxTagEscaper.Replace(tags[key])
+	}
+	return formatted
+}
+
+func (w *InfluxWriter) post() {
+	defer close(w.done)
+	for point := range w.points {
+		if err := postInfluxLines(w.url, w.token, point); err != nil {
+			w.mu.Lock()
+			if w.err == nil {
+				w.err = err
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+func (interval *InfluxInterval) add(resp Resp) {
+	if resp.err != nil {
+		interval.numErrors++
+		return
+	}
+	interval.bytes += resp.numBytes
+	interval.opDurations = append(interval.opDurations, resp.duration.Seconds())
+}
+
+// Queues the point of an interval ending now, dropping it if the database
+// cannot keep up
+func (w *InfluxWriter) Write(op, bucket string, interval *InfluxInterval) {
+	now := time.Now()
+	seconds := now.Sub(interval.start).Seconds()
+	if seconds <= 0 {
+		return
+	}
+	sort.Float64s(interval.opDurations)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "s3bench_interval,operation=%s,bucket=%s%s operations=%di,errors=%di,bytes=%di,throughput_mbps=%g,ops_per_second=%g",
+		influxTagEscaper.Replace(op), influxTagEscaper.Replace(bucket), w.tags,
+		len(interval.opDurations), interval.numErrors, interval.bytes,
+		(float64(interval.bytes)/(1024*1024))/seconds, float64(len(interval.opDurations))/seconds)
+	if len(interval.opDurations) > 0 {
+		for _, p := range []float64{50, 90, 99} {
+			fmt.Fprintf(&buf, ",latency_p%g=%g", p, percentile(interval.opDurations, p))
+		}
+	}
+	fmt.Fprintf(&buf, " %d\n", now.UnixNano())
+
+	select {
+	case w.points <- buf.Bytes():
+	default:
+		w.mu.Lock()
+		w.dropped++
+		w.mu.Unlock()
+	}
+}
+
+// Waits for the queued points to be posted, returning the first error
+func (w *InfluxWriter) Close() error {
+	close(w.points)
+	<-w.done
+	if w.err == nil && w.dropped > 0 {
+		return fmt.Errorf("dropped %d interval points, the database did not keep up", w.dropped)
+	}
+	return w.err
+}
+
+// Posts points in the line protocol to an InfluxDB write endpoint
+func postInfluxLines(endpoint, token string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	keyCharsetASCII   = "ascii"
+	keyCharsetUnicode = "unicode"
+	keyCharsetSpecial = "special"
+
+	// Longest key S3 accepts, in bytes of UTF-8
+	maxKeyLength = 1024
+)
+
+// A kind of key name, appended to the usual prefix and object number
+type keyVariant struct {
+	class  string
+	suffix string
+	// Pad the key to maxKeyLength with this string
+	pad string
+}
+
+// Key variants cycled through by each charset, the first is always plain so
+// that the penalty of the others can be compared against it
+var keyVariants = map[string][]keyVariant{
+	keyCharsetASCII: {{class: "plain"}},
+	keyCharsetSpecial: {
+		{class: "plain"},
+		{class: "space", suffix: " with spaces "},
+		{class: "plus", suffix: "+plus+signs"},
+		{class: "percent", suffix: "%20percent%2Fencoded"},
+		{class: "reserved", suffix: "?&=#;:@$,'!()*[]"},
+		{class: "long", suffix: "-", pad: "x"},
+	},
+	keyCharsetUnicode: {
+		{class: "plain"},
+		{class: "latin", suffix: "-café-naïve-Ångström"},
+		{class: "cjk", suffix: "-日本語のキー"},
+		{class: "emoji", suffix: "-🚀🔥🪣"},
+		{class: "rtl", suffix: "-مفتاح-מפתח"},
+		{class: "long", suffix: "-", pad: "é"},
+	},
+}
+
+// Returns the name of the i-th object
+func (params *Params) objectKey(i int) string {
+	variants := keyVariants[params.keyCharset]
+	if len(variants) == 0 {
+		return fmt.Sprintf("%s%d", params.objectNamePrefix, i)
+	}
+	variant := variants[i%len(variants)]
+	key := fmt.Sprintf("%s%d%s", params.objectNamePrefix, i, variant.suffix)
+	// A prefix already reaching the limit leaves nothing to pad, the server
+	// then rejecting the name as too long
+	if variant.pad != "" && len(key) < maxKeyLength {
+		key += strings.Repeat(variant.pad, (maxKeyLength-len(key))/len(variant.pad))
+	}
+	return key
+}
+
+// Returns the number of an object from a key generated by objectKey
+func (params *Params) keyNumber(key string) (int, bool) {
+	if !strings.HasPrefix(key, params.objectNamePrefix) {
+		return 0, false
+	}
+	rest := key[len(params.objectNamePrefix):]
+	end := strings.IndexFunc(rest, func(r rune) bool { return r < '0' || r > '9' })
+	if end < 0 {
+		end = len(rest)
+	}
+	i, err := strconv.Atoi(rest[:end])
+	return i, err == nil
+}
+
+// Returns the variant class of a key generated by objectKey
+func (params *Params) keyClass(key string) string {
+	variants := keyVariants[params.keyCharset]
+	i, ok := params.keyNumber(key)
+	if !ok || len(variants) == 0 {
+		return "plain"
+	}
+	return variants[i%len(variants)].class
+}
+
+func (r *Result) addToKeyClass(resp Resp, class string) {
+	if r.keyClasses == nil {
+		r.keyClasses = make(map[string]*KeyClassStats)
+	}
+	stats, ok := r.keyClasses[class]
+	if !ok {
+		stats = &KeyClassStats{}
+		r.keyClasses[class] = stats
+	}
+	if resp.err != nil {
+		stats.numErrors++
+	} else {
+		stats.opDurations.Record(resp.duration.Seconds())
+	}
+}
+
+// Operation times and errors of the keys of one variant class
+type KeyClassStats struct {
+	opDurations Histogram
+	numErrors   int
+}
+
+func (r Result) keyClassReport() string {
+	var plainMedian float64
+	if plain, ok := r.keyClasses["plain"]; ok && plain.opDurations.Count() > 0 {
+		plainMedian = plain.opDurations.Percentile(50)
+	}
+
+	classes := make([]string, 0, len(r.keyClasses))
+	for class := range r.keyClasses {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+
+	report := fmt.Sprintf("%s times by key name:\n", r.operation)
+	report += fmt.Sprintf("%-10s %8s %8s %9s %9s %9s\n", "keys", "count", "errors", "50th s", "99th s", "vs plain")
+	for _, class := range classes {
+		stats := r.keyClasses[class]
+		if stats.opDurations.Count() == 0 {
+			report += fmt.Sprintf("%-10s %8d %8d\n", class, stats.numErrors, stats.numErrors)
+			continue
+		}
+		median := stats.opDurations.Percentile(50)
+		penalty := ""
+		if plainMedian > 0 {
+			penalty = fmt.Sprintf("%+0.1f%%", 100*(median-plainMedian)/plainMedian)
+		}
+		report += fmt.Sprintf("%-10s %8d %8d %9.3f %9.3f %9s\n", class, stats.opDurations.Count()+stats.numErrors,
+			stats.numErrors, median, stats.opDurations.Percentile(99), penalty)
+	}
+	return report
+}
+
+// Lists the prefix and checks that every written key comes back unchanged,
+// returning the keys which did not
+func (params *Params) verifyKeyRoundTrip(svc *s3.Client) ([]string, error) {
+	listed := make(map[string]bool)
+	for _, bucket := range params.buckets {
+		pages := s3.NewListObjectsV2Paginator(svc, &s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(params.objectNamePrefix),
+		})
+		for pages.HasMorePages() {
+			page, err := pages.NextPage(context.Background())
+			if err != nil {
+				return nil, err
+			}
+			for _, obj := range page.Contents {
+				listed[*obj.Key] = true
+			}
+		}
+	}
+	var mismatched []string
+	for _, key := range params.writtenKeys {
+		if !listed[key] {
+			mismatched = append(mismatched, key)
+		}
+	}
+	return mismatched, nil
+}
+
+func (params *Params) keyRoundTripReport(svc *s3.Client) string {
+	mismatched, err := params.verifyKeyRoundTrip(svc)
+	if err != nil {
+		return fmt.Sprintf("Key round trip: failed to list written keys (%v)\n", err)
+	}
+	report := fmt.Sprintf("Key round trip: %d/%d written keys listed back unchanged\n",
+		len(params.writtenKeys)-len(mismatched), len(params.writtenKeys))
+	for _, key := range mismatched {
+		report += fmt.Sprintf("  not listed: %q (%s)\n", key, params.keyClass(key))
+	}
+	return report
+}
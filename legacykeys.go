@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Legacy key format of objectNamePrefix followed by the object number, as
+// keys were named before keyCharset and run ID prefixes
+const legacyKeyPlain = "plain"
+
+// Alternative names of the objects to read, tried in order when an object
+// does not exist under its current name, such as those of buckets populated
+// by older versions. Each is legacyKeyPlain or a format of the object number,
+// eg: loadgen_test_%d.
+type LegacyKeyFormats []string
+
+func ParseLegacyKeyFormats(spec string) (LegacyKeyFormats, error) {
+	formats := LegacyKeyFormats(strings.Split(spec, ","))
+	for _, format := range formats {
+		if format == legacyKeyPlain {
+			continue
+		}
+		if !strings.Contains(format, "%") || strings.Contains(fmt.Sprintf(format, 0), "%!") {
+			return nil, fmt.Errorf("invalid legacyKeyFormats %q, expected %s or a format of the object number such as loadgen_test_%%d", format, legacyKeyPlain)
+		}
+	}
+	return formats, nil
+}
+
+// Returns the name of the i-th object in a legacy format
+func (params *Params) legacyKey(format string, i int) string {
+	if format == legacyKeyPlain {
+		return fmt.Sprintf("%s%d", params.objectNamePrefix, i)
+	}
+	return fmt.Sprintf(format, i)
+}
+
+// Reads an object which does not exist under its current name under each of
+// the legacy names in turn, returning the output of the first found along
+// with its format. The error of the read of the current name is returned when
+// none is found.
+func (params *Params) readLegacyKey(ctx context.Context, svc *s3.Client, input *s3.GetObjectInput, err error,
+	optFns []func(*s3.Options)) (*s3.GetObjectOutput, string, error) {
+	i, ok := params.keyNumber(*input.Key)
+	var noSuchKey *types.NoSuchKey
+	if !ok || !errors.As(err, &noSuchKey) {
+		return nil, "", err
+	}
+	for _, format := range params.legacyKeyFormats {
+		key := params.legacyKey(format, i)
+		if key == *input.Key {
+			continue
+		}
+		legacyInput := *input
+		legacyInput.Key = aws.String(key)
+		output, legacyErr := svc.GetObject(ctx, &legacyInput, optFns...)
+		if legacyErr == nil {
+			return output, format, nil
+		}
+		if !errors.As(legacyErr, &noSuchKey) {
+			return nil, format, legacyErr
+		}
+	}
+	return nil, "", err
+}
+
+func (r *Result) addLegacyKey(resp Resp) {
+	if r.legacyKeys == nil {
+		r.legacyKeys = make(map[string]int)
+	}
+	if resp.err == nil {
+		r.legacyKeys[resp.keyFormat]++
+	}
+}
+
+func (r Result) legacyKeyReport() string {
+	formats := make([]string, 0, len(r.legacyKeys))
+	for format := range r.legacyKeys {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	report := fmt.Sprintf("%s keys found under a legacy format:\n", r.operation)
+	for _, format := range formats {
+		report += fmt.Sprintf("%-24s %8d\n", format, r.legacyKeys[format])
+	}
+	return report
+}
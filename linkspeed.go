@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Utilization of the client link above which it, rather than the server, is
+// likely to have limited throughput
+const linkSaturation = 0.9
+
+// Bandwidth of the client's network link in bits per second
+type LinkSpeed float64
+
+// Parses link speeds such as 25Gb, 10Gbps or 100Mbit, units are powers of
+// 1000 bits as is usual for network links
+func parseLinkSpeed(spec string) (LinkSpeed, error) {
+	number := strings.TrimRightFunc(spec, unicode.IsLetter)
+	unit := strings.ToLower(spec[len(number):])
+	for _, suffix := range []string{"bps", "bit", "b"} {
+		if strings.HasSuffix(unit, suffix) {
+			unit = strings.TrimSuffix(unit, suffix)
+			break
+		}
+	}
+	multipliers := map[string]float64{"": 1, "k": 1e3, "m": 1e6, "g": 1e9, "t": 1e12}
+	multiplier, ok := multipliers[unit]
+	value, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || !ok || value <= 0 {
+		return 0, fmt.Errorf("invalid link speed %q, expected e.g. 10Gb or 100Mb", spec)
+	}
+	return LinkSpeed(value * multiplier), nil
+}
+
+func (s LinkSpeed) String() string {
+	units := []string{"b/s", "Kb/s", "Mb/s", "Gb/s", "Tb/s"}
+	value := float64(s)
+	unit := 0
+	for value >= 1000 && unit < len(units)-1 {
+		value /= 1000
+		unit++
+	}
+	return fmt.Sprintf("%g %s", value, units[unit])
+}
+
+// Returns the fraction of the link used to transfer the given bytes
+func (s LinkSpeed) utilization(bytes int64, seconds float64) float64 {
+	if seconds <= 0 {
+		return 0
+	}
+	return float64(bytes) * 8 / seconds / float64(s)
+}
+
+func linkUtilizationReport(results []Result, speed LinkSpeed) string {
+	report := fmt.Sprintf("Link utilization of %s:\n", speed)
+	var totalBytes int64
+	var totalSeconds float64
+	saturated := false
+	line := func(name string, bytes int64, seconds float64) {
+		utilization := speed.utilization(bytes, seconds)
+		note := ""
+		if utilization >= linkSaturation {
+			note = "  client link saturated"
+			saturated = true
+		}
+		report += fmt.Sprintf("%-10s %10.2f MB/s %7.1f%%%s\n", name,
+			(float64(bytes)/(1024*1024))/seconds, 100*utilization, note)
+	}
+	for _, r := range results {
+		if r.operation == opCopy {
+			// Copied bytes never cross the client link
+			continue
+		}
+		line(r.operation, r.bytesTransmitted, r.totalDuration.Seconds())
+		totalBytes += r.bytesTransmitted
+		totalSeconds += r.totalDuration.Seconds()
+	}
+	if len(results) > 1 {
+		line("all tests", totalBytes, totalSeconds)
+	}
+	if saturated {
+		report += fmt.Sprintf("Throughput above %0.0f%% of the link is limited by the client's network,\n"+
+			"add client hosts to measure the server\n", 100*linkSaturation)
+	}
+	return report
+}
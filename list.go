@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Specifies the listings of the list test
+type ListParams struct {
+	maxKeys    int32
+	delimiter  string
+	startAfter string
+	// Number of full listings of the prefix
+	repeat int
+}
+
+func (l *ListParams) firstPage(bucket, prefix string) *s3.ListObjectsV2Input {
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(l.maxKeys),
+	}
+	if l.delimiter != "" {
+		input.Delimiter = aws.String(l.delimiter)
+	}
+	if l.startAfter != "" {
+		input.StartAfter = aws.String(l.startAfter)
+	}
+	return input
+}
+
+// Lists objectNamePrefix in full repeat times, up to numClients listings at a
+// time, each paging through the prefix one page after the other. Pages are
+// the operations of the result. A listing whose page fails is abandoned.
+func (params *Params) RunList() Result {
+	l := params.list
+	result := Result{operation: opList}
+	startTime := time.Now()
+
+	var pending []Req
+	started, inFlight := 0, 0
+	for started < l.repeat && started < int(params.numClients) {
+		pending = append(pending, l.firstPage(params.bucketName, params.objectNamePrefix))
+		started++
+	}
+	for len(pending) > 0 || inFlight > 0 {
+		// Only offer a request to the clients when one is pending
+		var requests chan Req
+		var next Req
+		if len(pending) > 0 {
+			requests = params.requests
+			next = pending[0]
+		}
+
+		select {
+		case requests <- next:
+			pending = pending[1:]
+			inFlight++
+			continue
+		case resp := <-params.responses:
+			inFlight--
+			params.logRequest(resp)
+			params.clockOffset.Add(resp)
+			result.addToTimeline(resp, time.Since(startTime))
+			if resp.err != nil {
+				result.numErrors++
+				if params.verbose {
+					fmt.Printf("Failed to list a page of %s (%v)\n", params.objectNamePrefix, resp.err)
+				}
+			} else {
+				result.opDurations.Record(resp.duration.Seconds())
+				page := resp.output.(*s3.ListObjectsV2Output)
+				result.numListed += len(page.Contents) + len(page.CommonPrefixes)
+				if aws.ToBool(page.IsTruncated) {
+					nextPage := *resp.request.(*s3.ListObjectsV2Input)
+					nextPage.ContinuationToken = page.NextContinuationToken
+					pending = append(pending, &nextPage)
+					continue
+				}
+				result.numListings++
+			}
+			if started < l.repeat {
+				pending = append(pending, l.firstPage(params.bucketName, params.objectNamePrefix))
+				started++
+			}
+		}
+	}
+	result.totalDuration = time.Since(startTime)
+	return result
+}
+
+func (r Result) listReport() string {
+	seconds := r.totalDuration.Seconds()
+	report := fmt.Sprintf("Listings:          %d\n", r.numListings)
+	report += fmt.Sprintf("Pages:             %d (%0.1f pages/s)\n", r.opDurations.Count(), float64(r.opDurations.Count())/seconds)
+	report += fmt.Sprintf("Keys Listed:       %d (%0.0f keys/s)\n", r.numListed, float64(r.numListed)/seconds)
+	return report
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Interval at which the live view is redrawn
+const liveRefresh = time.Second
+
+// Redraws a block of lines in place on an ANSI terminal
+type LiveView struct {
+	out   io.Writer
+	lines int
+}
+
+func NewLiveView(out io.Writer) *LiveView {
+	return &LiveView{out: out}
+}
+
+// Replaces the lines drawn last with the given ones
+func (v *LiveView) Draw(lines []string) {
+	var b strings.Builder
+	if v.lines > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", v.lines)
+	}
+	for _, line := range lines {
+		fmt.Fprintf(&b, "\x1b[2K%s\n", line)
+	}
+	// Clear whatever remains of a longer previous view
+	for i := len(lines); i < v.lines; i++ {
+		b.WriteString("\x1b[2K\n")
+	}
+	if v.lines > len(lines) {
+		fmt.Fprintf(&b, "\x1b[%dA", v.lines-len(lines))
+	}
+	v.lines = len(lines)
+	io.WriteString(v.out, b.String())
+}
+
+// The live view of a test which completed the given operations so far
+func (params *Params) liveLines(op string, startTime time.Time, completed int, result *Result, window *LatencyWindow) []string {
+	now := time.Now()
+	elapsed := now.Sub(startTime)
+	overall := (float64(result.bytesTransmitted) / (1024 * 1024)) / elapsed.Seconds()
+	throughput, errorRate := window.rates(now)
+
+	var progress, eta string
+	if params.duration > 0 {
+		progress = fmt.Sprintf("%d ops (%0.1f%% of %s)", completed, 100*elapsed.Seconds()/params.duration.Seconds(), params.duration)
+		eta = (params.duration - elapsed).Round(time.Second).String()
+	} else {
+		progress = fmt.Sprintf("%d/%d (%0.1f%%)", completed, params.numSamples, 100*float64(completed)/float64(params.numSamples))
+		eta = estimateETA(params.numSamples-completed, float64(completed)/elapsed.Seconds())
+	}
+	latency := fmt.Sprintf("no completions in last %s", window.window)
+	if sorted := window.durations(now); len(sorted) > 0 {
+		latency = fmt.Sprintf("p50 %0.3f s  p99 %0.3f s  last %s", percentile(sorted, 50), percentile(sorted, 99), window.window)
+	}
+
+	return []string{
+		fmt.Sprintf("%s test - %s elapsed - ETA %s", op, elapsed.Round(time.Second), eta),
+		fmt.Sprintf("Completed:   %s", progress),
+		fmt.Sprintf("In flight:   %d", atomic.LoadInt64(&params.inFlight)),
+		fmt.Sprintf("Throughput:  %0.2f MB/s last %s, %0.2f MB/s overall", throughput, window.window, overall),
+		fmt.Sprintf("Latency:     %s", latency),
+		fmt.Sprintf("Errors:      %0.2f%% last %s, %d total", 100*errorRate, window.window, result.numErrors),
+	}
+}
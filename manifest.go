@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	manifestCSV       = "csv"
+	manifestInventory = "inventory"
+)
+
+// Records every object successfully written by the run, so that the data set
+// can be found again (and cleaned up) without relying on key names
+type Manifest struct {
+	file *os.File
+	csv  *csv.Writer
+	// With the inventory format, rows are written as S3 Inventory writes
+	// them and the bucket and encryption are those of every object
+	inventory  *bufio.Writer
+	bucket     string
+	encryption string
+}
+
+var manifestHeader = []string{"key", "size", "etag", "version_id"}
+
+// The fields of the S3 Inventory CSV files written by the inventory format,
+// which have no header
+var inventorySchema = []string{"Bucket", "Key", "VersionId", "IsLatest", "IsDeleteMarker", "Size",
+	"LastModifiedDate", "ETag", "StorageClass", "IsMultipartUploaded", "EncryptionStatus"}
+
+// Creates a manifest of the given format, the bucket and encryption status
+// being recorded by the inventory format
+func CreateManifest(path, format, bucket, encryption string) (*Manifest, error) {
+	if format != manifestCSV && format != manifestInventory {
+		return nil, fmt.Errorf("invalid manifestFormat %q, expected %s or %s", format, manifestCSV, manifestInventory)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{file: file}
+	if format == manifestInventory {
+		m.inventory, m.bucket, m.encryption = bufio.NewWriter(file), bucket, encryption
+		return m, nil
+	}
+	m.csv = csv.NewWriter(file)
+	m.csv.Write(manifestHeader)
+	return m, nil
+}
+
+func (m *Manifest) Add(entry ManifestEntry) {
+	if m.inventory == nil {
+		m.csv.Write([]string{entry.key, strconv.FormatInt(entry.size, 10), entry.etag, entry.versionID})
+		return
+	}
+	// Inventory reports URL-encode keys and quote every field
+	fields := []string{m.bucket, url.QueryEscape(entry.key), entry.versionID, "true", "false",
+		strconv.FormatInt(entry.size, 10), entry.lastModified.UTC().Format("2006-01-02T15:04:05.000Z"),
+		entry.etag, "STANDARD", strconv.FormatBool(entry.multipart), m.encryption}
+	for i, field := range fields {
+		fields[i] = `"` + strings.ReplaceAll(field, `"`, `""`) + `"`
+	}
+	m.inventory.WriteString(strings.Join(fields, ",") + "\n")
+}
+
+func (m *Manifest) Close() error {
+	var err error
+	if m.inventory != nil {
+		err = m.inventory.Flush()
+	} else {
+		m.csv.Flush()
+		err = m.csv.Error()
+	}
+	if cerr := m.file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && m.inventory != nil {
+		err = m.writeInventoryManifest()
+	}
+	return err
+}
+
+// The manifest.json of an inventory report
+type inventoryManifest struct {
+	SourceBucket      string          `json:"sourceBucket"`
+	Version           string          `json:"version"`
+	CreationTimestamp string          `json:"creationTimestamp"`
+	FileFormat        string          `json:"fileFormat"`
+	FileSchema        string          `json:"fileSchema"`
+	Files             []inventoryFile `json:"files"`
+}
+
+type inventoryFile struct {
+	Key         string `json:"key"`
+	Size        int64  `json:"size"`
+	MD5checksum string `json:"MD5checksum"`
+}
+
+// Writes the manifest.json describing an inventory report beside the
+// inventory file, named after it, eg: inventory.manifest.json for
+// inventory.csv
+func (m *Manifest) writeInventoryManifest() error {
+	path := m.file.Name()
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	sum := md5.New()
+	size, err := io.Copy(sum, file)
+	if err != nil {
+		return err
+	}
+	manifest := inventoryManifest{
+		SourceBucket:      m.bucket,
+		Version:           "2016-11-30",
+		CreationTimestamp: strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10),
+		FileFormat:        "CSV",
+		FileSchema:        strings.Join(inventorySchema, ", "),
+		Files:             []inventoryFile{{Key: filepath.Base(path), Size: size, MD5checksum: hex.EncodeToString(sum.Sum(nil))}},
+	}
+	body, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(strings.TrimSuffix(path, filepath.Ext(path))+".manifest.json", append(body, '\n'), 0644)
+}
+
+// An object recorded in a manifest
+type ManifestEntry struct {
+	key       string
+	size      int64
+	etag      string
+	versionID string
+	// Only recorded by the inventory format
+	lastModified time.Time
+	multipart    bool
+}
+
+// Reads a manifest written by CreateManifest, in either format
+func LoadManifest(path string) ([]ManifestEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) > 0 && len(rows[0]) == len(inventorySchema) {
+		return loadInventory(path, rows)
+	}
+	if len(rows) < 2 {
+		return nil, fmt.Errorf("%s: manifest is empty", path)
+	}
+	entries := make([]ManifestEntry, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		if len(row) != len(manifestHeader) {
+			return nil, fmt.Errorf("%s:%d: expected %d fields", path, i+2, len(manifestHeader))
+		}
+		size, err := strconv.ParseInt(row[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid size %q", path, i+2, row[1])
+		}
+		entries = append(entries, ManifestEntry{key: row[0], size: size, etag: row[2], versionID: row[3]})
+	}
+	return entries, nil
+}
+
+// Reads the rows of an inventory file of inventorySchema, skipping delete
+// markers
+func loadInventory(path string, rows [][]string) ([]ManifestEntry, error) {
+	entries := make([]ManifestEntry, 0, len(rows))
+	for i, row := range rows {
+		if len(row) != len(inventorySchema) {
+			return nil, fmt.Errorf("%s:%d: expected %d fields", path, i+1, len(inventorySchema))
+		}
+		if row[4] == "true" {
+			continue
+		}
+		key, err := url.QueryUnescape(row[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid key %q", path, i+1, row[1])
+		}
+		size, err := strconv.ParseInt(row[5], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid size %q", path, i+1, row[5])
+		}
+		entries = append(entries, ManifestEntry{key: key, size: size, etag: row[7], versionID: row[2]})
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: inventory is empty", path)
+	}
+	return entries, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadManifest(t *testing.T) {
+	dir := t.TempDir()
+	inventoryRow := func(key, version, deleteMarker, size string) string {
+		return `"bucket","` + key + `","` + version + `","true","` + deleteMarker + `","` + size +
+			`","2024-06-01T12:00:00.000Z","0123abcd","STANDARD","false","SSE-S3"` + "\n"
+	}
+	tests := []struct {
+		name    string
+		content string
+		entries []ManifestEntry
+		// Part of the expected error
+		err string
+	}{
+		{"csv", "key,size,etag,version_id\na/1,1024,0123abcd,v1\na/2,0,,\n",
+			[]ManifestEntry{{key: "a/1", size: 1024, etag: "0123abcd", versionID: "v1"}, {key: "a/2"}}, ""},
+		{"csv quoted key", "key,size,etag,version_id\n\"a,b\",5,,\n",
+			[]ManifestEntry{{key: "a,b", size: 5}}, ""},
+		{"csv header only", "key,size,etag,version_id\n", nil, "manifest is empty"},
+		{"empty", "", nil, "manifest is empty"},
+		{"csv invalid size", "key,size,etag,version_id\na/1,big,,\n", nil, `:2: invalid size "big"`},
+		{"csv missing fields", "key,size\na/1,5\n", nil, ":2: expected 4 fields"},
+		{"csv ragged rows", "key,size,etag,version_id\na/1,5\n", nil, "wrong number of fields"},
+		{"inventory", inventoryRow("a%2F1", "v1", "false", "1024") + inventoryRow("a%2F2+b", "", "false", "7"),
+			[]ManifestEntry{{key: "a/1", size: 1024, etag: "0123abcd", versionID: "v1"}, {key: "a/2 b", size: 7, etag: "0123abcd"}}, ""},
+		{"inventory delete markers", inventoryRow("a%2F1", "v2", "true", "0") + inventoryRow("a%2F1", "v1", "false", "3"),
+			[]ManifestEntry{{key: "a/1", size: 3, etag: "0123abcd", versionID: "v1"}}, ""},
+		{"inventory only delete markers", inventoryRow("a%2F1", "v2", "true", "0"), nil, "inventory is empty"},
+		{"inventory invalid key", inventoryRow("a%ZZ", "", "false", "3"), nil, `:1: invalid key "a%ZZ"`},
+		{"inventory invalid size", inventoryRow("a", "", "false", "-"), nil, `:1: invalid size "-"`},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, "manifest.csv")
+		if err := os.WriteFile(path, []byte(test.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := LoadManifest(path)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: error %v, expected one containing %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(entries, test.entries) {
+			t.Errorf("%s: entries %+v, expected %+v", test.name, entries, test.entries)
+		}
+	}
+}
+
+// Manifests written in either format read back as the entries written
+func TestManifestRoundTrip(t *testing.T) {
+	written := []ManifestEntry{
+		{key: "run/1", size: 4096, etag: "0123abcd", versionID: "v1", lastModified: time.Now()},
+		{key: "run/ключ 2+%", size: 0, etag: "4567ef01"},
+	}
+	for _, format := range []string{manifestCSV, manifestInventory} {
+		path := filepath.Join(t.TempDir(), "manifest.csv")
+		m, err := CreateManifest(path, format, "bucket", "SSE-S3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range written {
+			m.Add(entry)
+		}
+		if err := m.Close(); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		entries, err := LoadManifest(path)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		for i := range written {
+			want := written[i]
+			want.lastModified = time.Time{}
+			if i >= len(entries) || entries[i] != want {
+				t.Errorf("%s: entries %+v, expected %+v", format, entries, written)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Characters of the generated metadata values, safe in HTTP headers
+const metadataAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// User metadata attached to every object written and checked by the reads.
+// Values are derived from the object's name, so that runs reading objects
+// written by an earlier run with the same flags can check them too.
+type UserMetadata struct {
+	count     int
+	valueSize int
+}
+
+func NewUserMetadata(count int, valueSize int64) (*UserMetadata, error) {
+	if count < 0 || valueSize < 1 {
+		return nil, fmt.Errorf("numMetadata can not be negative and metadataValueSize needs to be at least 1")
+	}
+	return &UserMetadata{count: count, valueSize: int(valueSize)}, nil
+}
+
+func (m *UserMetadata) String() string {
+	return fmt.Sprintf("%d entries of %d bytes", m.count, m.valueSize)
+}
+
+// Names are lowercase, as servers and the SDK return them
+func metadataName(n int) string {
+	return fmt.Sprintf("s3bench-meta-%d", n)
+}
+
+func (m *UserMetadata) value(key string, n int) string {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	r := NewRandomReader(h.Sum64()+uint64(n), 0, 0)
+	value := make([]byte, m.valueSize)
+	for i := range value {
+		value[i] = metadataAlphabet[r.byteAt(int64(i))%byte(len(metadataAlphabet))]
+	}
+	return string(value)
+}
+
+// Adds the metadata of the object to that already set on the input, such
+// as the searched attribute
+func (m *UserMetadata) apply(input *s3.PutObjectInput) {
+	m.applyAs(input, *input.Key)
+}
+
+// Adds the metadata of the object named key, for a write under another name
+// such as the staging write of a commit, whose copy keeps the metadata
+func (m *UserMetadata) applyAs(input *s3.PutObjectInput, key string) {
+	if input.Metadata == nil {
+		input.Metadata = make(map[string]string, m.count)
+	}
+	for n := 0; n < m.count; n++ {
+		input.Metadata[metadataName(n)] = m.value(key, n)
+	}
+}
+
+// Checks the metadata returned by a HEAD or GET of the object, other entries
+// being ignored
+func (m *UserMetadata) check(key string, metadata map[string]string) error {
+	for n := 0; n < m.count; n++ {
+		name := metadataName(n)
+		got, ok := metadata[name]
+		if !ok {
+			return fmt.Errorf("metadata %s missing, %d of %d entries returned", name, len(metadata), m.count)
+		}
+		if got != m.value(key, n) {
+			return fmt.Errorf("metadata %s altered, %d bytes returned instead of %d", name, len(got), m.valueSize)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Uploads the object in parts of multipartSize, up to multipartConcurrency
+// parts at a time, returning the duration of every part uploaded
+// successfully. The responses to the requests creating and completing the
+// upload are kept in capture. A failed upload is aborted so that its parts do
+// not linger in the bucket.
+func (params *Params) uploadMultipart(ctx context.Context, svc *s3.Client, input *s3.PutObjectInput, capture *responseCapture, traceID, spanID string) (*s3.PutObjectOutput, []float64, error) {
+	created, err := svc.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               input.Bucket,
+		Key:                  input.Key,
+		ContentType:          input.ContentType,
+		CacheControl:         input.CacheControl,
+		ContentDisposition:   input.ContentDisposition,
+		Tagging:              input.Tagging,
+		Metadata:             input.Metadata,
+		ServerSideEncryption: input.ServerSideEncryption,
+		SSEKMSKeyId:          input.SSEKMSKeyId,
+		SSECustomerAlgorithm: input.SSECustomerAlgorithm,
+		SSECustomerKey:       input.SSECustomerKey,
+		SSECustomerKeyMD5:    input.SSECustomerKeyMD5,
+		ChecksumAlgorithm:    params.checksumAlgorithm(),
+	}, requestOptions(traceID, spanID, capture, false)...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	var partDurations []float64
+	size := aws.ToInt64(input.ContentLength)
+	parts := make([]types.CompletedPart, 0, (size+params.multipartSize-1)/params.multipartSize)
+	slots := make(chan struct{}, params.multipartConcurrency)
+	for offset, partNumber := int64(0), int32(1); offset < size; offset, partNumber = offset+params.multipartSize, partNumber+1 {
+		end := offset + params.multipartSize
+		if end > size {
+			end = size
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(partNumber int32, body io.ReadSeeker) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			partStartTime := time.Now()
+			// Parts are sent concurrently, so their responses are not
+			// captured
+			part := &s3.UploadPartInput{
+				Bucket:               input.Bucket,
+				Key:                  input.Key,
+				UploadId:             created.UploadId,
+				PartNumber:           aws.Int32(partNumber),
+				Body:                 body,
+				SSECustomerAlgorithm: input.SSECustomerAlgorithm,
+				SSECustomerKey:       input.SSECustomerKey,
+				SSECustomerKeyMD5:    input.SSECustomerKeyMD5,
+				ChecksumAlgorithm:    params.checksumAlgorithm(),
+			}
+			if params.checksum == checksumMD5 {
+				part.ContentMD5 = contentMD5(body)
+			}
+			optFns, err := params.writeOptions(traceID, spanID, nil, body)
+			var output *s3.UploadPartOutput
+			if err == nil {
+				output, err = svc.UploadPart(ctx, part, optFns...)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("part %d: %v", partNumber, err)
+				}
+				return
+			}
+			partDurations = append(partDurations, time.Since(partStartTime).Seconds())
+			// Uploads created with a checksum algorithm are completed with
+			// the checksums of their parts
+			parts = append(parts, types.CompletedPart{
+				ETag:           output.ETag,
+				PartNumber:     aws.Int32(partNumber),
+				ChecksumCRC32C: output.ChecksumCRC32C,
+				ChecksumSHA256: output.ChecksumSHA256,
+			})
+		}(partNumber, params.objectData(*input.Key, offset, end-offset))
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		svc.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   input.Bucket,
+			Key:      input.Key,
+			UploadId: created.UploadId,
+		})
+		return nil, partDurations, firstErr
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return *parts[i].PartNumber < *parts[j].PartNumber })
+	completed, err := svc.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          input.Bucket,
+		Key:             input.Key,
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	}, requestOptions(traceID, spanID, capture, false)...)
+	if err != nil {
+		return nil, partDurations, err
+	}
+	return &s3.PutObjectOutput{ETag: completed.ETag, VersionId: completed.VersionId}, partDurations, nil
+}
+
+func (r Result) partReport() string {
+	report := fmt.Sprintf("Parts Uploaded:    %d\n", r.partDurations.Count())
+	report += fmt.Sprintf("Part times Max:       %0.3f s\n", r.partDurations.Percentile(100))
+	report += fmt.Sprintf("Part times 99th %%ile: %0.3f s\n", r.partDurations.Percentile(99))
+	report += fmt.Sprintf("Part times 90th %%ile: %0.3f s\n", r.partDurations.Percentile(90))
+	report += fmt.Sprintf("Part times 50th %%ile: %0.3f s\n", r.partDurations.Percentile(50))
+	report += fmt.Sprintf("Part times Min:       %0.3f s\n", r.partDurations.Percentile(0))
+	return report
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Everything reported at the end of a run
+type Report struct {
+	time    time.Time
+	params  *Params
+	results []Result
+	totals  *RunTotals
+	// Additional reports, such as the clock offset, only printed to the
+	// console
+	sections []string
+}
+
+// A destination for the report of a run, several can be used at once
+type OutputSink interface {
+	Write(report *Report) error
+	Close() error
+}
+
+// Collects the repeated -output flags
+type outputSpecs []string
+
+func (o *outputSpecs) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *outputSpecs) Set(spec string) error {
+	*o = append(*o, spec)
+	return nil
+}
+
+// Opens the sink described by "kind" or "kind:target", e.g. json:results.json
+func OpenOutputSink(spec string) (OutputSink, error) {
+	kind, target := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, target = spec[:i], spec[i+1:]
+	}
+	if kind != "console" && target == "" {
+		return nil, fmt.Errorf("output %q needs a target, e.g. %s:results", spec, kind)
+	}
+	switch kind {
+	case "console":
+		return consoleSink{}, nil
+	case "json":
+		return &jsonSink{path: target}, nil
+	case "csv":
+		return &csvSink{path: target}, nil
+	case "prometheus":
+		return &prometheusSink{path: target}, nil
+	case "influxdb":
+		return &influxSink{url: target, token: os.Getenv("INFLUXDB_TOKEN")}, nil
+	case "sqlite":
+		return openSQLiteSink(target)
+	}
+	return nil, fmt.Errorf("unknown output %q, expected console, json, csv, prometheus, influxdb or sqlite", kind)
+}
+
+// The headline numbers of a result, as exported by the machine readable sinks
+type ResultSummary struct {
+	Operation       string             `json:"operation"`
+	Operations      int                `json:"operations"`
+	Errors          int                `json:"errors"`
+	Bytes           int64              `json:"bytes"`
+	DurationSeconds float64            `json:"durationSeconds"`
+	ThroughputMBps  float64            `json:"throughputMBps"`
+	Aborted         string             `json:"aborted,omitempty"`
+	Latency         map[string]float64 `json:"latencySeconds,omitempty"`
+	// Pause before the test for the server to settle
+	StageDelaySeconds float64 `json:"stageDelaySeconds,omitempty"`
+	// Attempts repeated by the SDK, whose time is part of the latency
+	Retries int `json:"retries,omitempty"`
+	// Only for the delete test, a DeleteObjects request deleting many
+	ObjectsDeleted int `json:"objectsDeleted,omitempty"`
+	// Only for the list test, whose operations are pages
+	KeysListed int `json:"keysListed,omitempty"`
+	// Only when requests were spread over several endpoints
+	Endpoints map[string]ResultSummary `json:"endpoints,omitempty"`
+	// Only with an endpoint map, keyed by route
+	Shards map[string]ResultSummary `json:"shards,omitempty"`
+	// Only with perClientStats
+	Clients []ClientSummary `json:"clients,omitempty"`
+	// Buckets of timelineInterval over the course of the test
+	Timeline []TimelineBucket `json:"timeline,omitempty"`
+	// Only when the responses reported a CDN cache status
+	Cache *CacheSummary `json:"cache,omitempty"`
+	// Only with repair, objects which failed verification written again
+	Repaired     int `json:"repaired,omitempty"`
+	Unrepairable int `json:"unrepairable,omitempty"`
+	// Only for ranged reads the server did not honour, by violation
+	RangeViolations map[string]int `json:"rangeViolations,omitempty"`
+	// Queuing within s3bench itself
+	Pipeline *PipelineSummary `json:"pipeline,omitempty"`
+	// Only for reads with a checksum mode, by whether it was verified
+	Checksums map[string]int `json:"checksums,omitempty"`
+	// Only with verifyETag
+	ETagsChecked   int `json:"etagsChecked,omitempty"`
+	ETagMismatches int `json:"etagMismatches,omitempty"`
+	// Only with checkETagFormat, writes by how their ETag relates to their data
+	ETagFormats map[string]int `json:"etagFormats,omitempty"`
+	// Only with captureHeaders, the first and last requests of the stage
+	Headers []HeadersSummary `json:"headers,omitempty"`
+}
+
+// Returns the captured headers as JSON, for the sinks writing a column per
+// field, empty when headers were not captured
+func (s ResultSummary) headersJSON() string {
+	if len(s.Headers) == 0 {
+		return ""
+	}
+	body, err := json.Marshal(s.Headers)
+	if err != nil {
+		return ""
+	}
+	return string(body)
+}
+
+// The operation time percentiles exported, in column order
+var summaryPercentiles = []struct {
+	name       string
+	percentile float64
+}{{"min", 0}, {"p25", 25}, {"p50", 50}, {"p75", 75}, {"p90", 90}, {"p99", 99}, {"max", 100}}
+
+func (r Result) Summary() ResultSummary {
+	summary := ResultSummary{
+		Operation:       r.operation,
+		Operations:      r.opDurations.Count() + r.numErrors,
+		Errors:          r.numErrors,
+		Bytes:           r.bytesTransmitted,
+		DurationSeconds: r.totalDuration.Seconds(),
+		ThroughputMBps:  (float64(r.bytesTransmitted) / (1024 * 1024)) / r.totalDuration.Seconds(),
+		Aborted:         r.aborted,
+	}
+	summary.StageDelaySeconds = r.stageDelay.Seconds()
+	summary.Retries = r.numRetries
+	summary.ObjectsDeleted = r.numDeleted
+	summary.KeysListed = r.numListed
+	if r.opDurations.Count() > 0 {
+		summary.Latency = make(map[string]float64)
+		for _, p := range summaryPercentiles {
+			summary.Latency[p.name] = r.percentile(p.percentile)
+		}
+	}
+	if len(r.endpoints) > 1 {
+		summary.Endpoints = r.endpointSummaries()
+	}
+	if len(r.shards) > 0 {
+		summary.Shards = r.shardSummaries()
+	}
+	if len(r.clients) > 0 {
+		summary.Clients = r.clientSummaries()
+	}
+	if r.cache != nil {
+		summary.Cache = r.cache.summary()
+	}
+	summary.Repaired, summary.Unrepairable = r.numRepaired, r.numUnrepairable
+	if r.timeSeries != nil {
+		summary.Timeline = r.timeSeries.buckets
+	}
+	summary.RangeViolations = r.rangeViolations
+	summary.Checksums = r.checksums
+	summary.ETagsChecked, summary.ETagMismatches = r.etagsChecked, r.etagMismatches
+	summary.ETagFormats = r.etagFormats
+	if r.headers != nil {
+		summary.Headers = r.headers.summary()
+	}
+	if r.pipeline != nil {
+		summary.Pipeline = r.pipelineSummary()
+	}
+	return summary
+}
+
+// A line printed to stdout as soon as a stage finishes, so that automation
+// can decide whether to let the run go on before it ends
+type StageRecord struct {
+	Type      string    `json:"type"`
+	Stage     int       `json:"stage"`
+	Time      time.Time `json:"time"`
+	RunID     string    `json:"runId,omitempty"`
+	ErrorRate float64   `json:"errorRate"`
+	ResultSummary
+}
+
+// Prints the result of a stage as a single JSON line when streamStages is
+// set. The timeline, per client breakdowns and captured headers are left to the
+// final report to keep lines short.
+func (params *Params) streamStage(r Result) {
+	if !params.streamStages {
+		return
+	}
+	record := StageRecord{Type: "stage", Stage: params.numStages, Time: time.Now().UTC(), RunID: params.runID}
+	record.ResultSummary = r.Summary()
+	record.Timeline, record.Clients, record.Headers = nil, nil, nil
+	if record.Operations > 0 {
+		record.ErrorRate = float64(record.Errors) / float64(record.Operations)
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		fmt.Printf("Could not stream the %s result: %v\n", r.operation, err)
+		return
+	}
+	fmt.Println(string(line))
+}
+
+// Prints the full human readable report
+type consoleSink struct{}
+
+func (consoleSink) Write(report *Report) error {
+	fmt.Println(report.params)
+	for _, result := range report.results {
+		fmt.Println()
+		fmt.Println(result)
+	}
+	for _, section := range report.sections {
+		fmt.Println()
+		fmt.Println(section)
+	}
+	if report.totals != nil {
+		fmt.Println()
+		fmt.Println(report.totals)
+	}
+	return nil
+}
+
+func (consoleSink) Close() error {
+	return nil
+}
+
+// Writes the parameters and result summaries as a single JSON document
+type jsonSink struct {
+	path string
+}
+
+func (s *jsonSink) Write(report *Report) error {
+	params := report.params
+	summaries := make([]ResultSummary, 0, len(report.results))
+	for _, result := range report.results {
+		summaries = append(summaries, result.Summary())
+	}
+	document := map[string]interface{}{
+		"timestamp":        report.time.UTC().Format(time.RFC3339),
+		"endpoints":        params.endpoints,
+		"bucket":           params.bucketName,
+		"objectNamePrefix": params.objectNamePrefix,
+		"objectSize":       params.objectSize,
+		"numClients":       params.numClients,
+		"numSamples":       params.numSamples,
+		"durationSeconds":  params.duration.Seconds(),
+		"results":          summaries,
+	}
+	if params.stageDelay > 0 {
+		document["stageDelaySeconds"] = params.stageDelay.Seconds()
+	}
+	if params.trafficClass != "" {
+		document["trafficClass"] = params.trafficClass
+	}
+	if report.totals != nil {
+		document["totals"] = report.totals
+	}
+	body, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path, append(body, '\n'), 0644)
+}
+
+func (s *jsonSink) Close() error {
+	return nil
+}
+
+// Appends one row per result, so that a file can accumulate many runs
+type csvSink struct {
+	path string
+}
+
+func (s *csvSink) Write(report *Report) error {
+	_, err := os.Stat(s.path)
+	isNew := os.IsNotExist(err)
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(file)
+	if isNew {
+		header := []string{"timestamp", "operation", "operations", "errors", "bytes", "duration", "throughput_mbps"}
+		for _, p := range summaryPercentiles {
+			header = append(header, p.name)
+		}
+		header = append(header, "headers")
+		w.Write(header)
+	}
+	for _, result := range report.results {
+		summary := result.Summary()
+		row := []string{
+			report.time.UTC().Format(time.RFC3339),
+			summary.Operation,
+			strconv.Itoa(summary.Operations),
+			strconv.Itoa(summary.Errors),
+			strconv.FormatInt(summary.Bytes, 10),
+			strconv.FormatFloat(summary.DurationSeconds, 'f', 3, 64),
+			strconv.FormatFloat(summary.ThroughputMBps, 'f', 3, 64),
+		}
+		for _, p := range summaryPercentiles {
+			row = append(row, strconv.FormatFloat(summary.Latency[p.name], 'f', 6, 64))
+		}
+		row = append(row, summary.headersJSON())
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (s *csvSink) Close() error {
+	return nil
+}
+
+// Writes gauges in the Prometheus text format, meant for the node_exporter
+// textfile collector. The file is replaced atomically so the collector never
+// reads a partial file.
+type prometheusSink struct {
+	path string
+}
+
+func (s *prometheusSink) Write(report *Report) error {
+	var buf bytes.Buffer
+	gauge := func(name, help string, value func(ResultSummary) float64) {
+		fmt.Fprintf(&buf, "# HELP s3bench_%s %s\n# TYPE s3bench_%s gauge\n", name, help, name)
+		for _, result := range report.results {
+			fmt.Fprintf(&buf, "s3bench_%s{operation=%q} %g\n", name, result.operation, value(result.Summary()))
+		}
+	}
+	gauge("operations", "Operations completed by the last run.", func(s ResultSummary) float64 { return float64(s.Operations) })
+	gauge("errors", "Operations which failed in the last run.", func(s ResultSummary) float64 { return float64(s.Errors) })
+	gauge("throughput_bytes_per_second", "Throughput of the last run.", func(s ResultSummary) float64 {
+		return s.ThroughputMBps * 1024 * 1024
+	})
+	gauge("duration_seconds", "Duration of the last run.", func(s ResultSummary) float64 { return s.DurationSeconds })
+	fmt.Fprintf(&buf, "# HELP s3bench_latency_seconds Operation time percentiles of the last run.\n# TYPE s3bench_latency_seconds gauge\n")
+	for _, result := range report.results {
+		summary := result.Summary()
+		for _, p := range summaryPercentiles {
+			if value, ok := summary.Latency[p.name]; ok {
+				fmt.Fprintf(&buf, "s3bench_latency_seconds{operation=%q,quantile=\"%g\"} %g\n", result.operation, p.percentile/100, value)
+			}
+		}
+	}
+	fmt.Fprintf(&buf, "# HELP s3bench_last_run_timestamp_seconds Time the last run finished.\n# TYPE s3bench_last_run_timestamp_seconds gauge\n")
+	fmt.Fprintf(&buf, "s3bench_last_run_timestamp_seconds %d\n", report.time.Unix())
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *prometheusSink) Close() error {
+	return nil
+}
+
+// Posts one point per result in the InfluxDB line protocol, the URL is the
+// full write endpoint, e.g. http://influx:8086/write?db=s3bench. InfluxDB 2
+// tokens are taken from INFLUXDB_TOKEN.
+type influxSink struct {
+	url   string
+	token string
+	// Extra tags formatted by formatInfluxTags
+	tags string
+}
+
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+func (s *influxSink) Write(report *Report) error {
+	var buf bytes.Buffer
+	for _, result := range report.results {
+		summary := result.Summary()
+		fmt.Fprintf(&buf, "s3bench,operation=%s,bucket=%s%s operations=%di,errors=%di,bytes=%di,duration=%g,throughput_mbps=%g",
+			influxTagEscaper.Replace(summary.Operation), influxTagEscaper.Replace(report.params.bucketName), s.tags,
+			summary.Operations, summary.Errors, summary.Bytes, summary.DurationSeconds, summary.ThroughputMBps)
+		for _, p := range summaryPercentiles {
+			if value, ok := summary.Latency[p.name]; ok {
+				fmt.Fprintf(&buf, ",latency_%s=%g", p.name, value)
+			}
+		}
+		fmt.Fprintf(&buf, " %d\n", report.time.UnixNano())
+	}
+	return postInfluxLines(s.url, s.token, buf.Bytes())
+}
+
+func (s *influxSink) Close() error {
+	return nil
+}
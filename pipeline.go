@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// Collector lag above this share of the median operation time is
+	// reported as queuing within s3bench
+	collectorLagShare = 0.1
+	// Collector lag below this is never reported
+	collectorLagFloor = time.Millisecond
+	// A request of a rate limited test waiting longer than this for a client
+	// found them all busy
+	dispatchWaitThreshold = time.Millisecond
+	// Share of the requests of a rate limited test which may find all
+	// clients busy before it is reported
+	dispatchDelayedShare = 0.01
+)
+
+// Measures the queuing s3bench itself adds around the requests of a test, so
+// that the report can tell whether the load offered and the latencies were
+// those of the server. Operation times end before responses are handed to
+// the collector, so collector lag holds back the load offered rather than
+// inflating latencies, while a rate limited test whose clients are all busy
+// sends requests late and omits the wait from their latencies.
+type PipelineStats struct {
+	// Time requests of a rate limited test waited for a free client,
+	// written by the goroutine submitting them
+	dispatchWait Histogram
+	numDelayed   int
+	rateLimited  bool
+	// Time between a client finishing a request and the collector taking
+	// its response
+	collectorLag Histogram
+}
+
+func (p *PipelineStats) addDispatch(wait time.Duration) {
+	if !p.rateLimited {
+		return
+	}
+	p.dispatchWait.Record(wait.Seconds())
+	if wait > dispatchWaitThreshold {
+		p.numDelayed++
+	}
+}
+
+func (p *PipelineStats) addResponse(resp Resp, received time.Time) {
+	if !resp.finished.IsZero() {
+		p.collectorLag.Record(received.Sub(resp.finished).Seconds())
+	}
+}
+
+// Whether clients waited on the collector for a significant time
+func (p *PipelineStats) collectorLagged(medianOpTime float64) bool {
+	if p.collectorLag.Count() == 0 {
+		return false
+	}
+	lag := p.collectorLag.Percentile(99)
+	return lag > collectorLagFloor.Seconds() && lag > collectorLagShare*medianOpTime
+}
+
+// Whether requests of a rate limited test often found all clients busy
+func (p *PipelineStats) dispatchDelayed() bool {
+	count := p.dispatchWait.Count()
+	return count > 0 && float64(p.numDelayed) > dispatchDelayedShare*float64(count)
+}
+
+func (r Result) pipelineReport() string {
+	p := r.pipeline
+	report := ""
+	if p.collectorLag.Count() > 0 {
+		report += fmt.Sprintf("Collector lag:     %0.3f ms p50, %0.3f ms p99, %0.3f ms max\n",
+			1e3*p.collectorLag.Percentile(50), 1e3*p.collectorLag.Percentile(99), 1e3*p.collectorLag.Percentile(100))
+	}
+	if p.dispatchWait.Count() > 0 {
+		report += fmt.Sprintf("Dispatch wait:     %0.3f ms p99, %d requests found all clients busy\n",
+			1e3*p.dispatchWait.Percentile(99), p.numDelayed)
+	}
+	median := 0.0
+	if r.opDurations.Count() > 0 {
+		median = r.percentile(50)
+	}
+	lagged, delayed := p.collectorLagged(median), p.dispatchDelayed()
+	if lagged {
+		report += "Clients waited on s3bench to collect responses, the load offered was lower than\n" +
+			"numClients would send, latencies are unaffected\n"
+	}
+	if delayed {
+		report += "Requests were sent late as all clients were busy, latencies omit the wait,\n" +
+			"raise numClients to sustain rateLimit\n"
+	}
+	if !lagged && !delayed {
+		report += "No queuing within s3bench, latencies and load reflect the server\n"
+	}
+	return report
+}
+
+// Queuing within s3bench, as exported by the machine readable sinks
+type PipelineSummary struct {
+	CollectorLagP99Seconds float64 `json:"collectorLagP99Seconds"`
+	DispatchWaitP99Seconds float64 `json:"dispatchWaitP99Seconds,omitempty"`
+	DelayedRequests        int     `json:"delayedRequests,omitempty"`
+	// Whether s3bench held back the load or delayed requests
+	Queued bool `json:"queued"`
+}
+
+func (r Result) pipelineSummary() *PipelineSummary {
+	p := r.pipeline
+	summary := &PipelineSummary{DelayedRequests: p.numDelayed}
+	if p.collectorLag.Count() > 0 {
+		summary.CollectorLagP99Seconds = p.collectorLag.Percentile(99)
+	}
+	if p.dispatchWait.Count() > 0 {
+		summary.DispatchWaitP99Seconds = p.dispatchWait.Percentile(99)
+	}
+	median := 0.0
+	if r.opDurations.Count() > 0 {
+		median = r.percentile(50)
+	}
+	summary.Queued = p.collectorLagged(median) || p.dispatchDelayed()
+	return summary
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// Measures the cost of evaluating bucket policies: the objects are read as
+// the benchmark's principal and as a principal expected to be denied, under
+// bucket policies of more and more statements. The statements added deny
+// every principal access to prefixes the test never touches, so that they
+// only add to the evaluation. Statements of the bucket's own policy are kept,
+// and the policy is restored afterwards.
+type PolicyBench struct {
+	statements []int
+	denied     *s3.Client
+}
+
+// Parses a comma separated list of numbers of statements, eg: 0,10,100
+func ParsePolicyStatements(spec string) ([]int, error) {
+	var statements []int
+	for _, field := range strings.Split(spec, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid policyStatements %q, expected numbers of statements such as 0,10,100", spec)
+		}
+		statements = append(statements, n)
+	}
+	return statements, nil
+}
+
+// The reads made under a policy of a number of statements
+type PolicyLevel struct {
+	statements int
+	allowed    Histogram
+	denied     Histogram
+	numErrors  int
+	// Reads of the denied principal which succeeded
+	numLeaked int
+	err       error
+}
+
+// The outcome of the policy benchmark
+type PolicyReport struct {
+	levels []PolicyLevel
+	// Set when the original policy could not be restored
+	restoreErr error
+}
+
+// Returns the bucket policy with n filler statements appended to those of
+// the original policy, if any
+func (params *Params) policyWithFillers(original string, n int) (string, error) {
+	policy := map[string]interface{}{"Version": "2012-10-17"}
+	var statements []interface{}
+	if original != "" {
+		if err := json.Unmarshal([]byte(original), &policy); err != nil {
+			return "", fmt.Errorf("could not parse the bucket policy: %v", err)
+		}
+		switch s := policy["Statement"].(type) {
+		case []interface{}:
+			statements = s
+		case map[string]interface{}:
+			statements = []interface{}{s}
+		}
+	}
+	for i := 0; i < n; i++ {
+		statements = append(statements, map[string]interface{}{
+			"Sid":       fmt.Sprintf("s3benchFiller%d", i),
+			"Effect":    "Deny",
+			"Principal": "*",
+			"Action":    "s3:GetObject",
+			"Resource":  fmt.Sprintf("arn:aws:s3:::%s/s3bench-policy-filler/%d/*", params.bucketName, i),
+		})
+	}
+	policy["Statement"] = statements
+	body, err := json.Marshal(policy)
+	return string(body), err
+}
+
+// Applies a policy, deleting the bucket's policy when it is empty
+func (params *Params) putPolicy(svc *s3.Client, policy string) error {
+	ctx := context.Background()
+	if policy == "" {
+		_, err := svc.DeleteBucketPolicy(ctx, &s3.DeleteBucketPolicyInput{Bucket: aws.String(params.bucketName)})
+		return err
+	}
+	_, err := svc.PutBucketPolicy(ctx, &s3.PutBucketPolicyInput{Bucket: aws.String(params.bucketName), Policy: aws.String(policy)})
+	return err
+}
+
+// Runs the policy benchmark over the first numSamples objects
+func (params *Params) RunPolicyBench(svc *s3.Client, bench *PolicyBench) PolicyReport {
+	var report PolicyReport
+	ctx := context.Background()
+	original := ""
+	current, err := svc.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(params.bucketName)})
+	var apiErr smithy.APIError
+	if err == nil {
+		original = aws.ToString(current.Policy)
+	} else if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "NoSuchBucketPolicy" {
+		report.levels = append(report.levels, PolicyLevel{err: fmt.Errorf("could not get the bucket policy: %v", err)})
+		return report
+	}
+
+	for _, n := range bench.statements {
+		level := PolicyLevel{statements: n}
+		policy, err := original, error(nil)
+		if n > 0 {
+			policy, err = params.policyWithFillers(original, n)
+		}
+		if err == nil {
+			err = params.putPolicy(svc, policy)
+		}
+		if err != nil {
+			level.err = err
+			report.levels = append(report.levels, level)
+			fmt.Printf("Could not apply a policy of %d statements (%v)\n", n, err)
+			continue
+		}
+		// Policies take a while to apply everywhere on some stores
+		params.settle()
+		params.policyReads(svc, &level.allowed, &level, false)
+		params.policyReads(bench.denied, &level.denied, &level, true)
+		fmt.Printf("Policy of %d statements: %s\n", n, level.summary())
+		report.levels = append(report.levels, level)
+	}
+
+	report.restoreErr = params.putPolicy(svc, original)
+	return report
+}
+
+// Reads the first numSamples objects with numClients concurrent readers,
+// recording the times of the reads that were allowed, or denied when
+// expectDenied
+func (params *Params) policyReads(svc *s3.Client, times *Histogram, level *PolicyLevel, expectDenied bool) {
+	var mu sync.Mutex
+	keys := make(chan string)
+	var wg sync.WaitGroup
+	for c := 0; c < int(params.numClients); c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keys {
+				start := time.Now()
+				input := &s3.GetObjectInput{Bucket: aws.String(params.bucketName), Key: aws.String(key)}
+				if params.sse != nil {
+					params.sse.applyGet(input)
+				}
+				output, err := svc.GetObject(context.Background(), input)
+				if err == nil {
+					_, err = io.Copy(ioutil.Discard, output.Body)
+					output.Body.Close()
+				}
+				duration := time.Since(start).Seconds()
+
+				var apiErr smithy.APIError
+				denied := errors.As(err, &apiErr) && apiErr.ErrorCode() == "AccessDenied"
+				mu.Lock()
+				switch {
+				case expectDenied && denied, !expectDenied && err == nil:
+					times.Record(duration)
+				case expectDenied && err == nil:
+					level.numLeaked++
+				default:
+					level.numErrors++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < params.numSamples; i++ {
+		keys <- params.objectKey(i)
+	}
+	close(keys)
+	wg.Wait()
+}
+
+func (l PolicyLevel) summary() string {
+	p50 := func(h *Histogram) float64 {
+		if h.Count() == 0 {
+			return 0
+		}
+		return h.Percentile(50)
+	}
+	return fmt.Sprintf("allowed p50 %0.3f s, denied p50 %0.3f s, %d errors, %d denied reads succeeded",
+		p50(&l.allowed), p50(&l.denied), l.numErrors, l.numLeaked)
+}
+
+func (r PolicyReport) String() string {
+	report := fmt.Sprintln("Results Summary for Policy Evaluation")
+	report += fmt.Sprintf("%10s %8s %9s %9s %8s %9s %9s %8s %8s\n",
+		"statements", "allowed", "50th s", "99th s", "denied", "50th s", "99th s", "errors", "leaked")
+	percentile := func(h *Histogram, p float64) float64 {
+		if h.Count() == 0 {
+			return 0
+		}
+		return h.Percentile(p)
+	}
+	for _, l := range r.levels {
+		if l.err != nil {
+			report += fmt.Sprintf("%10d failed: %v\n", l.statements, l.err)
+			continue
+		}
+		report += fmt.Sprintf("%10d %8d %9.3f %9.3f %8d %9.3f %9.3f %8d %8d\n", l.statements,
+			l.allowed.Count(), percentile(&l.allowed, 50), percentile(&l.allowed, 99),
+			l.denied.Count(), percentile(&l.denied, 50), percentile(&l.denied, 99),
+			l.numErrors, l.numLeaked)
+	}
+	if r.restoreErr != nil {
+		report += fmt.Sprintf("The original bucket policy could not be restored: %v\n", r.restoreErr)
+	}
+	return report
+}
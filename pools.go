@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// The connection pools requests are sent on with poolPerOp, so that large
+// uploads holding connections do not delay small reads waiting for one
+const (
+	poolWrite = "write"
+	poolRead  = "read"
+	poolOther = "other"
+)
+
+// Returns the pool of a request
+func requestPool(request Req) string {
+	switch r := request.(type) {
+	case *s3.PutObjectInput, *CommitInput, *CopyInput:
+		return poolWrite
+	case *s3.GetObjectInput, *s3.HeadObjectInput, *s3.GetObjectTaggingInput:
+		return poolRead
+	case *PresignedInput:
+		if r.op == opWrite {
+			return poolWrite
+		}
+		return poolRead
+	}
+	return poolOther
+}
+
+// A range of local ports the connections of a pool are made from, so that
+// the network can tell the pools apart
+type PortRange struct {
+	first, last int
+	// Where the next connection starts looking for a free port
+	next uint32
+}
+
+func ParsePortRange(spec string) (*PortRange, error) {
+	parts := strings.SplitN(spec, "-", 2)
+	first, err := strconv.Atoi(parts[0])
+	last := first
+	if err == nil && len(parts) == 2 {
+		last, err = strconv.Atoi(parts[1])
+	}
+	if err != nil || first < 1 || last > 65535 || first > last {
+		return nil, fmt.Errorf("invalid port range %q, eg: 20000-20999", spec)
+	}
+	return &PortRange{first: first, last: last}, nil
+}
+
+func (p *PortRange) String() string {
+	return fmt.Sprintf("%d-%d", p.first, p.last)
+}
+
+// Parses pool=FIRST-LAST pairs, eg: write=20000-20999,read=21000-21999
+func ParseSourcePorts(spec string) (map[string]*PortRange, error) {
+	ports := make(map[string]*PortRange)
+	for _, pair := range strings.Split(spec, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || (parts[0] != poolWrite && parts[0] != poolRead && parts[0] != poolOther) {
+			return nil, fmt.Errorf("invalid sourcePorts %q, expected write, read or other=FIRST-LAST pairs", pair)
+		}
+		r, err := ParsePortRange(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		ports[parts[0]] = r
+	}
+	return ports, nil
+}
+
+// Connects from the next free port of the range. Ports still bound, or in
+// TIME_WAIT towards the same address, are skipped.
+func (p *PortRange) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	n := p.last - p.first + 1
+	start := int(atomic.AddUint32(&p.next, 1))
+	var err error
+	for i := 0; i < n; i++ {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			LocalAddr: &net.TCPAddr{Port: p.first + (start+i)%n},
+		}
+		var conn net.Conn
+		conn, err = dialer.DialContext(ctx, network, addr)
+		if err == nil || !(errors.Is(err, syscall.EADDRINUSE) || errors.Is(err, syscall.EADDRNOTAVAIL)) {
+			return conn, err
+		}
+	}
+	return nil, fmt.Errorf("no free source port in %s: %v", p, err)
+}
+
+// Describes the pools for the parameters
+func poolsString(ports map[string]*PortRange) string {
+	var pools []string
+	for _, pool := range []string{poolWrite, poolRead, poolOther} {
+		if r, ok := ports[pool]; ok {
+			pools = append(pools, fmt.Sprintf("%s from ports %s", pool, r))
+		} else {
+			pools = append(pools, pool)
+		}
+	}
+	return strings.Join(pools, ", ")
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Longest validity of a presigned URL signed with SigV4
+const maxPresignExpires = 7 * 24 * time.Hour
+
+// Sends the writes and reads as plain HTTP requests to presigned URLs, as
+// mobile clients and browsers do, rather than as signed SDK calls. The URLs
+// of a test are generated before it starts, so that their generation is
+// measured on its own, and generated again when they are about to expire.
+type Presigner struct {
+	clients []*s3.PresignClient
+	expires time.Duration
+	// URLs by method, key and version, only used by the goroutine
+	// submitting the requests
+	urls map[string]presignedURL
+	// Times to generate URLs, by operation
+	generation map[string]*Histogram
+	numURLs    int
+}
+
+type presignedURL struct {
+	url     string
+	expires time.Time
+}
+
+func NewPresigner(clients []*s3.Client, expires time.Duration) (*Presigner, error) {
+	if expires <= 0 || expires > maxPresignExpires {
+		return nil, fmt.Errorf("presignExpires needs to be greater than 0 and at most %s", maxPresignExpires)
+	}
+	p := &Presigner{expires: expires, urls: make(map[string]presignedURL), generation: make(map[string]*Histogram)}
+	for _, svc := range clients {
+		p.clients = append(p.clients, s3.NewPresignClient(svc, s3.WithPresignExpires(expires)))
+	}
+	return p, nil
+}
+
+// How long before it expires a URL is generated again, so that the request
+// reaches the server while it is still valid: a tenth of the validity, at
+// most a minute
+func (p *Presigner) renewBefore() time.Duration {
+	if p.expires/10 < time.Minute {
+		return p.expires / 10
+	}
+	return time.Minute
+}
+
+// A write or read sent to a presigned URL
+type PresignedInput struct {
+	op     string
+	key    string
+	method string
+	url    string
+	size   int64
+	body   io.Reader
+	// The request made by the SDK otherwise, a PutObjectInput or a
+	// GetObjectInput
+	input Req
+}
+
+func presignedKey(method, key, versionID string) string {
+	return method + " " + key + "\x00" + versionID
+}
+
+// Returns the URL of a request, generating it with the client of the i-th
+// endpoint unless it was generated already and is not about to expire
+func (p *Presigner) url(op string, request Req, i int) (string, error) {
+	var method, key, versionID string
+	switch r := request.(type) {
+	case *s3.PutObjectInput:
+		method, key = http.MethodPut, aws.ToString(r.Key)
+	case *s3.GetObjectInput:
+		method, key, versionID = http.MethodGet, aws.ToString(r.Key), aws.ToString(r.VersionId)
+	default:
+		panic("Developer error")
+	}
+	if cached, ok := p.urls[presignedKey(method, key, versionID)]; ok && time.Until(cached.expires) > p.renewBefore() {
+		return cached.url, nil
+	}
+
+	ctx := context.Background()
+	client := p.clients[i%len(p.clients)]
+	start := time.Now()
+	var url string
+	if method == http.MethodPut {
+		// Only the key is signed, so that uploads need no particular headers
+		r := request.(*s3.PutObjectInput)
+		signed, err := client.PresignPutObject(ctx, &s3.PutObjectInput{Bucket: r.Bucket, Key: r.Key})
+		if err != nil {
+			return "", err
+		}
+		url = signed.URL
+	} else {
+		r := request.(*s3.GetObjectInput)
+		signed, err := client.PresignGetObject(ctx, &s3.GetObjectInput{Bucket: r.Bucket, Key: r.Key, VersionId: r.VersionId})
+		if err != nil {
+			return "", err
+		}
+		url = signed.URL
+	}
+	times, ok := p.generation[op]
+	if !ok {
+		times = &Histogram{}
+		p.generation[op] = times
+	}
+	times.Record(time.Since(start).Seconds())
+	p.numURLs++
+	p.urls[presignedKey(method, key, versionID)] = presignedURL{url: url, expires: start.Add(p.expires)}
+	return url, nil
+}
+
+// Returns the presigned version of a write or read
+func (p *Presigner) wrap(op string, request Req, i int) (Req, error) {
+	url, err := p.url(op, request, i)
+	if err != nil {
+		return nil, err
+	}
+	presigned := &PresignedInput{op: op, url: url, input: request}
+	switch r := request.(type) {
+	case *s3.PutObjectInput:
+		presigned.key, presigned.method = aws.ToString(r.Key), http.MethodPut
+		presigned.size, presigned.body = aws.ToInt64(r.ContentLength), r.Body
+	case *s3.GetObjectInput:
+		presigned.key, presigned.method = aws.ToString(r.Key), http.MethodGet
+	}
+	return presigned, nil
+}
+
+// Generates the URLs of the objects a test will write or read, before it
+// starts. URLs of a timed write test beyond numSamples objects are generated
+// as it goes.
+func (params *Params) presignStage(op string) error {
+	var requests []Req
+	switch {
+	case op == opWrite:
+		for i := 0; i < params.numSamples; i++ {
+			key := params.objectKey(i)
+			requests = append(requests, &s3.PutObjectInput{Bucket: aws.String(params.bucketFor(key)), Key: aws.String(key)})
+		}
+	case op == opRead && params.readManifest != nil:
+		for _, entry := range params.readManifest {
+			input := &s3.GetObjectInput{Bucket: aws.String(params.bucketName), Key: aws.String(entry.key)}
+			if entry.versionID != "" {
+				input.VersionId = aws.String(entry.versionID)
+			}
+			requests = append(requests, input)
+		}
+	case op == opRead:
+		numKeys := params.numSamples
+		if params.numKeys > 0 {
+			numKeys = params.numKeys
+		}
+		for i := 0; i < numKeys; i++ {
+			key := params.objectKey(i)
+			requests = append(requests, &s3.GetObjectInput{Bucket: aws.String(params.bucketFor(key)), Key: aws.String(key)})
+		}
+	}
+	start := time.Now()
+	for i, request := range requests {
+		if _, err := params.presign.url(op, request, i); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Presigned %d URLs in %s\n", len(requests), time.Since(start))
+	return nil
+}
+
+// Sends a presigned request, returning the response of a successful one
+func (params *Params) sendPresigned(ctx context.Context, client aws.HTTPClient, r *PresignedInput) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, r.method, r.url, r.body)
+	if err != nil {
+		return nil, err
+	}
+	if r.method == http.MethodPut {
+		request.ContentLength = r.size
+	}
+	if get, ok := r.input.(*s3.GetObjectInput); ok && get.Range != nil {
+		request.Header.Set("Range", *get.Range)
+	}
+	if params.trafficClass != "" {
+		// Headers other than x-amz-* ones need not be signed
+		request.Header.Set(trafficClassHeader, params.trafficClass)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 4096))
+		response.Body.Close()
+		var s3Error struct {
+			Code string
+		}
+		xml.Unmarshal(body, &s3Error)
+		return response, fmt.Errorf("%s %s: %s %s", r.method, strings.SplitN(r.url, "?", 2)[0], response.Status, s3Error.Code)
+	}
+	return response, nil
+}
+
+// Returns the GetObjectInput of a read, sent by the SDK or presigned
+func readInput(request Req) *s3.GetObjectInput {
+	if presigned, ok := request.(*PresignedInput); ok {
+		return presigned.input.(*s3.GetObjectInput)
+	}
+	return request.(*s3.GetObjectInput)
+}
+
+func (p *Presigner) String() string {
+	report := fmt.Sprintf("Presigned URL generation (%d URLs, expiring after %s):\n", p.numURLs, p.expires)
+	for _, op := range []string{opWrite, opRead} {
+		times, ok := p.generation[op]
+		if !ok || times.Count() == 0 {
+			continue
+		}
+		report += fmt.Sprintf("%-6s %8d URLs  mean %0.1f us  p50 %0.1f us  p99 %0.1f us  %0.0f URLs/s\n", op, times.Count(),
+			1e6*times.Sum()/float64(times.Count()), 1e6*times.Percentile(50), 1e6*times.Percentile(99),
+			float64(times.Count())/times.Sum())
+	}
+	return report
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Interval at which keepWarm pings the clients' connections during quiet
+// periods, shorter than the idle timeout of common servers and load balancers
+const keepWarmInterval = 5 * time.Second
+
+// Periods during a test in which no new requests are submitted, starting
+// every interval after the start of the test and lasting for length
+type QuietSchedule struct {
+	every  time.Duration
+	length time.Duration
+}
+
+// Parses schedules of the form "every 30m for 2m"
+func ParseQuietSchedule(spec string) (*QuietSchedule, error) {
+	var every, length string
+	if _, err := fmt.Sscanf(spec, "every %s for %s", &every, &length); err != nil {
+		return nil, fmt.Errorf("expected \"every <interval> for <duration>\", got %q", spec)
+	}
+	q := &QuietSchedule{}
+	var err error
+	if q.every, err = time.ParseDuration(every); err != nil {
+		return nil, err
+	}
+	if q.length, err = time.ParseDuration(length); err != nil {
+		return nil, err
+	}
+	if q.length <= 0 || q.length >= q.every {
+		return nil, fmt.Errorf("quiet period %s must be shorter than its interval %s", q.length, q.every)
+	}
+	return q, nil
+}
+
+// Returns how long the current quiet period, if any, lasts
+func (q *QuietSchedule) remaining(start time.Time) time.Duration {
+	elapsed := time.Since(start)
+	if elapsed < q.every {
+		return 0
+	}
+	if into := elapsed % q.every; into < q.length {
+		return q.length - into
+	}
+	return 0
+}
+
+// A cheap request sent during quiet periods only to keep a connection open,
+// clients send no response for it
+type KeepWarmInput struct {
+	s3.HeadBucketInput
+}
+
+// Sleeps until the end of the current quiet period, if any. With keepWarm
+// the clients send a HEAD request every keepWarmInterval meanwhile, so that
+// recovery after the period does not include reconnecting.
+func (params *Params) waitQuiet(start time.Time) {
+	end := time.Now().Add(params.quiet.remaining(start))
+	for params.keepWarm && time.Until(end) > keepWarmInterval {
+		time.Sleep(keepWarmInterval)
+		for i := uint(0); i < params.numClients; i++ {
+			params.requests <- &KeepWarmInput{s3.HeadBucketInput{Bucket: aws.String(params.bucketName)}}
+		}
+	}
+	time.Sleep(time.Until(end))
+}
+
+func (params *Params) sendKeepWarm(ctx context.Context, svc *s3.Client, input *KeepWarmInput) {
+	atomic.AddInt64(&params.keepWarmPings, 1)
+	if _, err := svc.HeadBucket(ctx, &input.HeadBucketInput); err != nil {
+		atomic.AddInt64(&params.keepWarmErrors, 1)
+	}
+}
+
+// Returns which quiet period precedes the given time, 0 meaning none
+func (q *QuietSchedule) period(start, t time.Time) int {
+	return int(t.Sub(start) / q.every)
+}
+
+func (q *QuietSchedule) String() string {
+	return fmt.Sprintf("every %s for %s", q.every, q.length)
+}
+
+// Keep the latencies of the first operations started after each quiet period
+func (r *Result) addToRecovery(resp Resp, q *QuietSchedule, start time.Time, numOps int) {
+	period := q.period(start, resp.startTime)
+	if period == 0 || resp.err != nil {
+		return
+	}
+	if r.recoveries == nil {
+		r.recoveries = make(map[int][]float64)
+	}
+	if len(r.recoveries[period]) < numOps {
+		r.recoveries[period] = append(r.recoveries[period], resp.duration.Seconds())
+	}
+}
+
+func (r Result) recoveryReport(q *QuietSchedule) string {
+	periods := make([]int, 0, len(r.recoveries))
+	for period := range r.recoveries {
+		periods = append(periods, period)
+	}
+	sort.Ints(periods)
+
+	report := fmt.Sprintf("%s recovery after quiet periods (%s), stage 50th %%ile %0.3f s:\n",
+		r.operation, q, r.percentile(50))
+	for _, period := range periods {
+		durations := r.recoveries[period]
+		var sum, max float64
+		for _, d := range durations {
+			sum += d
+			if d > max {
+				max = d
+			}
+		}
+		// The first operations are the ones paying for cold caches and
+		// connections, so report them individually as well as on average
+		report += fmt.Sprintf("Quiet period %d, resumed at +%s: first %d ops avg %0.3f s, first op %0.3f s, max %0.3f s\n",
+			period, time.Duration(period)*q.every+q.length, len(durations),
+			sum/float64(len(durations)), durations[0], max)
+	}
+	if r.keepWarmPings > 0 {
+		report += fmt.Sprintf("Connections kept warm with %d HEAD requests every %s (%d errors)\n",
+			r.keepWarmPings, keepWarmInterval, r.keepWarmErrors)
+	}
+	return report
+}
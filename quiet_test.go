@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuietSchedule(t *testing.T) {
+	tests := []struct {
+		spec   string
+		every  time.Duration
+		length time.Duration
+		ok     bool
+	}{
+		{"every 30m for 2m", 30 * time.Minute, 2 * time.Minute, true},
+		{"every 1h30m for 90s", 90 * time.Minute, 90 * time.Second, true},
+		{"every 10s for 9.5s", 10 * time.Second, 9500 * time.Millisecond, true},
+		{"every 30m", 0, 0, false},
+		{"30m for 2m", 0, 0, false},
+		{"every 30 for 2m", 0, 0, false},
+		{"every 30m for 2", 0, 0, false},
+		{"every 2m for 2m", 0, 0, false},
+		{"every 2m for 5m", 0, 0, false},
+		{"every 2m for 0s", 0, 0, false},
+		{"every 2m for -1s", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, test := range tests {
+		q, err := ParseQuietSchedule(test.spec)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %s", test.spec, q)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+			continue
+		}
+		if q.every != test.every || q.length != test.length {
+			t.Errorf("%q: every %s for %s, expected every %s for %s", test.spec, q.every, q.length, test.every, test.length)
+		}
+	}
+}
+
+func TestQuietSchedulePeriod(t *testing.T) {
+	q := &QuietSchedule{every: 30 * time.Minute, length: 2 * time.Minute}
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		elapsed time.Duration
+		period  int
+	}{
+		{0, 0},
+		{29 * time.Minute, 0},
+		{30 * time.Minute, 1},
+		{61 * time.Minute, 2},
+	}
+	for _, test := range tests {
+		if period := q.period(start, start.Add(test.elapsed)); period != test.period {
+			t.Errorf("%s into the test: period %d, expected %d", test.elapsed, period, test.period)
+		}
+	}
+}
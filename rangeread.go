@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	rangeFixed      = "fixed"
+	rangeRandom     = "random"
+	rangeSequential = "sequential"
+
+	// Ways a response can fail to honour a range
+	rangeViolationStatus       = "status other than 206"
+	rangeViolationContentRange = "wrong Content-Range"
+	rangeViolationContent      = "wrong bytes"
+)
+
+// Makes the read test read a range of each object rather than all of it, as
+// analytics engines reading columns out of large files do
+type RangeRead struct {
+	size    int64
+	pattern string
+	rand    *rand.Rand
+	// Offset of the next range of each object read sequentially
+	next map[int]int64
+}
+
+// Parses size[,fixed|random|sequential], a fixed range from the start of the
+// object when no offset pattern is given
+func ParseRangeRead(spec string) (*RangeRead, error) {
+	parts := strings.SplitN(spec, ",", 2)
+	invalid := fmt.Errorf("invalid rangeRead %q, expected a size and fixed, random or sequential offsets, eg: 64KiB,random", spec)
+	size, err := parseSize(parts[0])
+	if err != nil || size <= 0 {
+		return nil, invalid
+	}
+	r := &RangeRead{size: size, pattern: rangeFixed}
+	if len(parts) == 2 {
+		r.pattern = parts[1]
+	}
+	switch r.pattern {
+	case rangeFixed, rangeSequential:
+	case rangeRandom:
+		r.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	default:
+		return nil, invalid
+	}
+	r.next = make(map[int]int64)
+	return r, nil
+}
+
+func (r *RangeRead) String() string {
+	return fmt.Sprintf("%s,%s", formatSize(r.size), r.pattern)
+}
+
+// Returns the Range header of the next read of the keyIndex-th object of the
+// given size, empty for objects too small to hold a whole range. Only called
+// by the goroutine submitting the reads.
+func (r *RangeRead) header(keyIndex int, objectSize int64) string {
+	if objectSize < r.size {
+		return ""
+	}
+	var offset int64
+	switch r.pattern {
+	case rangeRandom:
+		offset = r.rand.Int63n(objectSize - r.size + 1)
+	case rangeSequential:
+		// Successive reads of an object walk through it, starting over at the
+		// first range once the next one would not fit
+		offset = r.next[keyIndex]
+		if offset+r.size > objectSize {
+			offset = 0
+		}
+		r.next[keyIndex] = offset + r.size
+	}
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+r.size-1)
+}
+
+// Returns the length of a range formatted by header
+func rangeLength(header string) int64 {
+	var first, last int64
+	if _, err := fmt.Sscanf(header, "bytes=%d-%d", &first, &last); err != nil {
+		return 0
+	}
+	return last - first + 1
+}
+
+// Reads the body of a ranged read, checking that the response honoured the
+// range with a 206 status and the Content-Range of the range requested. The
+// bytes are checked too when the data of the object is known, given as the
+// expected data of the range, and the response got the rest right. Returns
+// the bytes read and the violations found.
+func readRange(body io.ReadCloser, header string, response *http.Response, expected *RandomReader) (int64, []string, error) {
+	var violations []string
+	status, contentRange := 0, ""
+	if response != nil {
+		status, contentRange = response.StatusCode, response.Header.Get("Content-Range")
+	}
+	if status != http.StatusPartialContent {
+		violations = append(violations, rangeViolationStatus)
+	}
+	var first, last, size int64
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &first, &last, &size); err != nil ||
+		fmt.Sprintf("bytes=%d-%d", first, last) != header {
+		violations = append(violations, rangeViolationContentRange)
+	}
+	if len(violations) > 0 || expected == nil {
+		n, err := io.Copy(ioutil.Discard, body)
+		return n, violations, err
+	}
+
+	expected.Seek(first, io.SeekStart)
+	check := NewDataCheck(body, expected)
+	n, err := io.Copy(ioutil.Discard, check)
+	if err != nil {
+		return n, violations, err
+	}
+	if !check.matches || n != last-first+1 {
+		violations = append(violations, rangeViolationContent)
+	}
+	return n, violations, nil
+}
+
+func (r *Result) addRangeViolations(resp Resp) {
+	if len(resp.rangeViolations) == 0 {
+		return
+	}
+	if r.rangeViolations == nil {
+		r.rangeViolations = make(map[string]int)
+	}
+	for _, violation := range resp.rangeViolations {
+		r.rangeViolations[violation]++
+	}
+}
+
+func (r Result) rangeViolationReport() string {
+	report := fmt.Sprintln("Range violations, ranged reads the server did not honour:")
+	violations := make([]string, 0, len(r.rangeViolations))
+	for violation := range r.rangeViolations {
+		violations = append(violations, violation)
+	}
+	sort.Strings(violations)
+	for _, violation := range violations {
+		report += fmt.Sprintf("%-22s %d\n", violation+":", r.rangeViolations[violation])
+	}
+	return report
+}
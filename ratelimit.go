@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Paces callers so that together they do not exceed a number of operations
+// per second, callers are spaced evenly instead of being let through in bursts
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func NewRateLimiter(opsPerSecond float64) *RateLimiter {
+	return &RateLimiter{interval: time.Duration(float64(time.Second) / opsPerSecond)}
+}
+
+// Block until the caller is allowed to start its next operation
+func (l *RateLimiter) Wait() {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+func (l *RateLimiter) String() string {
+	return fmt.Sprintf("%0.1f ops/s", float64(time.Second)/float64(l.interval))
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Measures how long objects take to become readable after being written, as
+// replicated stores may serve a stale or missing object for a while. During
+// the write test, pollers read every object written, from the endpoint which
+// wrote it or another one, until they get the data written, while the writes
+// go on. Objects written faster than the pollers can keep up with are
+// skipped rather than polled late.
+type ReadAfterWrite struct {
+	endpoint string
+	poll     time.Duration
+	timeout  time.Duration
+	params   *Params
+	cfg      aws.Config
+	pending  chan rawWrite
+	wg       sync.WaitGroup
+	// Written by the pollers
+	mu         sync.Mutex
+	clients    map[string]*s3.Client
+	firstPolls Histogram
+	delays     Histogram
+	numPolled  int
+	numAtOnce  int
+	numStale   int
+	numMissing int
+	numErrors  int
+	// Written by the goroutine collecting responses
+	numSkipped int
+}
+
+// An object written, to poll until it is readable
+type rawWrite struct {
+	key      string
+	etag     string
+	size     int64
+	endpoint string
+	written  time.Time
+}
+
+func NewReadAfterWrite(endpoint string, poll, timeout time.Duration) *ReadAfterWrite {
+	return &ReadAfterWrite{endpoint: endpoint, poll: poll, timeout: timeout}
+}
+
+// Starts the pollers of the write test
+func (c *ReadAfterWrite) Start(params *Params, cfg aws.Config, numPollers int) {
+	c.params, c.cfg = params, cfg
+	c.clients = make(map[string]*s3.Client)
+	c.pending = make(chan rawWrite, numPollers)
+	for i := 0; i < numPollers; i++ {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			for w := range c.pending {
+				c.check(w)
+			}
+		}()
+	}
+}
+
+// Hands an object successfully written to the pollers, or skips it when they
+// are all busy
+func (c *ReadAfterWrite) Add(resp Resp) {
+	w := rawWrite{
+		key:      resp.key,
+		etag:     trimETag(resp.output.(*s3.PutObjectOutput).ETag),
+		size:     resp.numBytes,
+		endpoint: resp.endpoint,
+		written:  resp.startTime.Add(resp.duration),
+	}
+	select {
+	case c.pending <- w:
+	default:
+		c.numSkipped++
+	}
+}
+
+// Waits for the objects handed to the pollers to be readable or time out
+func (c *ReadAfterWrite) Wait() {
+	close(c.pending)
+	c.wg.Wait()
+}
+
+func (c *ReadAfterWrite) client(endpoint string) *s3.Client {
+	if c.endpoint != "" {
+		endpoint = c.endpoint
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	svc, ok := c.clients[endpoint]
+	if !ok {
+		svc = c.params.newS3Client(c.cfg, endpoint)
+		c.clients[endpoint] = svc
+	}
+	return svc
+}
+
+// Polls an object until it is readable with the data written or the timeout
+// expires. The delay of an object not readable at once is that of the start
+// of the first poll which got the data, an upper bound of the actual delay
+// within the poll interval. Objects readable at once have none, as the first
+// poll may be late while the pollers are busy.
+func (c *ReadAfterWrite) check(w rawWrite) {
+	svc := c.client(w.endpoint)
+	stale, errs := 0, 0
+	for {
+		start := time.Now()
+		if stale == 0 && errs == 0 {
+			c.mu.Lock()
+			c.firstPolls.Record(start.Sub(w.written).Seconds())
+			c.mu.Unlock()
+		}
+		visible, err := c.read(svc, w)
+		if visible {
+			c.mu.Lock()
+			c.numPolled++
+			if stale == 0 && errs == 0 {
+				c.numAtOnce++
+			} else {
+				c.delays.Record(start.Sub(w.written).Seconds())
+			}
+			c.numStale += stale
+			c.numErrors += errs
+			c.mu.Unlock()
+			return
+		}
+		if err != nil {
+			errs++
+		} else {
+			stale++
+		}
+		if time.Since(w.written) > c.timeout {
+			c.mu.Lock()
+			c.numPolled++
+			c.numMissing++
+			c.numStale += stale
+			c.numErrors += errs
+			c.mu.Unlock()
+			return
+		}
+		time.Sleep(c.poll)
+	}
+}
+
+// Reads an object, returning whether it has the length, ETag and, with
+// verifyContent, the data written. A missing object is stale rather than an
+// error.
+func (c *ReadAfterWrite) read(svc *s3.Client, w rawWrite) (bool, error) {
+	input := &s3.GetObjectInput{Bucket: aws.String(c.params.bucketFor(w.key)), Key: aws.String(w.key)}
+	if c.params.sse != nil {
+		c.params.sse.applyGet(input)
+	}
+	output, err := svc.GetObject(context.Background(), input)
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer output.Body.Close()
+	if w.etag != "" && trimETag(output.ETag) != w.etag {
+		return false, nil
+	}
+	var body io.Reader = output.Body
+	var check *DataCheck
+	if c.params.verifyContent {
+		check = NewDataCheck(output.Body, c.params.objectData(w.key, 0, w.size))
+		body = check
+	}
+	n, err := io.Copy(ioutil.Discard, body)
+	if err != nil {
+		return false, err
+	}
+	return n == w.size && (check == nil || check.matches), nil
+}
+
+func (c *ReadAfterWrite) String() string {
+	source := "the endpoint which wrote them"
+	if c.endpoint != "" {
+		source = c.endpoint
+	}
+	report := fmt.Sprintf("Read-after-write consistency, objects polled every %s from %s:\n", c.poll, source)
+	report += fmt.Sprintf("Objects Polled:    %d", c.numPolled)
+	if c.numSkipped > 0 {
+		report += fmt.Sprintf(" (%d skipped while the pollers were busy)", c.numSkipped)
+	}
+	report += "\n"
+	report += fmt.Sprintf("Readable At Once:  %d\n", c.numAtOnce)
+	if c.firstPolls.Count() > 0 {
+		report += fmt.Sprintf("First Poll:        %0.3f s p50, %0.3f s p99 after the write\n",
+			c.firstPolls.Percentile(50), c.firstPolls.Percentile(99))
+	}
+	report += fmt.Sprintf("Stale Reads:       %d (missing or other data)\n", c.numStale)
+	if c.numErrors > 0 {
+		report += fmt.Sprintf("Failed Reads:      %d\n", c.numErrors)
+	}
+	if c.numMissing > 0 {
+		report += fmt.Sprintf("Never Readable:    %d within %s\n", c.numMissing, c.timeout)
+	}
+	if c.delays.Count() > 0 {
+		report += fmt.Sprintf("Delay When Stale:  %0.3f s p50, %0.3f s p90, %0.3f s p99, %0.3f s max\n",
+			c.delays.Percentile(50), c.delays.Percentile(90), c.delays.Percentile(99), c.delays.Percentile(100))
+	}
+	return report
+}
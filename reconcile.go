@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const opList = "List"
+
+// One of the two bucket/prefix locations being compared
+type reconcileSide struct {
+	bucket  string
+	prefix  string
+	objects map[string]reconcileObject
+}
+
+type reconcileObject struct {
+	size int64
+	etag string
+}
+
+// Contains the differences found between two listings and the performance
+// of the listing itself
+type ReconcileReport struct {
+	source         *reconcileSide
+	replica        *reconcileSide
+	missing        []string
+	extra          []string
+	sizeMismatches []string
+	etagMismatches []string
+	numPages       int
+	numListErrors  int
+	listResult     Result
+	verbose        bool
+}
+
+// Splits "bucket/some/prefix" into its bucket and key prefix
+func parseBucketPrefix(location string) *reconcileSide {
+	parts := strings.SplitN(strings.TrimPrefix(location, "s3://"), "/", 2)
+	side := &reconcileSide{bucket: parts[0], objects: make(map[string]reconcileObject)}
+	if len(parts) == 2 {
+		side.prefix = parts[1]
+	}
+	return side
+}
+
+// Lists both locations through the client pool and compares their contents,
+// keys are compared relative to their respective prefix. Each side is first
+// listed one level deep and every common prefix found is then listed as an
+// independent partition, so that the clients can page through partitions in
+// parallel.
+func (params *Params) Reconcile(source, replica string) ReconcileReport {
+	report := ReconcileReport{
+		source:     parseBucketPrefix(source),
+		replica:    parseBucketPrefix(replica),
+		listResult: Result{operation: opList},
+		verbose:    params.verbose,
+	}
+
+	startTime := time.Now()
+	jobs := make(map[Req]*reconcileSide)
+	var pending []Req
+	for _, side := range []*reconcileSide{report.source, report.replica} {
+		input := &s3.ListObjectsV2Input{
+			Bucket:    aws.String(side.bucket),
+			Prefix:    aws.String(side.prefix),
+			Delimiter: aws.String("/"),
+		}
+		jobs[input] = side
+		pending = append(pending, input)
+	}
+
+	for len(jobs) > 0 {
+		// Only offer a request to the clients when one is pending
+		var requests chan Req
+		var next Req
+		if len(pending) > 0 {
+			requests = params.requests
+			next = pending[0]
+		}
+
+		select {
+		case requests <- next:
+			pending = pending[1:]
+			continue
+		case resp := <-params.responses:
+			side := jobs[resp.request]
+			delete(jobs, resp.request)
+			report.numPages++
+			if resp.err != nil {
+				report.numListErrors++
+				fmt.Printf("Failed to list s3://%s/%s (%v)\n", side.bucket, side.prefix, resp.err)
+				continue
+			}
+			report.listResult.opDurations.Record(resp.duration.Seconds())
+
+			input := resp.request.(*s3.ListObjectsV2Input)
+			page := resp.output.(*s3.ListObjectsV2Output)
+			for _, obj := range page.Contents {
+				side.objects[strings.TrimPrefix(*obj.Key, side.prefix)] = reconcileObject{
+					size: aws.ToInt64(obj.Size),
+					etag: aws.ToString(obj.ETag),
+				}
+			}
+			for _, commonPrefix := range page.CommonPrefixes {
+				partition := &s3.ListObjectsV2Input{
+					Bucket: input.Bucket,
+					Prefix: commonPrefix.Prefix,
+				}
+				jobs[partition] = side
+				pending = append(pending, partition)
+			}
+			if aws.ToBool(page.IsTruncated) {
+				nextPage := *input
+				nextPage.ContinuationToken = page.NextContinuationToken
+				jobs[&nextPage] = side
+				pending = append(pending, &nextPage)
+			}
+		}
+	}
+	report.listResult.totalDuration = time.Since(startTime)
+
+	for key, obj := range report.source.objects {
+		other, ok := report.replica.objects[key]
+		if !ok {
+			report.missing = append(report.missing, key)
+		} else if other.size != obj.size {
+			report.sizeMismatches = append(report.sizeMismatches, key)
+		} else if other.etag != obj.etag {
+			report.etagMismatches = append(report.etagMismatches, key)
+		}
+	}
+	for key := range report.replica.objects {
+		if _, ok := report.source.objects[key]; !ok {
+			report.extra = append(report.extra, key)
+		}
+	}
+	for _, keys := range [][]string{report.missing, report.extra, report.sizeMismatches, report.etagMismatches} {
+		sort.Strings(keys)
+	}
+	return report
+}
+
+func (side *reconcileSide) totalSize() int64 {
+	var total int64
+	for _, obj := range side.objects {
+		total += obj.size
+	}
+	return total
+}
+
+func (r ReconcileReport) String() string {
+	report := fmt.Sprintf("Reconciliation of s3://%s/%s against s3://%s/%s\n",
+		r.source.bucket, r.source.prefix, r.replica.bucket, r.replica.prefix)
+	report += fmt.Sprintf("Source objects:     %d (%0.3f MB)\n", len(r.source.objects), float64(r.source.totalSize())/(1024*1024))
+	report += fmt.Sprintf("Replica objects:    %d (%0.3f MB)\n", len(r.replica.objects), float64(r.replica.totalSize())/(1024*1024))
+	report += fmt.Sprintf("Missing in replica: %d\n", len(r.missing))
+	report += fmt.Sprintf("Extra in replica:   %d\n", len(r.extra))
+	report += fmt.Sprintf("Size mismatches:    %d\n", len(r.sizeMismatches))
+	report += fmt.Sprintf("ETag mismatches:    %d\n", len(r.etagMismatches))
+	if r.verbose {
+		for _, diff := range []struct {
+			label string
+			keys  []string
+		}{{"missing", r.missing}, {"extra", r.extra}, {"size mismatch", r.sizeMismatches}, {"etag mismatch", r.etagMismatches}} {
+			for _, key := range diff.keys {
+				report += fmt.Sprintf("  %s: %s\n", diff.label, key)
+			}
+		}
+	}
+
+	numKeys := len(r.source.objects) + len(r.replica.objects)
+	seconds := r.listResult.totalDuration.Seconds()
+	report += fmt.Sprintln("------------------------------------")
+	report += fmt.Sprintf("List pages:         %d (%d errors)\n", r.numPages, r.numListErrors)
+	report += fmt.Sprintf("List duration:      %0.3f s\n", seconds)
+	report += fmt.Sprintf("List throughput:    %0.1f keys/s, %0.1f pages/s\n", float64(numKeys)/seconds, float64(r.numPages)/seconds)
+	if r.listResult.opDurations.Count() > 0 {
+		report += fmt.Sprintf("List page times Max:       %0.3f s\n", r.listResult.percentile(100))
+		report += fmt.Sprintf("List page times 99th %%ile: %0.3f s\n", r.listResult.percentile(99))
+		report += fmt.Sprintf("List page times 50th %%ile: %0.3f s\n", r.listResult.percentile(50))
+		report += fmt.Sprintf("List page times Min:       %0.3f s\n", r.listResult.percentile(0))
+	}
+	return report
+}
+
+// Whether both locations hold the same objects
+func (r ReconcileReport) InSync() bool {
+	return r.numListErrors == 0 && len(r.missing) == 0 && len(r.extra) == 0 &&
+		len(r.sizeMismatches) == 0 && len(r.etagMismatches) == 0
+}
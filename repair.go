@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Notes the object of a read which failed verification, its length, data or
+// ETag not being those written, for repair to write it again
+func (r *Result) addCorrupt(resp Resp) {
+	if !resp.corrupt {
+		return
+	}
+	if r.corruptKeys == nil {
+		r.corruptKeys = make(map[string]bool)
+	}
+	r.corruptKeys[resp.key] = true
+}
+
+// Writes the objects whose reads failed verification again with the data they
+// were written with, then reads them back. Objects still read wrong, or which
+// could not be written, are unrepairable. The failed reads are still counted
+// as errors, so that the corruption is reported.
+func (params *Params) repairObjects(svc *s3.Client, result *Result) {
+	keys := make([]string, 0, len(result.corruptKeys))
+	for key := range result.corruptKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := params.repairObject(svc, key); err != nil {
+			result.numUnrepairable++
+			fmt.Printf("Could not repair %s: %v\n", key, err)
+			continue
+		}
+		result.numRepaired++
+	}
+}
+
+func (params *Params) repairObject(svc *s3.Client, key string) error {
+	ctx := context.Background()
+	size := params.expectedSize(key, "")
+	input := &s3.PutObjectInput{
+		Bucket:        aws.String(params.bucketFor(key)),
+		Key:           aws.String(key),
+		Body:          params.objectData(key, 0, size),
+		ContentLength: aws.Int64(size),
+	}
+	if params.metadata != nil {
+		params.metadata.apply(input)
+	}
+	if params.sse != nil {
+		params.sse.applyPut(input)
+	}
+	written, err := svc.PutObject(ctx, input, requestOptions("", "", nil, true)...)
+	if err != nil {
+		return err
+	}
+	if params.etags != nil {
+		params.etags.add(key, written)
+	}
+
+	get := &s3.GetObjectInput{Bucket: input.Bucket, Key: input.Key}
+	if params.sse != nil {
+		params.sse.applyGet(get)
+	}
+	output, err := svc.GetObject(ctx, get)
+	if err != nil {
+		return err
+	}
+	check := NewDataCheck(output.Body, params.objectData(key, 0, size))
+	numBytes, err := io.Copy(ioutil.Discard, check)
+	check.Close()
+	if err != nil {
+		return err
+	}
+	if numBytes != size {
+		return fmt.Errorf("read %d bytes back, expected %d", numBytes, size)
+	}
+	if !check.matches {
+		return fmt.Errorf("data read back differs from the data written")
+	}
+	return nil
+}
+
+func (r Result) repairReport() string {
+	report := fmt.Sprintf("Objects Repaired:  %d\n", r.numRepaired)
+	report += fmt.Sprintf("Unrepairable:      %d\n", r.numUnrepairable)
+	return report
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// How often buffered rows are pushed to the file, so that the log of a
+// long run can be followed and most of it survives the process being killed
+const requestLogFlushInterval = 5 * time.Second
+
+// Writes one CSV row per completed request. Files whose name ends in .gz or
+// .zst are compressed, since soak runs otherwise produce enormous logs.
+type RequestLog struct {
+	mu         sync.Mutex
+	file       *os.File
+	compressor compressWriter
+	csv        *csv.Writer
+	stop       chan struct{}
+	done       chan struct{}
+	// Logged with every request so that the logs of instances sharing a
+	// bucket can be merged
+	trafficClass string
+	// Only the columns of latencyLog
+	latencyOnly bool
+}
+
+// The subset of gzip.Writer and zstd.Encoder used by the log
+type compressWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+var requestLogHeader = []string{"timestamp", "op", "key", "endpoint", "duration", "ttfb", "bytes", "status", "error", "server_date", "request_id", "traffic_class"}
+
+// The columns of requestLogHeader written to latencyLog, which is meant to be
+// loaded as is for post-processing latencies
+var latencyLogColumns = []int{0, 1, 2, 4, 5, 6, 7, 8}
+
+func OpenRequestLog(path, trafficClass string) (*RequestLog, error) {
+	return openLog(path, trafficClass, false)
+}
+
+// Opens a log of the start time, operation, key, duration, time to first
+// byte, bytes, status and error of every request
+func OpenLatencyLog(path string) (*RequestLog, error) {
+	return openLog(path, "", true)
+}
+
+func openLog(path, trafficClass string, latencyOnly bool) (*RequestLog, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &RequestLog{
+		file:         file,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+		trafficClass: trafficClass,
+		latencyOnly:  latencyOnly,
+	}
+	var w io.Writer = file
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		l.compressor = gzip.NewWriter(file)
+	case strings.HasSuffix(path, ".zst"):
+		l.compressor, err = zstd.NewWriter(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if l.compressor != nil {
+		w = l.compressor
+	}
+	l.csv = csv.NewWriter(w)
+	l.csv.Write(l.columns(requestLogHeader))
+
+	go l.flushLoop()
+	return l, nil
+}
+
+// Append the row for a completed request
+func (l *RequestLog) Write(resp Resp) {
+	errorString := ""
+	if resp.err != nil {
+		errorString = resp.err.Error()
+	}
+	row := []string{
+		resp.startTime.UTC().Format(time.RFC3339Nano),
+		resp.op,
+		resp.key,
+		resp.endpoint,
+		strconv.FormatFloat(resp.duration.Seconds(), 'f', 6, 64),
+		strconv.FormatFloat(resp.ttfb.Seconds(), 'f', 6, 64),
+		strconv.FormatInt(resp.numBytes, 10),
+		"",
+		errorString,
+		"",
+		resp.requestID,
+		l.trafficClass,
+	}
+	if resp.status != 0 {
+		row[7] = strconv.Itoa(resp.status)
+	}
+	if !resp.serverDate.IsZero() {
+		row[9] = resp.serverDate.UTC().Format(time.RFC3339)
+	}
+
+	l.mu.Lock()
+	l.csv.Write(l.columns(row))
+	l.mu.Unlock()
+}
+
+func (l *RequestLog) columns(row []string) []string {
+	if !l.latencyOnly {
+		return row
+	}
+	columns := make([]string, len(latencyLogColumns))
+	for i, c := range latencyLogColumns {
+		columns[i] = row[c]
+	}
+	return columns
+}
+
+// Logs a completed request to requestLog and latencyLog
+func (params *Params) logRequest(resp Resp) {
+	if params.requestLog != nil {
+		params.requestLog.Write(resp)
+	}
+	if params.latencyLog != nil {
+		params.latencyLog.Write(resp)
+	}
+}
+
+func (l *RequestLog) flushLoop() {
+	defer close(l.done)
+	ticker := time.NewTicker(requestLogFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.mu.Lock()
+			l.flush()
+			l.mu.Unlock()
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// Must be called with the lock held
+func (l *RequestLog) flush() error {
+	l.csv.Flush()
+	if err := l.csv.Error(); err != nil {
+		return err
+	}
+	if l.compressor != nil {
+		// Completes the current compressed block so that everything logged
+		// so far can be decompressed even if the file is never closed
+		return l.compressor.Flush()
+	}
+	return nil
+}
+
+// Flush any buffered rows and close the file
+func (l *RequestLog) Close() error {
+	close(l.stop)
+	<-l.done
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.flush()
+	if l.compressor != nil {
+		if cerr := l.compressor.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// Generates the identifier namespacing the objects of a run, sortable by
+// start time and unique enough that concurrent runs never share one
+func newRunID() (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix), nil
+}
+
+// Whether a traffic class can be sent as is in a header and the User-Agent,
+// empty being no class
+func validTrafficClass(class string) bool {
+	for _, c := range class {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return len(class) <= 64
+}
@@ -1,21 +1,28 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"crypto/md5"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
+	"net/http"
 	"os"
-	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
 )
 
 const (
@@ -25,28 +32,263 @@ const (
 	commitSize = 1000
 )
 
-var bufferBytes []byte
+// Seed of the pseudo-random data written to objects
+var dataSeed uint64
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "trend" {
+		os.Exit(runTrend(os.Args[2:]))
+	}
+	invocationStart := time.Now()
 	endpoint := flag.String("endpoint", "", "S3 endpoint(s) comma separated - http://IP:PORT,http://IP:PORT")
 	region := flag.String("region", "igneous-test", "AWS region to use, eg: us-west-1|us-east-1, etc")
 	accessKey := flag.String("accessKey", "", "the S3 access key")
 	accessSecret := flag.String("accessSecret", "", "the S3 access secret")
-	bucketName := flag.String("bucket", "bucketname", "the bucket for which to run the test")
-	objectNamePrefix := flag.String("objectNamePrefix", "loadgen_test_", "prefix of the object name that will be used")
-	objectSize := flag.Int64("objectSize", 80*1024*1024, "size of individual requests in bytes (must be smaller than main memory)")
+	legacyKeyFormats := flag.String("legacyKeyFormats", "", "comma separated names to retry reads of missing objects with, plain for objectNamePrefix and the object number or a format of the number, eg: plain,loadgen_test_%d")
+	createBucket := flag.Bool("createBucket", false, "create the bucket before testing, it may already exist")
+	locationConstraint := flag.String("locationConstraint", "", "location constraint of the created bucket, none to omit it, derived from region on AWS endpoints by default")
+	addressingStyle := flag.String("addressingStyle", addressingPath, "address buckets in the path of requests, path, or as a subdomain of the endpoint, virtual")
+	anonymous := flag.Bool("anonymous", false, "send unsigned requests without credentials, for public buckets and stores accepting unauthenticated requests")
+	profile := flag.String("profile", "", "named profile of the shared AWS config and credentials files to use when accessKey is omitted")
+	roleArn := flag.String("roleArn", "", "ARN of a role to assume with the credentials before benchmarking")
+	externalID := flag.String("externalId", "", "external ID required to assume roleArn")
+	webIdentityTokenFile := flag.String("webIdentityTokenFile", "", "file of an OIDC token to assume roleArn with instead of the credentials, such as the service account token of an EKS pod")
+	bucketName := flag.String("bucket", "bucketname", "the bucket for which to run the test, or a comma separated list of buckets to spread the objects over")
+	numBuckets := flag.Int("numBuckets", 0, "spread the objects over this many buckets named after bucket, eg: bench-0, bench-1, created if they do not exist")
+	bucketSpread := flag.String("bucketSpread", bucketSpreadRoundRobin, "how objects are spread over several buckets: roundRobin by object number or hash of the key")
+	objectNamePrefix := flag.String("objectNamePrefix", "loadgen_test_", "prefix of the object name that will be used, followed by the run ID unless noRunID is set")
+	objectSize := sizeFlag(80 * 1024 * 1024)
+	flag.Var(&objectSize, "objectSize", "size of individual requests in bytes, or with a unit such as 4KiB, 16MiB or 1GB (powers of 1000)")
 	numClients := flag.Int("numClients", 40, "number of concurrent clients")
-	numSamples := flag.Int("numSamples", 200, "total number of requests to send")
+	numSamples := countFlag(200)
+	flag.Var(&numSamples, "numSamples", "total number of requests to send, or with duration the number of existing objects read by a read-only run, eg: 200 or 1M")
+	var datasetSize sizeFlag
+	flag.Var(&datasetSize, "datasetSize", "write objects of objectSize or objectSizeDist up to this total size instead of numSamples of them, eg: 5TiB")
+	duration := flag.Duration("duration", 0, "run each test for this long instead of a fixed numSamples")
+	startAt := flag.String("startAt", "", "wall clock time to start the first test at, so that instances launched separately on several hosts with NTP synced clocks start their load together, eg: 2024-06-01T12:00:00Z")
+	streamStages := flag.Bool("streamStages", false, "print the result of each stage to stdout as a line of JSON as soon as it finishes, for automation to act on between stages")
+	stageDelay := flag.Duration("stageDelay", 0, "pause between the write, read and other stages so the server can finish background flushing or compaction, eg: 60s")
 	skipCleanup := flag.Bool("skipCleanup", false, "skip deleting objects created by this tool at the end of the run")
+	cleanupByListing := flag.Bool("cleanupByListing", false, "clean up by deleting every object listed under objectNamePrefix, including those left by earlier runs, rather than only the keys this run wrote; implied by a generated run ID")
+	skipWrite := flag.Bool("skipWrite", false, "skip the write test and read objects already present in the bucket")
+	otlpEndpoint := flag.String("otlpEndpoint", "", "OpenTelemetry collector to export a span per operation to via OTLP/HTTP, eg: http://localhost:4318")
+	contentType := flag.String("contentType", "", "Content-Type to set on written objects, '|' separated values are used in turn")
+	cacheControl := flag.String("cacheControl", "", "Cache-Control to set on written objects, '|' separated values are used in turn")
+	contentDisposition := flag.String("contentDisposition", "", "Content-Disposition to set on written objects, '|' separated values are used in turn")
+	cacheBustQuery := flag.String("cacheBustQuery", "", "query parameter given a unique value on reads to miss the cache of a CDN, eg: nocache")
+	cacheBustPercent := flag.Float64("cacheBustPercent", 100, "percentage of the reads given cacheBustQuery, the others may be served from the cache")
+	readCacheControl := flag.String("readCacheControl", "", "Cache-Control directives to send with reads, eg: no-cache")
+	randomizeHeaders := flag.Bool("randomizeHeaders", false, "pick a random value per request for contentType, cacheControl and contentDisposition")
+	abortOnErrorRate := flag.String("abortOnErrorRate", "", "abort the run when the error rate over a rolling window exceeds a threshold, eg: 20%/30s")
+	reconcile := flag.String("reconcile", "", "instead of running tests, compare the objects of two locations, eg: source/prefix,replica/prefix")
+	requestLog := flag.String("requestLog", "", "file to log every request to as CSV, compressed when the name ends in .gz or .zst")
+	latencyLog := flag.String("latencyLog", "", "file to write a CSV row per request to as it completes: timestamp, op, key, duration, ttfb, bytes, status and error")
+	useHTTP3 := flag.Bool("http3", false, "experimental: send requests over HTTP/3 (QUIC), endpoints must be https")
+	tenantsFile := flag.String("tenants", "", "file listing the credentials of multiple tenants and their optional rate and concurrency caps and client certificates")
+	endpointMapFile := flag.String("endpointMap", "", "file routing buckets and key prefixes to the endpoints serving them, with results by shard")
+	analyzeResults := flag.Bool("analyze", false, "append plain language findings about the results to the report")
+	manifestFile := flag.String("manifest", "", "file to record the key, size, ETag and version of every object written to as CSV")
+	manifestFormat := flag.String("manifestFormat", manifestCSV, "format of the manifest: csv, or inventory for the CSV schema of S3 Inventory reports with a manifest.json beside it")
+	quiet := flag.String("quiet", "", "periods without load during each test, recovery latency after each is reported, eg: \"every 30m for 2m\"")
+	keepWarm := flag.Bool("keepWarm", false, "keep connections open during quiet periods with a HEAD request per client every 5s")
+	timingHeaders := flag.String("serverTimingHeader", "", "comma separated response headers carrying the server processing time in ms, used when Server-Timing is absent, eg: x-envoy-upstream-service-time")
+	batchOperation := flag.String("batchOperation", "", "after the tests, run an S3 Batch Operations job over the test objects: tagging|restore")
+	accountID := flag.String("accountId", "", "AWS account ID owning the Batch Operations job")
+	batchRoleArn := flag.String("batchRoleArn", "", "IAM role assumed by the Batch Operations job")
+	batchTags := flag.String("batchTags", "s3bench=batch", "tags applied by the tagging job, eg: key=value,key=value")
+	restoreDays := flag.Int64("restoreDays", 1, "number of days restored objects remain available")
+	batchPollInterval := flag.Duration("batchPollInterval", 10*time.Second, "interval at which the Batch Operations job status is polled")
+	batchTimeout := flag.Duration("batchTimeout", 6*time.Hour, "how long to wait for the Batch Operations job to finish before reporting it timed out and leaving it running, 0 for no limit")
+	caCert := flag.String("caCert", "", "PEM file of CA certificates to trust on top of the system's, for endpoints with certificates of a private CA")
+	clientCert := flag.String("clientCert", "", "PEM file of the client certificate presented for mutual TLS, along with clientKey")
+	clientKey := flag.String("clientKey", "", "PEM file of the private key of clientCert")
+	insecureSkipTLSVerify := flag.Bool("insecureSkipTLSVerify", false, "do not verify the certificates of the endpoints, for lab setups only")
+	verifyETag := flag.Bool("verifyETag", false, "check that reads get the ETag returned when the object was written, or listed by readManifest, failing those which do not")
+	checkETagFormat := flag.Bool("checkETagFormat", false, "check whether the ETags of writes are the MD5 of the data, or for multipart writes the MD5 of the part MD5s followed by the number of parts, reporting how many conform")
+	verifyContent := flag.Bool("verifyContent", false, "give every object data of its own derived from its key, and compare all the data read with it rather than only its length")
+	checksum := flag.String("checksum", checksumNone, "payload checksum of writes, verified by reads: none, md5 (Content-MD5, checked against the ETag), sha256 or crc32c (flexible checksums)")
+	signedPayload := flag.Bool("signedPayload", false, "sign the payload of writes with its SHA256, computed once per distinct payload, instead of sending it unsigned")
+	maxRetries := flag.Int("maxRetries", retry.DefaultMaxAttempts-1, "number of times a failed request is retried")
+	retryMode := flag.String("retryMode", retryStandard, "how failed requests are retried: standard, with exponential backoff, or adaptive, also slowing requests down while throttled")
+	maxBackoff := flag.Duration("maxBackoff", retry.DefaultMaxBackoff, "longest backoff before retrying a request")
+	proxyURL := flag.String("proxy", "", "HTTP proxy to send requests through, host:port, instead of that of the HTTP_PROXY and HTTPS_PROXY environment variables")
+	socksProxy := flag.String("socksProxy", "", "SOCKS5 proxy to send requests through, host:port")
+	poolPerOp := flag.Bool("poolPerOp", false, "send writes, reads and other requests on separate HTTP connection pools, so that large uploads can not hold up small reads")
+	sourcePorts := flag.String("sourcePorts", "", "local port ranges the connection pools of poolPerOp connect from, eg: write=20000-20999,read=21000-21999, implies poolPerOp")
+	disableTLSResumption := flag.Bool("disableTLSResumption", false, "perform a full TLS handshake for every new connection instead of resuming sessions")
+	readManifest := flag.String("readManifest", "", "read the exact keys and versions listed in a manifest instead of writing objects first")
+	repair := flag.Bool("repair", false, "after the read test, write the objects whose reads failed verification again and read them back, reporting how many were repaired")
+	findMaxRate := flag.Bool("findMaxRate", false, "instead of the read test, search for the highest read rate meeting latencyTarget")
+	latencyTarget := flag.String("latencyTarget", "p99<100ms", "latency percentile bound used by findMaxRate, when given also the bound each test must meet for the webhook to report a pass")
+	probeDuration := flag.Duration("probeDuration", 10*time.Second, "how long findMaxRate reads at each rate")
+	probeStartRate := flag.Float64("probeStartRate", 10, "first read rate in ops/s tried by findMaxRate")
+	rateLimit := flag.Float64("rateLimit", 0, "most operations per second sent by all clients together, 0 for as many as the clients can sustain")
+	deleteBatchSize := flag.Int("deleteBatchSize", commitSize, "number of objects deleted per DeleteObjects request during the delete test and cleanup, at most 1000, 1 for a DeleteObject request per object")
+	var checkpointEvery countFlag
+	flag.Var(&checkpointEvery, "checkpointEvery", "during the write test, benchmark reads, HEADs and listings every this many objects written, eg: 1M")
+	checkpointSamples := countFlag(100)
+	flag.Var(&checkpointSamples, "checkpointSamples", "number of reads, HEADs and listings of each checkpoint")
+	readAfterWrite := flag.Bool("readAfterWrite", false, "during the write test, poll every object written with GETs until it is readable with the data written, measuring the delay")
+	readAfterWriteEndpoint := flag.String("readAfterWriteEndpoint", "", "endpoint readAfterWrite polls objects from, the one which wrote them by default, eg: http://replica:9000")
+	readAfterWritePoll := flag.Duration("readAfterWritePoll", 10*time.Millisecond, "interval between the polls of an object not yet readable")
+	readAfterWriteTimeout := flag.Duration("readAfterWriteTimeout", 30*time.Second, "time after which an object not yet readable is reported as never readable")
+	listObj := flag.Bool("listObj", false, "after the read test, run a list test listing objectNamePrefix in full listRepeat times with ListObjectsV2")
+	listRepeat := countFlag(10)
+	flag.Var(&listRepeat, "listRepeat", "number of full listings of the list test, up to numClients of them at a time")
+	listMaxKeys := countFlag(1000)
+	flag.Var(&listMaxKeys, "listMaxKeys", "most keys per page of the list test")
+	listDelimiter := flag.String("listDelimiter", "", "delimiter of the listings of the list test, eg: /")
+	listStartAfter := flag.String("listStartAfter", "", "key after which the listings of the list test start")
+	var bucketCycles countFlag
+	flag.Var(&bucketCycles, "bucketCycles", "after the list test, run a bucket cycle test creating and deleting this many buckets, up to numClients at a time, to measure bucket provisioning")
+	bucketCyclePrefix := flag.String("bucketCyclePrefix", "s3bench-cycle-", "prefix of the buckets of the bucket cycle test, followed by a token unique to the run and the bucket number")
+	policyStatements := flag.String("policyStatements", "", "after the read test, read the objects as the benchmark's principal and as deniedAccessKey under bucket policies of these numbers of statements, eg: 0,10,100")
+	deniedAccessKey := flag.String("deniedAccessKey", "", "access key of a principal the bucket policy denies reads, for policyStatements")
+	deniedAccessSecret := flag.String("deniedAccessSecret", "", "secret key of deniedAccessKey")
+	copyObj := flag.Bool("copyObj", false, "after the read test, run a copy test copying every object server-side with CopyObject")
+	copyTo := flag.String("copyTo", "", "bucket/prefix the copy test copies objects to, replacing objectNamePrefix in their names, copies/ under objectNamePrefix when empty")
+	putObjAcl := flag.Bool("putObjAcl", false, "after the read and copy tests, run a test setting a canned ACL of objAcls on every object with PutObjectAcl")
+	getObjAcl := flag.Bool("getObjAcl", false, "after the read and copy tests, run a test reading the ACL of every object with GetObjectAcl")
+	objAcls := flag.String("objAcls", string(types.ObjectCannedACLPrivate), "comma separated canned ACLs the putObjAcl test cycles through, eg: private,public-read")
+	var versions countFlag
+	flag.Var(&versions, "versions", "after the other tests, enable versioning on the bucket and write this many versions of every object, then read given versions, list them with ListObjectVersions and create delete markers")
+	deleteObj := flag.Bool("deleteObj", false, "run a delete test over the objects written after the other tests, instead of only deleting them during cleanup")
+	deleteBatchDelay := flag.Duration("deleteBatchDelay", 0, "pause between DeleteObjects requests during cleanup")
+	deleteRate := flag.Float64("deleteRate", 0, "most objects deleted per second during cleanup, 0 for no limit")
+	presigned := flag.Bool("presigned", false, "send the writes and reads as plain HTTP requests to presigned URLs generated before each test, instead of signed SDK calls")
+	presignExpires := flag.Duration("presignExpires", time.Hour, "validity of the presigned URLs, at most 168h, URLs about to expire are generated again")
+	sse := flag.String("sse", "", "request server-side encryption of the objects written, AES256 or aws:kms, and check reads return it")
+	kmsKeyID := flag.String("kmsKeyId", "", "KMS key ID, ARN or alias the objects are encrypted with under sse aws:kms, the bucket's default key when empty")
+	sseCustomerKey := flag.String("sseCustomerKey", "", "encrypt the objects written with this customer-provided key (SSE-C), base64 encoded 256 bits, and supply it to every request on them")
+	rangeRead := flag.String("rangeRead", "", "read a range of each object instead of all of it: size[,fixed|random|sequential] for ranges from the start of the object, at random offsets or walking through it, eg: 64KiB,random")
+	accessPattern := flag.String("accessPattern", accessSequential, "order in which the read test targets objects: sequential, uniform, zipfian[:EXPONENT] or hotspot:N% (90% of reads to N% of the objects)")
+	captureHeaders := flag.Int("captureHeaders", 0, "include the response headers of the first and last N requests of each test in the results")
+	objectSizeDist := flag.String("objectSizeDist", "", "vary object sizes instead of using objectSize: uniform:4KiB-16MiB, lognormal:MEDIAN,SIGMA or weighted SIZE:WEIGHT pairs like 4KiB:70,1MiB:30")
+	objectSizeJitter := flag.String("objectSizeJitter", "", "vary object sizes around objectSize: 10% spreads them uniformly within 10% of it, 10%,normal normally with a standard deviation of 10% of it")
+	numMetadata := flag.Int("numMetadata", 0, "number of user metadata entries attached to every object written and checked by reads and HEAD requests")
+	metadataValueSize := sizeFlag(16)
+	flag.Var(&metadataValueSize, "metadataValueSize", "size of the value of each user metadata entry of numMetadata")
+	var multipartSize sizeFlag
+	flag.Var(&multipartSize, "multipartSize", "upload objects larger than this size as multipart uploads with parts of this size, 0 to disable")
+	multipartConcurrency := flag.Int("multipartConcurrency", 4, "number of parts of a multipart upload sent in parallel")
+	keyCharset := flag.String("keyCharset", keyCharsetASCII, "characters used in object names: ascii, unicode, or special for spaces, '+', '%' and 1024 byte names")
+	trafficClass := flag.String("trafficClass", "", "label of the traffic of this instance, sent in the X-S3bench-Traffic-Class header and User-Agent of every request and logged with each in requestLog")
+	runID := flag.String("runID", "", "namespace added to object names so concurrent runs do not collide, generated when empty")
+	noRunID := flag.Bool("noRunID", false, "use objectNamePrefix as is, without a run ID")
+	commit := flag.Bool("commit", false, "after the write test, run a commit test writing each object under _temporary/ then promoting it to committed/ with a copy and a delete, as S3 committers do")
+	linkSpeed := flag.String("linkSpeed", "", "bandwidth of the client's network link, eg: 25Gb, to report throughput as a percentage of it")
+	influxURL := flag.String("influxURL", "", "InfluxDB server to stream throughput and latency points to during the tests, eg: http://influx:8086")
+	influxDB := flag.String("influxDB", "", "InfluxDB database written to with influxURL")
+	influxTags := flag.String("influxTags", "", "tags added to every InfluxDB point, eg: firmware=1.2,cluster=lab")
+	influxInterval := flag.Duration("influxInterval", 10*time.Second, "interval covered by each InfluxDB point")
+	churn := flag.Duration("churn", 0, "after the other tests, write and delete numSamples keys at full rate for this long while listing them in the background, counting keys missing from or lingering in listings")
+	searchTag := flag.String("searchTag", "", "after the write test, run a search test listing objectNamePrefix and examining every object for this key=value tag, which the write test sets on searchMatch% of objects")
+	searchBy := flag.String("searchBy", searchByTagging, "how the search test examines objects: tagging (GetObjectTagging) or metadata (HEAD of user metadata)")
+	searchQueries := flag.Int("searchQueries", 5, "number of queries run by the search test")
+	searchMatch := flag.Float64("searchMatch", 10, "percentage of written objects given the searched value")
+	availabilityTarget := flag.Float64("availabilityTarget", 0, "availability in percent of operations succeeding the run must reach, reported in the totals with the error budget it allows, eg: 99.95")
+	pricePerGB := flag.Float64("pricePerGB", 0, "price per GB written or read, for the cost estimate")
+	pricePerRequest := flag.Float64("pricePerRequest", 0, "price per request of any kind, for the cost estimate")
+	priceStorage := flag.Float64("priceStoragePerGBMonth", 0, "price of storing a GB for a month, for the cost estimate")
+	pricePer1kPut := flag.Float64("pricePer1kPut", 0, "price per 1000 PUT, COPY or LIST requests, for the cost estimate")
+	pricePer1kGet := flag.Float64("pricePer1kGet", 0, "price per 1000 GET or HEAD requests, for the cost estimate")
+	priceEgress := flag.Float64("priceEgressPerGB", 0, "price per GB read out of the store, for the cost estimate")
+	webhook := flag.String("webhook", "", "URL to post a JSON summary of the run to when it completes or is aborted, eg: a Slack incoming webhook")
+	workload := flag.String("workload", "", "JSON file of flags and a matrix of flag values to run every combination of")
+	var outputs outputSpecs
+	flag.Var(&outputs, "output", "where to report results, repeatable: console, json:FILE, csv:FILE, prometheus:FILE, influxdb:URL or sqlite:FILE (default console)")
+	canary := flag.Bool("canary", false, "instead of running tests, probe the bucket with a PUT, GET and HEAD of a tiny object every canaryInterval until interrupted, only GET and HEAD with skipWrite")
+	canaryKey := flag.String("canaryKey", "", "object probed by canary, objectNamePrefix followed by canary when empty")
+	canaryInterval := flag.Duration("canaryInterval", 5*time.Second, "interval between canary probes")
+	canaryMaxLatency := flag.Duration("canaryMaxLatency", time.Second, "canary probes slower than this are a breach")
+	canaryMaxErrors := flag.Int("canaryMaxErrors", 0, "most failed canary probes per statsInterval before it is a breach")
+	canaryWebhook := flag.String("canaryWebhook", "", "URL to post a JSON alert to when a canary breach starts and ends, instead of exiting with an error on the first breach")
+	simulate := flag.Bool("simulate", false, "run against an in-memory S3 started by the benchmark instead of an endpoint, with objects of 1MiB unless objectSize is given")
+	perClientStats := flag.Bool("perClientStats", false, "report the operations, throughput and latency of every client to spot stalled or unbalanced clients")
+	live := flag.Bool("live", false, "redraw a dashboard of rolling stats in place every second instead of printing progress lines")
+	statsInterval := flag.Duration("statsInterval", 10*time.Second, "interval at which to print progress and ETA, 0 to disable")
+	timelineInterval := flag.Duration("timelineInterval", time.Second, "length of the buckets of throughput and operation times exported over the course of each test, 0 to disable")
+	statsWindow := flag.Duration("statsWindow", 30*time.Second, "period over which the percentiles printed with progress are computed")
+	statsMode := flag.String("statsMode", statsModeSketch, "how operation times are kept for the results: sketch in histograms to three significant digits whose memory does not grow with the number of operations, or exact to keep every one")
 	verbose := flag.Bool("verbose", false, "print verbose per thread status")
 
 	flag.Parse()
 
-	if *numClients > *numSamples || *numSamples < 1 {
-		fmt.Printf("numClients(%d) needs to be less than numSamples(%d) and greater than 0\n", *numClients, *numSamples)
+	if *workload != "" {
+		if !RunWorkload(*workload, commandLineArgs("workload")) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	var readManifestEntries []ManifestEntry
+	if *readManifest != "" {
+		var err error
+		readManifestEntries, err = LoadManifest(*readManifest)
+		if err != nil {
+			fmt.Printf("Could not read readManifest: %v\n", err)
+			os.Exit(1)
+		}
+		// Reading a manifest is a read-only run, by default over every entry
+		*skipWrite = true
+		if !flagIsSet("numSamples") {
+			numSamples = countFlag(len(readManifestEntries))
+		}
+	}
+
+	if *duration < 0 || *stageDelay < 0 {
+		fmt.Println("duration and stageDelay need to be greater than 0")
+		os.Exit(1)
+	}
+	if (*duration == 0 && *numClients > int(numSamples)) || numSamples < 1 || *numClients < 1 {
+		fmt.Printf("numClients(%d) needs to be less than numSamples(%d) and greater than 0\n", *numClients, numSamples)
 		os.Exit(1)
 	}
 
+	buckets, err := parseBuckets(*bucketName, *numBuckets)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *statsMode != statsModeSketch && *statsMode != statsModeExact {
+		fmt.Printf("Invalid statsMode %q, expected %s or %s\n", *statsMode, statsModeSketch, statsModeExact)
+		os.Exit(1)
+	}
+	exactStats = *statsMode == statsModeExact
+	if *bucketSpread != bucketSpreadRoundRobin && *bucketSpread != bucketSpreadHash {
+		fmt.Printf("Invalid bucketSpread %q, expected %s or %s\n", *bucketSpread, bucketSpreadRoundRobin, bucketSpreadHash)
+		os.Exit(1)
+	}
+	if *numBuckets > 0 {
+		*createBucket = true
+	}
+	if *simulate {
+		// The simulated S3 keeps objects in memory, where the default
+		// 200 objects of 80MiB would take 16GB
+		if !flagIsSet("objectSize") {
+			objectSize = sizeFlag(simulatedObjectSize)
+		}
+		buckets := append([]string(nil), buckets...)
+		for _, location := range strings.Split(*reconcile, ",") {
+			if location != "" {
+				buckets = append(buckets, parseBucketPrefix(location).bucket)
+			}
+		}
+		if *copyTo != "" {
+			buckets = append(buckets, parseBucketPrefix(*copyTo).bucket)
+		}
+		simulated, err := StartSimulatedS3(buckets...)
+		if err != nil {
+			fmt.Printf("Could not start simulated S3: %v\n", err)
+			os.Exit(1)
+		}
+		defer simulated.Close()
+		*endpoint = simulated.Endpoint()
+		if *accessKey == "" && *tenantsFile == "" && !*anonymous {
+			*accessKey, *accessSecret = "simulated", "simulated"
+		}
+	}
+
 	if *endpoint == "" {
 		fmt.Println("You need to specify endpoint(s)")
 		flag.PrintDefaults()
@@ -55,207 +297,2138 @@ func main() {
 
 	// Setup and print summary of the accepted parameters
 	params := Params{
-		requests:         make(chan Req),
-		responses:        make(chan Resp),
-		numSamples:       *numSamples,
-		numClients:       uint(*numClients),
-		objectSize:       *objectSize,
-		objectNamePrefix: *objectNamePrefix,
-		bucketName:       *bucketName,
-		endpoints:        strings.Split(*endpoint, ","),
-		verbose:          *verbose,
+		requests:           make(chan Req),
+		clockOffset:        &ClockOffsetTracker{},
+		responses:          make(chan Resp),
+		numSamples:         int(numSamples),
+		duration:           *duration,
+		stageDelay:         *stageDelay,
+		multipartSize:      int64(multipartSize),
+		keyCharset:         *keyCharset,
+		captureHeaders:     *captureHeaders,
+		deleteBatchSize:    *deleteBatchSize,
+		deleteObj:          *deleteObj,
+		deleteBatchDelay:   *deleteBatchDelay,
+		deleteRate:         *deleteRate,
+		numClients:         uint(*numClients),
+		objectSize:         int64(objectSize),
+		objectNamePrefix:   *objectNamePrefix,
+		bucketName:         buckets[0],
+		buckets:            buckets,
+		bucketSpread:       *bucketSpread,
+		endpoints:          strings.Split(*endpoint, ","),
+		verbose:            *verbose,
+		skipWrite:          *skipWrite,
+		commit:             *commit,
+		statsInterval:      *statsInterval,
+		live:               *live,
+		perClientStats:     *perClientStats,
+		timelineInterval:   *timelineInterval,
+		statsWindow:        *statsWindow,
+		contentType:        parseHeaderVariants(*contentType),
+		cacheControl:       parseHeaderVariants(*cacheControl),
+		contentDisposition: parseHeaderVariants(*contentDisposition),
+		randomizeHeaders:   *randomizeHeaders,
+		addressingStyle:    *addressingStyle,
+	}
+	if *signedPayload {
+		params.payloadHashes = NewPayloadHashes(sha256.New)
+	}
+	if readManifestEntries != nil {
+		params.useManifest(readManifestEntries)
+	}
+	if *repair && (params.skipWrite || params.readManifest != nil) {
+		fmt.Println("repair needs the data written by the run, it can not be used with skipWrite or readManifest")
+		os.Exit(1)
+	}
+	params.repair = *repair
+	if !*noRunID && !params.skipWrite {
+		// Objects written by this run live under their own prefix, and
+		// requests carry the run ID so that server logs can attribute them
+		params.runID = *runID
+		if params.runID == "" {
+			// Nobody else can have written under a fresh run ID, so cleanup
+			// may delete whatever is listed there
+			*cleanupByListing = true
+			params.runID, err = newRunID()
+			if err != nil {
+				fmt.Printf("Could not generate a run ID: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		params.objectNamePrefix += params.runID + "/"
+	}
+	if *cleanupByListing && (params.skipWrite || params.objectNamePrefix == "") {
+		fmt.Println("cleanupByListing needs an objectNamePrefix and can not be used with skipWrite, objects are never deleted at the end of a read-only run")
+		os.Exit(1)
+	}
+	if params.deleteBatchSize < 1 || params.deleteBatchSize > commitSize || params.deleteRate < 0 {
+		fmt.Printf("deleteBatchSize needs to be between 1 and %d and deleteRate can not be negative\n", commitSize)
+		os.Exit(1)
+	}
+	if *copyObj {
+		params.copy = params.parseCopyDestination(*copyTo)
+	}
+	if *listObj {
+		if listRepeat < 1 || listMaxKeys < 1 || listMaxKeys > math.MaxInt32 {
+			fmt.Println("listRepeat and listMaxKeys need to be greater than 0, and listMaxKeys at most 2147483647")
+			os.Exit(1)
+		}
+		params.list = &ListParams{
+			maxKeys:    int32(listMaxKeys),
+			delimiter:  *listDelimiter,
+			startAfter: *listStartAfter,
+			repeat:     int(listRepeat),
+		}
+	}
+	var policyBench *PolicyBench
+	if *policyStatements != "" {
+		statements, err := ParsePolicyStatements(*policyStatements)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if *deniedAccessKey == "" || *deniedAccessSecret == "" {
+			fmt.Println("policyStatements needs deniedAccessKey and deniedAccessSecret")
+			os.Exit(1)
+		}
+		policyBench = &PolicyBench{statements: statements}
+	}
+	if !validTrafficClass(*trafficClass) {
+		fmt.Printf("Invalid trafficClass %q, expected letters, digits, '.', '_' or '-'\n", *trafficClass)
+		os.Exit(1)
+	}
+	params.trafficClass = *trafficClass
+	if checkpointSamples < 1 {
+		fmt.Println("checkpointSamples needs to be greater than 0")
+		os.Exit(1)
+	}
+	if *readAfterWrite {
+		if params.skipWrite {
+			fmt.Println("readAfterWrite polls the objects of the write test, it can not be used with skipWrite")
+			os.Exit(1)
+		}
+		if *readAfterWritePoll <= 0 || *readAfterWriteTimeout <= 0 {
+			fmt.Println("readAfterWritePoll and readAfterWriteTimeout need to be greater than 0")
+			os.Exit(1)
+		}
+		params.readAfterWrite = NewReadAfterWrite(*readAfterWriteEndpoint, *readAfterWritePoll, *readAfterWriteTimeout)
+	} else if *readAfterWriteEndpoint != "" {
+		fmt.Println("readAfterWriteEndpoint needs readAfterWrite")
+		os.Exit(1)
+	}
+	if params.deleteObj && params.skipWrite && !params.commit {
+		fmt.Println("deleteObj only deletes objects written by the run, it can not be used with skipWrite")
+		os.Exit(1)
+	}
+	if versions > 0 && (params.skipWrite || params.deleteObj) {
+		fmt.Println("versions can not be used with skipWrite or deleteObj")
+		os.Exit(1)
+	} else if versions > 0 {
+		params.versioned = NewVersioned(int(versions))
+	}
+	if *accessPattern != accessSequential {
+		params.accessPattern, err = ParseAccessPattern(*accessPattern)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *rangeRead != "" {
+		params.rangeRead, err = ParseRangeRead(*rangeRead)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *rateLimit < 0 {
+		fmt.Println("rateLimit needs to be greater than or equal to 0")
+		os.Exit(1)
+	} else if *rateLimit > 0 {
+		params.rateLimit = NewRateLimiter(*rateLimit)
+	}
+	if *objectSizeDist != "" && *objectSizeJitter != "" {
+		fmt.Println("objectSizeDist and objectSizeJitter can not be used together")
+		os.Exit(1)
+	}
+	if *objectSizeDist != "" {
+		params.sizeDist, err = ParseSizeDistribution(*objectSizeDist)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	} else if *objectSizeJitter != "" {
+		params.sizeDist, err = ParseSizeJitter(params.objectSize, *objectSizeJitter)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if datasetSize > 0 {
+		if flagIsSet("numSamples") || params.readManifest != nil {
+			fmt.Println("datasetSize sets numSamples, it can not be used with numSamples or readManifest")
+			os.Exit(1)
+		}
+		params.numSamples = params.samplesForDataset(int64(datasetSize))
+		if params.duration == 0 && int(params.numClients) > params.numSamples {
+			fmt.Printf("numClients(%d) needs to be less than the %d objects of datasetSize\n", params.numClients, params.numSamples)
+			os.Exit(1)
+		}
+	}
+	if params.addressingStyle != addressingPath && params.addressingStyle != addressingVirtual {
+		fmt.Printf("Invalid addressingStyle %q, expected %s or %s\n", params.addressingStyle, addressingPath, addressingVirtual)
+		os.Exit(1)
+	}
+	if *simulate && params.addressingStyle == addressingVirtual {
+		fmt.Println("The simulated S3 only serves path style requests")
+		os.Exit(1)
+	}
+	if *simulate && (versions > 0 || *policyStatements != "") {
+		fmt.Println("The simulated S3 does not keep versions or bucket policies, versions and policyStatements can not be used with simulate")
+		os.Exit(1)
+	}
+	if _, ok := keyVariants[params.keyCharset]; !ok {
+		fmt.Printf("Invalid keyCharset %q, expected ascii, unicode or special\n", params.keyCharset)
+		os.Exit(1)
+	}
+	if params.multipartSize > 0 {
+		// S3 allows at most 10000 parts, all but the last of at least 5 MB
+		if *multipartConcurrency < 1 || (params.objectSize+params.multipartSize-1)/params.multipartSize > 10000 {
+			fmt.Println("multipartConcurrency needs to be greater than 0 and objects can have at most 10000 parts")
+			os.Exit(1)
+		}
+		params.multipartConcurrency = *multipartConcurrency
+	}
+	if params.duration > 0 && params.skipWrite {
+		// A timed read-only run cycles over the first numSamples objects
+		params.numKeys = params.numSamples
+	}
+	if *cacheBustQuery != "" || *readCacheControl != "" {
+		if *cacheBustPercent < 0 || *cacheBustPercent > 100 {
+			fmt.Println("cacheBustPercent needs to be between 0 and 100")
+			os.Exit(1)
+		}
+		params.cdn = &CDNParams{bustQuery: *cacheBustQuery, bustPercent: *cacheBustPercent, cacheControl: *readCacheControl}
+	}
+	if *legacyKeyFormats != "" {
+		params.legacyKeyFormats, err = ParseLegacyKeyFormats(*legacyKeyFormats)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *timingHeaders != "" {
+		params.timingHeaders = strings.Split(*timingHeaders, ",")
+	}
+	if *tenantsFile != "" {
+		tenants, err := LoadTenants(*tenantsFile)
+		if err == nil {
+			params.tenants, err = assignTenants(tenants, *numClients)
+		}
+		if err != nil {
+			fmt.Printf("Invalid tenants: %v\n", err)
+			os.Exit(1)
+		}
+		params.numClients = uint(len(params.tenants))
+	}
+	if *endpointMapFile != "" {
+		params.endpointMap, err = LoadEndpointMap(*endpointMapFile)
+		if err != nil {
+			fmt.Printf("Invalid endpointMap: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if len(buckets) > 1 && (params.list != nil || versions > 0 || *searchTag != "" || params.commit || *copyObj || *churn > 0 ||
+		*batchOperation != "" || *reconcile != "" || params.readManifest != nil || *manifestFile != "" || checkpointEvery > 0 ||
+		*policyStatements != "" || *canary) {
+		fmt.Println("Several buckets can not be used with listObj, versions, searchTag, commit, copyObj, churn, batchOperation,\n" +
+			"reconcile, readManifest, manifest, checkpointEvery, policyStatements or canary")
+		os.Exit(1)
+	}
+	if *presigned && (params.endpointMap != nil || params.tenants != nil || params.multipartSize > 0 || *checksum != checksumNone ||
+		*numMetadata != 0) {
+		fmt.Println("presigned can not be used with endpointMap, tenants, multipartSize, checksum or numMetadata")
+		os.Exit(1)
+	}
+	if *startAt != "" {
+		params.startAt, err = time.Parse(time.RFC3339Nano, *startAt)
+		if err != nil {
+			fmt.Printf("Invalid startAt %q, expected an RFC 3339 time, eg: 2024-06-01T12:00:00Z\n", *startAt)
+			os.Exit(1)
+		}
+		if time.Until(params.startAt) <= 0 {
+			fmt.Printf("startAt %s has already passed\n", *startAt)
+			os.Exit(1)
+		}
+	}
+	if !validChecksum(*checksum) {
+		fmt.Printf("Invalid checksum %q, expected %s, %s, %s or %s\n", *checksum, checksumNone, checksumMD5, checksumSHA256, checksumCRC32C)
+		os.Exit(1)
+	}
+	params.checksum = *checksum
+	params.verifyContent = *verifyContent
+	if *checkETagFormat {
+		params.etagMD5s = NewPayloadHashes(md5.New)
+	}
+	if *verifyETag {
+		params.etags = make(ETags)
+		for _, entry := range params.readManifest {
+			if entry.etag != "" {
+				params.etags[etagKey(entry.key, entry.versionID)] = strings.Trim(entry.etag, `"`)
+			}
+		}
+	}
+	if *putObjAcl {
+		params.objAcls, err = ParseCannedACLs(*objAcls)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	params.getObjAcl = *getObjAcl
+	params.streamStages = *streamStages
+	if *sourcePorts != "" {
+		params.sourcePorts, err = ParseSourcePorts(*sourcePorts)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *poolPerOp || params.sourcePorts != nil {
+		params.pools = make(map[string]aws.HTTPClient)
+	}
+	if *sse != "" || *kmsKeyID != "" || *sseCustomerKey != "" {
+		params.sse, err = ParseSSE(*sse, *kmsKeyID, *sseCustomerKey)
+		if err != nil {
+			fmt.Printf("Invalid sse: %v\n", err)
+			os.Exit(1)
+		}
+		if *presigned {
+			fmt.Println("sse and sseCustomerKey can not be used with presigned")
+			os.Exit(1)
+		}
+	}
+	if *abortOnErrorRate != "" {
+		params.errorRate, err = ParseErrorRateMonitor(*abortOnErrorRate)
+		if err != nil {
+			fmt.Printf("Invalid abortOnErrorRate: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *otlpEndpoint != "" {
+		params.tracer = NewSpanExporter(*otlpEndpoint)
+	}
+	if *batchOperation != "" {
+		if *batchOperation != batchOpTagging && *batchOperation != batchOpRestore {
+			fmt.Printf("Invalid batchOperation %q, expected %s or %s\n", *batchOperation, batchOpTagging, batchOpRestore)
+			os.Exit(1)
+		}
+		if *accountID == "" || *batchRoleArn == "" {
+			fmt.Println("batchOperation needs accountId and batchRoleArn")
+			os.Exit(1)
+		}
+		params.batchJob = &BatchJobParams{
+			operation:    *batchOperation,
+			accountID:    *accountID,
+			roleArn:      *batchRoleArn,
+			pollInterval: *batchPollInterval,
+			timeout:      *batchTimeout,
+			restoreDays:  *restoreDays,
+		}
+		params.batchJob.tags, err = parseTags(*batchTags)
+		if err != nil {
+			fmt.Printf("Invalid batchTags: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *quiet != "" {
+		params.quiet, err = ParseQuietSchedule(*quiet)
+		if err != nil {
+			fmt.Printf("Invalid quiet: %v\n", err)
+			os.Exit(1)
+		}
+		params.keepWarm = *keepWarm
+	} else if *keepWarm {
+		fmt.Println("keepWarm needs quiet periods")
+		os.Exit(1)
+	}
+	if *manifestFile != "" {
+		encryption := "NOT-SSE"
+		if params.sse != nil {
+			encryption = params.sse.inventoryStatus()
+		}
+		params.manifest, err = CreateManifest(*manifestFile, *manifestFormat, params.bucketName, encryption)
+		if err != nil {
+			fmt.Printf("Could not create manifest: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *linkSpeed != "" {
+		params.linkSpeed, err = parseLinkSpeed(*linkSpeed)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *numMetadata != 0 {
+		params.metadata, err = NewUserMetadata(*numMetadata, int64(metadataValueSize))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if bucketCycles != 0 {
+		params.bucketCycle, err = ParseBucketCycleParams(*bucketCyclePrefix, int(bucketCycles), params.runID)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *searchTag != "" {
+		params.search, err = ParseSearchParams(*searchTag, *searchBy, *searchQueries, *searchMatch)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *availabilityTarget < 0 || *availabilityTarget > 100 {
+		fmt.Printf("Invalid availabilityTarget %g, expected a percentage, eg: 99.95\n", *availabilityTarget)
+		os.Exit(1)
+	}
+	target, err := ParseLatencyTarget(*latencyTarget)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	// An explicit latency target also decides whether the run passed
+	var passTarget *LatencyTarget
+	if flagIsSet("latencyTarget") {
+		passTarget = &target
+	}
+	var rateSearch *RateSearch
+	if *findMaxRate {
+		if *probeStartRate <= 0 || *probeDuration <= 0 {
+			fmt.Println("probeStartRate and probeDuration need to be greater than 0")
+			os.Exit(1)
+		}
+		rateSearch = &RateSearch{target: target, probeDuration: *probeDuration, startRate: *probeStartRate}
+	}
+	var canaryProbe *Canary
+	if *canary {
+		key := *canaryKey
+		if key == "" {
+			key = params.objectNamePrefix + "canary"
+		}
+		canaryProbe, err = NewCanary(key, *canaryInterval, *statsInterval, *canaryMaxLatency, *canaryMaxErrors, *canaryWebhook, *skipWrite)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	if len(outputs) == 0 {
+		outputs = outputSpecs{"console"}
+	}
+	var sinks []OutputSink
+	for _, spec := range outputs {
+		sink, err := OpenOutputSink(spec)
+		if err != nil {
+			fmt.Printf("Invalid output: %v\n", err)
+			os.Exit(1)
+		}
+		sinks = append(sinks, sink)
+	}
+	if *influxURL != "" {
+		params.influx, err = NewInfluxWriter(*influxURL, *influxDB, *influxTags, *influxInterval)
+		if err != nil {
+			fmt.Printf("Invalid InfluxDB settings: %v\n", err)
+			os.Exit(1)
+		}
+		// The final results are written along with the interval points
+		outputs = append(outputs, "influxdb:"+params.influx.url)
+		sinks = append(sinks, &influxSink{url: params.influx.url, token: params.influx.token, tags: params.influx.tags})
+	}
+	if *requestLog != "" {
+		params.requestLog, err = OpenRequestLog(*requestLog, *trafficClass)
+		if err != nil {
+			fmt.Printf("Could not open requestLog: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *latencyLog != "" {
+		params.latencyLog, err = OpenLatencyLog(*latencyLog)
+		if err != nil {
+			fmt.Printf("Could not open latencyLog: %v\n", err)
+			os.Exit(1)
+		}
 	}
 	fmt.Println(params)
 	fmt.Println()
+	if datasetSize > 0 {
+		fmt.Println(params.datasetPlan(int64(datasetSize)))
+	}
 
-	// Generate the data from which we will do the writting
-	fmt.Printf("Generating in-memory sample data... ")
-	timeGenData := time.Now()
-	bufferBytes = make([]byte, *objectSize, *objectSize)
-	_, err := rand.Read(bufferBytes)
+	key, secret := *accessKey, *accessSecret
+	if params.tenants != nil && key == "" {
+		// Listing and cleanup are done as the first tenant
+		key, secret = params.tenants[0].accessKey, params.tenants[0].accessSecret
+	}
+	cfg, err := loadConfig(*region, *profile, key, secret)
 	if err != nil {
-		fmt.Printf("Could not allocate a buffer")
+		fmt.Printf("Could not load AWS config: %v\n", err)
+		os.Exit(1)
+	}
+	if *anonymous {
+		if *accessKey != "" || *roleArn != "" || params.tenants != nil {
+			fmt.Println("anonymous can not be used with accessKey, roleArn or tenants")
+			os.Exit(1)
+		}
+		cfg.Credentials = aws.AnonymousCredentials{}
+	} else if *roleArn != "" {
+		assumeRole(&cfg, *roleArn, *externalID, *webIdentityTokenFile, "s3bench-"+params.runID)
+		// Fail now rather than with every request of the first test
+		if _, err := cfg.Credentials.Retrieve(context.Background()); err != nil {
+			fmt.Printf("Could not assume role %s: %v\n", *roleArn, err)
+			os.Exit(1)
+		}
+	} else if *externalID != "" || *webIdentityTokenFile != "" {
+		fmt.Println("externalId and webIdentityTokenFile need roleArn")
+		os.Exit(1)
+	}
+	cfg.Retryer, err = newRetryer(*retryMode, *maxRetries, *maxBackoff)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	tlsConfig, err := loadTLSConfig(*caCert, *clientCert, *clientKey, *insecureSkipTLSVerify)
+	if err != nil {
+		fmt.Printf("Invalid TLS options: %v\n", err)
+		os.Exit(1)
+	}
+	proxy, err := proxyFunc(*proxyURL, *socksProxy)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	transportStats := NewTransportStats()
+	transports := transportOptions{
+		http3:                *useHTTP3,
+		tlsConfig:            tlsConfig,
+		disableTLSResumption: *disableTLSResumption,
+		proxied:              *proxyURL != "" || *socksProxy != "",
+		proxy:                proxy,
+		endpoints:            params.endpoints,
+		stats:                transportStats,
+		sdkClient:            cfg.HTTPClient,
+	}
+	if params.endpointMap != nil {
+		transports.endpoints = append(params.endpointMap.endpoints(), params.endpoints...)
+	}
+	if *useHTTP3 && transports.proxied {
+		fmt.Println("HTTP/3 requests can not be sent through a proxy")
+		os.Exit(1)
+	}
+	if *useHTTP3 && params.sourcePorts != nil {
+		fmt.Println("sourcePorts can not be used with http3")
+		os.Exit(1)
+	}
+	// Requests other than writes and reads, and those of the stages outside
+	// the tests, use the pool of the config
+	cfg.HTTPClient, err = transports.newHTTPClient(params.sourcePorts[poolOther])
+	if err == nil && params.pools != nil {
+		for _, pool := range []string{poolWrite, poolRead} {
+			params.pools[pool], err = transports.newHTTPClient(params.sourcePorts[pool])
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = params.newTenantPools(transports)
+	}
+	if err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
-	fmt.Printf("Done (%s)\n", time.Since(timeGenData))
-	fmt.Println()
 
-	// Start the load clients and run a write test followed by a read test
-	cfg := &aws.Config{
-		Credentials:      credentials.NewStaticCredentials(*accessKey, *accessSecret, ""),
-		Region:           aws.String(*region),
-		S3ForcePathStyle: aws.Bool(true),
+	params.detectRegion(&cfg)
+
+	if *reconcile != "" {
+		locations := strings.Split(*reconcile, ",")
+		if len(locations) != 2 {
+			fmt.Printf("reconcile needs exactly two locations, got %q\n", *reconcile)
+			os.Exit(1)
+		}
+		params.StartClients(cfg)
+		report := params.Reconcile(locations[0], locations[1])
+		fmt.Println(report)
+		params.shutdown()
+		if !report.InSync() {
+			os.Exit(1)
+		}
+		return
 	}
+
+	// Data is generated while it is written, from a seed unique to this run
+	seed := make([]byte, 8)
+	if _, err = rand.Read(seed); err != nil {
+		fmt.Printf("Could not generate a seed: %v\n", err)
+		os.Exit(1)
+	}
+	dataSeed = binary.LittleEndian.Uint64(seed)
+
+	// Requests other than the load, such as listing and cleanup, go to the
+	// first endpoint
+	svcCfg := cfg
+	if params.tenants != nil && *accessKey == "" && params.tenants[0].pools != nil {
+		// Made as the first tenant, so presenting its certificate
+		svcCfg.HTTPClient = params.tenants[0].pools[poolOther]
+	}
+	svc := params.newS3Client(svcCfg, params.endpoints[0])
+	if *presigned {
+		clients := []*s3.Client{svc}
+		for _, endpoint := range params.endpoints[1:] {
+			clients = append(clients, params.newS3Client(cfg, endpoint))
+		}
+		params.presign, err = NewPresigner(clients, *presignExpires)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	constraint := *locationConstraint
+	if constraint == "" {
+		constraint = defaultLocationConstraint(cfg.Region, params.endpoints[0])
+	} else if constraint == locationConstraintNone {
+		constraint = ""
+	}
+	if params.bucketCycle != nil {
+		params.bucketCycle.constraint = constraint
+	}
+	if *createBucket {
+		for _, bucket := range params.buckets {
+			if err := params.createBucket(svc, bucket, constraint); err != nil {
+				fmt.Printf("Could not create bucket %s: %v\n", bucket, err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	// Versioning applies to objects written afterwards, so that those of the
+	// write test get version IDs
+	if params.versioned != nil {
+		if err := params.enableVersioning(svc); err != nil {
+			fmt.Printf("Could not enable versioning on bucket %s: %v\n", params.bucketName, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Enabled versioning on bucket %s, it can only be suspended afterwards\n", params.bucketName)
+	}
+
+	if canaryProbe != nil {
+		passed := params.RunCanary(svc, canaryProbe)
+		if params.influx != nil {
+			if err := params.influx.Close(); err != nil {
+				fmt.Printf("Failed to stream to InfluxDB: %v\n", err)
+			}
+		}
+		params.shutdown()
+		if !passed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Start the load clients and run a write test followed by a read test
 	params.StartClients(cfg)
 
-	fmt.Printf("Running %s test...\n", opWrite)
-	writeResult := params.Run(opWrite)
-	fmt.Println()
+	var results []Result
+	if params.skipWrite && params.readManifest == nil {
+		// Objects were written by someone else, so their sizes may not match
+		// objectSize; find out what is actually there before reading it back
+		fmt.Printf("Detecting sizes of existing objects... ")
+		timeDetect := time.Now()
+		numDetected, err := params.detectObjectSizes(svc)
+		if err != nil {
+			fmt.Printf("Failed (%v)\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Found %d/%d objects (%s)\n", numDetected, params.numSamples, time.Since(timeDetect))
+		if problem := params.checkExistingObjects(flagIsSet("objectSize") || params.sizeDist != nil); problem != "" {
+			fmt.Printf("%s\n", problem)
+			fmt.Printf("Write the objects first with a run of the same -bucket, -objectNamePrefix, -keyCharset\n" +
+				"and size flags using -skipCleanup -noRunID, or lower -numSamples to what exists\n")
+			os.Exit(1)
+		}
+		fmt.Println()
+	}
 
-	fmt.Printf("Running %s test...\n", opRead)
-	readResult := params.Run(opRead)
-	fmt.Println()
+	aborted := false
+	keyRoundTrip := ""
+	var checkpointReport *CheckpointReport
+	for _, op := range []string{opWrite, opCommit, opRead, opCopy, opPutAcl, opGetAcl} {
+		if (op == opWrite && params.skipWrite) || (op == opCommit && !params.commit) || (op == opCopy && params.copy == nil) ||
+			(op == opPutAcl && params.objAcls == nil) || (op == opGetAcl && !params.getObjAcl) {
+			continue
+		}
+		delay := params.settle()
+		if op == opRead && rateSearch != nil {
+			fmt.Printf("Searching for the max %s rate meeting %s...\n", op, rateSearch.target)
+			params.FindMaxRate(rateSearch)
+			fmt.Println()
+			continue
+		}
+		if params.presign != nil && (op == opWrite || op == opRead) {
+			if err := params.presignStage(op); err != nil {
+				fmt.Printf("Could not presign the URLs of the %s test: %v\n", op, err)
+				os.Exit(1)
+			}
+		}
+		fmt.Printf("Running %s test...\n", op)
+		if op == opWrite && checkpointEvery > 0 {
+			params.checkpoints = params.NewCheckpoints(svc, int(checkpointEvery), int(checkpointSamples))
+		}
+		if op == opWrite && params.readAfterWrite != nil {
+			params.readAfterWrite.Start(&params, cfg, int(params.numClients))
+		}
+		result := params.Run(op)
+		result.stageDelay = delay
+		if op == opRead && params.repair && len(result.corruptKeys) > 0 {
+			fmt.Printf("Repairing %d objects which failed verification...\n", len(result.corruptKeys))
+			params.repairObjects(svc, &result)
+		}
+		results = append(results, result)
+		params.streamStage(result)
+		if params.checkpoints != nil {
+			report := params.checkpoints.Wait()
+			checkpointReport = &report
+			params.checkpoints = nil
+		}
+		if op == opWrite && params.readAfterWrite != nil {
+			params.readAfterWrite.Wait()
+		}
+		if op == opWrite && params.keyCharset != keyCharsetASCII {
+			keyRoundTrip = params.keyRoundTripReport(svc)
+			fmt.Println(keyRoundTrip)
+		}
+		if op == opWrite && params.duration > 0 {
+			// A timed read test cycles over however many objects were written
+			params.numKeys = result.opDurations.Count() + result.numErrors
+		}
+		fmt.Println()
+		if result.aborted != "" {
+			aborted = true
+			break
+		}
+	}
+
+	if params.list != nil && !aborted {
+		delay := params.settle()
+		fmt.Printf("Running %s test...\n", opList)
+		result := params.RunList()
+		result.stageDelay = delay
+		results = append(results, result)
+		params.streamStage(result)
+		fmt.Println()
+	}
+
+	if params.bucketCycle != nil && !aborted {
+		delay := params.settle()
+		fmt.Printf("Running %s test...\n", opBucketCycle)
+		result := params.RunBucketCycle(svc)
+		result.stageDelay = delay
+		results = append(results, result)
+		params.streamStage(result)
+		fmt.Println()
+	}
+
+	var policyReport *PolicyReport
+	if policyBench != nil && !aborted {
+		deniedCfg := cfg.Copy()
+		deniedCfg.Credentials = credentials.NewStaticCredentialsProvider(*deniedAccessKey, *deniedAccessSecret, "")
+		policyBench.denied = params.newS3Client(deniedCfg, params.endpoints[0])
+		params.settle()
+		fmt.Println("Running Policy Evaluation test...")
+		report := params.RunPolicyBench(svc, policyBench)
+		policyReport = &report
+		fmt.Println()
+	}
+
+	var searchReport *SearchReport
+	if params.search != nil && !aborted {
+		params.settle()
+		fmt.Printf("Running %s test...\n", opSearch)
+		report := params.RunSearch(svc)
+		searchReport = &report
+		fmt.Println()
+	}
+
+	var churnReport *ChurnReport
+	if *churn > 0 && !aborted {
+		params.settle()
+		fmt.Printf("Running Churn test for %s...\n", *churn)
+		report := params.RunChurn(svc, *churn)
+		churnReport = &report
+		fmt.Println()
+	}
+
+	var batchReport *BatchJobReport
+	if params.batchJob != nil && !aborted {
+		keys := params.writtenKeys
+		if params.skipWrite {
+			keys = make([]string, 0, len(params.objectSizes))
+			for key := range params.objectSizes {
+				keys = append(keys, key)
+			}
+		}
+		params.settle()
+		fmt.Printf("Running Batch Operations %s job...\n", params.batchJob.operation)
+		// Batch Operations are only offered by AWS, whatever the endpoint
+		control := s3control.NewFromConfig(cfg)
+		report := params.RunBatchJob(svc, control, keys)
+		batchReport = &report
+		fmt.Println()
+	}
+
+	// The versioned workload ends with the objects deleted
+	if params.versioned != nil && !aborted {
+		versionResults := params.RunVersions()
+		results = append(results, versionResults...)
+		aborted = versionResults[len(versionResults)-1].aborted != ""
+	}
+
+	// Deleting the objects last, once no other test needs them
+	if params.deleteObj && !aborted {
+		delay := params.settle()
+		fmt.Printf("Running %s test...\n", opDelete)
+		result := params.RunDelete()
+		result.stageDelay = delay
+		results = append(results, result)
+		params.streamStage(result)
+		fmt.Println()
+		aborted = result.aborted != ""
+	}
 
 	// Repeating the parameters of the test followed by the results
-	fmt.Println(params)
-	fmt.Println()
-	fmt.Println(writeResult)
-	fmt.Println()
-	fmt.Println(readResult)
+	report := &Report{time: time.Now(), params: &params, results: results}
+	if len(results) > 0 {
+		costs := CostModel{perGB: *pricePerGB, perRequest: *pricePerRequest, storagePerGBMonth: *priceStorage,
+			per1kPut: *pricePer1kPut, per1kGet: *pricePer1kGet, egressPerGB: *priceEgress}
+		totals := computeTotals(results, time.Since(invocationStart), costs)
+		totals.Availability = computeAvailability(results, *availabilityTarget)
+		report.totals = &totals
+	}
+	if keyRoundTrip != "" {
+		report.sections = append(report.sections, keyRoundTrip)
+	}
+	if checkpointReport != nil {
+		report.sections = append(report.sections, checkpointReport.String())
+	}
+	if params.readAfterWrite != nil && params.readAfterWrite.params != nil {
+		report.sections = append(report.sections, params.readAfterWrite.String())
+	}
+	if policyReport != nil {
+		report.sections = append(report.sections, policyReport.String())
+	}
+	if params.presign != nil {
+		report.sections = append(report.sections, params.presign.String())
+	}
+	if searchReport != nil {
+		report.sections = append(report.sections, searchReport.String())
+	}
+	if churnReport != nil {
+		report.sections = append(report.sections, churnReport.String())
+	}
+	if rateSearch != nil {
+		report.sections = append(report.sections, rateSearch.String())
+	}
+	if batchReport != nil {
+		report.sections = append(report.sections, batchReport.String())
+	}
+	if params.linkSpeed > 0 && len(results) > 0 {
+		report.sections = append(report.sections, linkUtilizationReport(results, params.linkSpeed))
+	}
+	if !transportStats.empty() {
+		report.sections = append(report.sections, transportStats.String())
+	}
+	if params.clockOffset.numSamples > 0 {
+		report.sections = append(report.sections, params.clockOffset.String())
+	}
+	if *analyzeResults {
+		report.sections = append(report.sections, findingsReport(analyze(results, params.clockOffset)))
+	}
+	if params.influx != nil {
+		if err := params.influx.Close(); err != nil {
+			fmt.Printf("Failed to stream to InfluxDB: %v\n", err)
+		}
+	}
+	for i, sink := range sinks {
+		err := sink.Write(report)
+		if err == nil {
+			err = sink.Close()
+		}
+		if err != nil {
+			fmt.Printf("Failed to write output %s: %v\n", outputs[i], err)
+		}
+	}
 
-	// Do cleanup if required
-	if !*skipCleanup {
+	if *webhook != "" {
+		if err := postWebhook(*webhook, runNotification(report, passTarget)); err != nil {
+			fmt.Printf("Failed to post to webhook: %v\n", err)
+		}
+	}
+
+	// Do cleanup if required. Objects under a generated run ID are all ours,
+	// so the prefix is listed to also catch those of writes which failed
+	// after landing; a chosen run ID may be shared with another run, so
+	// objects we did not write are never deleted unless cleanupByListing asks
+	// for it.
+	if !*skipCleanup && params.versioned != nil && len(params.versioned.keys) > 0 {
+		// Deleting the keys alone would only add delete markers
+		fmt.Println()
+		objects, err := params.listVersionsOfKeys(svc)
+		if err != nil {
+			fmt.Printf("Could not list the versions to clean up: %v\n", err)
+		}
+		params.cleanupObjects(svc, params.bucketName, objects)
+	} else if !*skipCleanup && *cleanupByListing {
+		written := params.keysByBucket(params.writtenKeys)
+		for i, bucket := range params.buckets {
+			keys, err := params.listPrefix(svc, bucket)
+			if err != nil {
+				fmt.Printf("\nCould not list s3://%s/%s to clean up, deleting the objects written instead (%v)\n",
+					bucket, params.objectNamePrefix, err)
+				keys = written[i]
+			}
+			if len(keys) > 0 {
+				fmt.Println()
+				params.cleanup(svc, bucket, keys)
+			}
+		}
+	} else if !*skipCleanup && len(params.writtenKeys) > 0 {
+		for i, keys := range params.keysByBucket(params.writtenKeys) {
+			if len(keys) > 0 {
+				fmt.Println()
+				params.cleanup(svc, params.buckets[i], keys)
+			}
+		}
+	}
+	if !*skipCleanup && len(params.copiedKeys) > 0 {
 		fmt.Println()
-		fmt.Printf("Cleaning up %d objects...\n", *numSamples)
-		delStartTime := time.Now()
-		svc := s3.New(session.New(), cfg)
-
-		numSuccessfullyDeleted := 0
-
-		keyList := make([]*s3.ObjectIdentifier, 0, commitSize)
-		for i := 0; i < *numSamples; i++ {
-			bar := s3.ObjectIdentifier{
-				Key: aws.String(fmt.Sprintf("%s%d", *objectNamePrefix, i)),
-			}
-			keyList = append(keyList, &bar)
-			if len(keyList) == commitSize || i == *numSamples-1 {
-				fmt.Printf("Deleting a batch of %d objects in range {%d, %d}... ", len(keyList), i-len(keyList)+1, i)
-				params := &s3.DeleteObjectsInput{
-					Bucket: aws.String(*bucketName),
-					Delete: &s3.Delete{
-						Objects: keyList}}
-				_, err := svc.DeleteObjects(params)
-				if err == nil {
-					numSuccessfullyDeleted += len(keyList)
-					fmt.Printf("Succeeded\n")
-				} else {
-					fmt.Printf("Failed (%v)\n", err)
+		params.cleanup(svc, params.copy.bucket, params.copiedKeys)
+	}
+
+	params.shutdown()
+	if aborted {
+		os.Exit(1)
+	}
+}
+
+// Flushes the traces and closes the logs and manifest of the run, whichever
+// way it ends
+func (params *Params) shutdown() {
+	if params.tracer != nil {
+		params.tracer.Shutdown()
+	}
+	if params.requestLog != nil {
+		if err := params.requestLog.Close(); err != nil {
+			fmt.Printf("Failed to write requestLog: %v\n", err)
+		}
+	}
+	if params.latencyLog != nil {
+		if err := params.latencyLog.Close(); err != nil {
+			fmt.Printf("Failed to write latencyLog: %v\n", err)
+		}
+	}
+	if params.manifest != nil {
+		if err := params.manifest.Close(); err != nil {
+			fmt.Printf("Failed to write manifest: %v\n", err)
+		}
+	}
+}
+
+// Waits for startAt, by the local clock, which the clocks of the other
+// instances need to agree with
+func (params *Params) waitStart() {
+	wait := time.Until(params.startAt)
+	if wait <= 0 {
+		fmt.Printf("startAt %s passed %s ago during setup, starting now\n\n",
+			params.startAt.Format(time.RFC3339Nano), (-wait).Round(time.Millisecond))
+		return
+	}
+	fmt.Printf("Waiting %s to start at %s...\n\n", wait.Round(time.Millisecond), params.startAt.Format(time.RFC3339Nano))
+	time.Sleep(wait)
+}
+
+// Pauses for stageDelay before every stage but the first, so that background
+// work caused by a stage is not measured by the next, and until startAt
+// before the first. Returns the pause between stages.
+func (params *Params) settle() time.Duration {
+	params.numStages++
+	if params.numStages == 1 && !params.startAt.IsZero() {
+		params.waitStart()
+	}
+	if params.numStages == 1 || params.stageDelay == 0 {
+		return 0
+	}
+	fmt.Printf("Waiting %s for the server to settle...\n", params.stageDelay)
+	time.Sleep(params.stageDelay)
+	fmt.Println()
+	return params.stageDelay
+}
+
+// Returns the keys of bucket under objectNamePrefix
+func (params *Params) listPrefix(svc *s3.Client, bucket string) ([]string, error) {
+	var keys []string
+	pages := s3.NewListObjectsV2Paginator(svc, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(params.objectNamePrefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, *obj.Key)
+		}
+	}
+	return keys, nil
+}
+
+// Delete the given objects of bucket in batches of deleteBatchSize
+func (params *Params) cleanup(svc *s3.Client, bucket string, keys []string) {
+	objects := make([]types.ObjectIdentifier, len(keys))
+	for i, key := range keys {
+		objects[i] = types.ObjectIdentifier{Key: aws.String(key)}
+	}
+	params.cleanupObjects(svc, bucket, objects)
+}
+
+// Deletes the given objects, or versions of objects, of bucket
+func (params *Params) cleanupObjects(svc *s3.Client, bucket string, objects []types.ObjectIdentifier) {
+	numKeys := len(objects)
+	fmt.Printf("Cleaning up %d objects of %s...\n", numKeys, bucket)
+	delStartTime := time.Now()
+	lastStats := delStartTime
+	lastStatsCount := 0
+
+	numSuccessfullyDeleted := 0
+
+	// Batches are paced so that cleanup does not trip throttling, which
+	// would affect whatever runs on the cluster next
+	nextBatch := delStartTime
+	keyList := make([]types.ObjectIdentifier, 0, params.deleteBatchSize)
+	for i, object := range objects {
+		keyList = append(keyList, object)
+		if len(keyList) == params.deleteBatchSize || i == numKeys-1 {
+			time.Sleep(time.Until(nextBatch))
+			batchStart := time.Now()
+			fmt.Printf("Deleting a batch of %d objects in range {%d, %d}... ", len(keyList), i-len(keyList)+1, i)
+			input := &s3.DeleteObjectsInput{
+				Bucket: aws.String(bucket),
+				Delete: &types.Delete{
+					Objects: keyList}}
+			_, err := svc.DeleteObjects(context.Background(), input)
+			if err == nil {
+				numSuccessfullyDeleted += len(keyList)
+				fmt.Printf("Succeeded\n")
+			} else {
+				fmt.Printf("Failed (%v)\n", err)
+			}
+			nextBatch = time.Now().Add(params.deleteBatchDelay)
+			if params.deleteRate > 0 {
+				paced := batchStart.Add(time.Duration(float64(len(keyList)) / params.deleteRate * float64(time.Second)))
+				if paced.After(nextBatch) {
+					nextBatch = paced
 				}
-				//set cursor to 0 so we can move to the next batch.
-				keyList = keyList[:0]
+			}
+			//set cursor to 0 so we can move to the next batch.
+			keyList = keyList[:0]
+
+			if params.statsInterval > 0 && time.Since(lastStats) >= params.statsInterval {
+				rate := float64(i+1-lastStatsCount) / time.Since(lastStats).Seconds()
+				fmt.Printf("Cleanup progress: %d/%d (%0.1f%%) - ETA %s\n",
+					i+1, numKeys, 100*float64(i+1)/float64(numKeys),
+					estimateETA(numKeys-i-1, rate))
+				lastStats = time.Now()
+				lastStatsCount = i + 1
+			}
+		}
+	}
+	fmt.Printf("Successfully deleted %d/%d objects in %s\n", numSuccessfullyDeleted, numKeys, time.Since(delStartTime))
+}
+
+func (params *Params) Run(op string) Result {
+	startTime := time.Now()
 
+	// Start submitting load requests
+	stop := make(chan struct{})
+	submitted := make(chan int, 1)
+	pipeline := &PipelineStats{rateLimited: params.rateLimit != nil}
+	go func() {
+		if op == opDelete {
+			submitted <- params.submitDeletes(startTime, stop)
+		} else if isVersionedOp(op) {
+			submitted <- params.submitVersions(startTime, stop)
+		} else {
+			submitted <- params.submitLoad(op, startTime, stop, pipeline)
+		}
+	}()
+	if params.errorRate != nil {
+		params.errorRate.Reset()
+	}
+
+	// Periodically report progress, a nil channel disables it
+	var statsTicks, liveTicks <-chan time.Time
+	var liveView *LiveView
+	if params.live {
+		ticker := time.NewTicker(liveRefresh)
+		defer ticker.Stop()
+		liveTicks = ticker.C
+		liveView = NewLiveView(os.Stdout)
+	} else if params.statsInterval > 0 {
+		ticker := time.NewTicker(params.statsInterval)
+		defer ticker.Stop()
+		statsTicks = ticker.C
+	}
+	lastStats := startTime
+	lastStatsCount := 0
+	window := NewLatencyWindow(params.statsWindow)
+
+	// Stream a point per interval to InfluxDB
+	var influxTicks <-chan time.Time
+	interval := &InfluxInterval{start: startTime}
+	if params.influx != nil {
+		ticker := time.NewTicker(params.influx.interval)
+		defer ticker.Stop()
+		influxTicks = ticker.C
+	}
+
+	// Collect and aggregate stats for completed requests
+	// The number of operations of a timed run is only known once it stops
+	// submitting
+	numSamples := params.numSamples
+	if op == opDelete {
+		numSamples = params.numDeleteRequests()
+	} else if isVersionedOp(op) {
+		numSamples = len(params.versioned.requests)
+	}
+	timed := params.duration > 0 && op != opDelete && !isVersionedOp(op)
+	total := numSamples
+	if timed {
+		total = -1
+	}
+	result := Result{operation: op, quiet: params.quiet, pipeline: pipeline}
+	if params.timelineInterval > 0 {
+		result.timeSeries = NewTimeSeries(params.timelineInterval)
+	}
+	keepWarmPings, keepWarmErrors := atomic.LoadInt64(&params.keepWarmPings), atomic.LoadInt64(&params.keepWarmErrors)
+	for i := 0; i != total; {
+		var resp Resp
+		select {
+		case resp = <-params.responses:
+		case total = <-submitted:
+			submitted = nil
+			continue
+		case <-statsTicks:
+			throughput := (float64(result.bytesTransmitted) / (1024 * 1024)) / time.Since(startTime).Seconds()
+			if timed {
+				elapsed := time.Since(startTime)
+				fmt.Printf("%v progress: %d ops (%0.1f%% of %s) - %0.2fMB/s - %s - ETA %s\n",
+					op, i, 100*elapsed.Seconds()/params.duration.Seconds(), params.duration,
+					throughput, window, (params.duration - elapsed).Round(time.Second))
+			} else {
+				rate := float64(i-lastStatsCount) / time.Since(lastStats).Seconds()
+				fmt.Printf("%v progress: %d/%d (%0.1f%%) - %0.2fMB/s - %s - ETA %s\n",
+					op, i, numSamples, 100*float64(i)/float64(numSamples),
+					throughput, window, estimateETA(numSamples-i, rate))
+			}
+			lastStats = time.Now()
+			lastStatsCount = i
+			continue
+		case <-liveTicks:
+			liveView.Draw(params.liveLines(op, startTime, i, &result, window))
+			continue
+		case <-influxTicks:
+			params.influx.Write(op, params.bucketName, interval)
+			interval = &InfluxInterval{start: time.Now()}
+			continue
+		}
+		i++
+		pipeline.addResponse(resp, time.Now())
+		if params.etags != nil {
+			params.etags.check(&resp, &result)
+		}
+		params.logRequest(resp)
+		if (op == opWrite || op == opCommit) && resp.err == nil {
+			params.recordWrite(resp)
+			if op == opWrite && params.checkpoints != nil {
+				params.checkpoints.Add(params.writtenKeys)
+			}
+			if op == opWrite && params.readAfterWrite != nil {
+				params.readAfterWrite.Add(resp)
 			}
 		}
-		fmt.Printf("Successfully deleted %d/%d objects in %s\n", numSuccessfullyDeleted, *numSamples, time.Since(delStartTime))
-	}
-}
-
-func (params *Params) Run(op string) Result {
-	startTime := time.Now()
-
-	// Start submitting load requests
-	go params.submitLoad(op)
-
-	// Collect and aggregate stats for completed requests
-	result := Result{opDurations: make([]float64, 0, params.numSamples), operation: op}
-	for i := 0; i < params.numSamples; i++ {
-		resp := <-params.responses
+		if op == opCommit && resp.err != nil && resp.output != nil {
+			// The object was committed but the staged one could not be
+			// deleted, both are left for cleanup
+			params.recordWrite(resp)
+			params.writtenKeys = append(params.writtenKeys, aws.ToString(resp.request.(*CommitInput).StagingKey))
+		}
+		if op == opCopy && resp.err == nil {
+			params.recordCopy(resp)
+		}
+		if op == opVersionWrite && resp.err == nil {
+			params.versioned.add(resp.key, resp.output.(*s3.PutObjectOutput).VersionId)
+			if params.etags != nil {
+				params.etags.add(resp.key, resp.output.(*s3.PutObjectOutput))
+			}
+		}
+		if op == opDelete {
+			result.numDeleted += params.recordDelete(resp)
+		}
+		params.clockOffset.Add(resp)
+		if params.influx != nil {
+			interval.add(resp)
+		}
 		errorString := ""
 		if resp.err != nil {
 			result.numErrors++
 			errorString = fmt.Sprintf(", error: %s", resp.err)
 		} else {
-			result.bytesTransmitted = result.bytesTransmitted + params.objectSize
-			result.opDurations = append(result.opDurations, resp.duration.Seconds())
+			result.bytesTransmitted = result.bytesTransmitted + resp.numBytes
+			result.opDurations.Record(resp.duration.Seconds())
+			result.addToSizeBucket(resp)
+			for _, d := range resp.partDurations {
+				result.partDurations.Record(d)
+			}
+			if resp.phases != nil {
+				result.addPhases(resp.phases)
+			}
+		}
+		if statsTicks != nil || liveTicks != nil {
+			window.Add(time.Now(), resp)
+		}
+		if params.tenants != nil {
+			result.addToTenant(resp)
+		}
+		if params.endpointMap != nil {
+			result.addToShard(resp)
+		}
+		result.addServerHeaders(resp)
+		if resp.retries > 0 {
+			result.numRetries += resp.retries
+			result.numRetried++
+		}
+		if op == opRead {
+			result.addCacheStatus(resp)
+			result.addRangeViolations(resp)
+			result.addChecksum(resp)
+			if params.repair {
+				result.addCorrupt(resp)
+			}
+		}
+		if op == opWrite {
+			result.addETagFormat(resp)
+		}
+		if resp.keyFormat != "" {
+			result.addLegacyKey(resp)
+		}
+		if params.captureHeaders > 0 {
+			result.addHeaderCapture(resp, i, params.captureHeaders)
+		}
+		if params.keyCharset != keyCharsetASCII {
+			result.addToKeyClass(resp, params.keyClass(resp.key))
+		}
+		if params.readManifest != nil && op == opRead {
+			result.addToVersionAge(resp)
+		}
+		if params.quiet != nil {
+			result.addToRecovery(resp, params.quiet, startTime, int(params.numClients))
+		}
+		result.addToTimeline(resp, time.Since(startTime))
+		if result.timeSeries != nil {
+			result.timeSeries.add(resp, time.Since(startTime))
+		}
+		if params.perClientStats {
+			result.addToClient(resp)
 		}
 		if params.verbose {
 			fmt.Printf("%v operation completed in %0.2fs (%d/%d) - %0.2fMB/s%s\n",
-				op, resp.duration.Seconds(), i+1, params.numSamples,
+				op, resp.duration.Seconds(), i, numSamples,
 				(float64(result.bytesTransmitted)/(1024*1024))/time.Since(startTime).Seconds(),
 				errorString)
 		}
+		if params.errorRate != nil && params.errorRate.Add(resp.err != nil) {
+			result.aborted = fmt.Sprintf("error rate %0.1f%% exceeded the %s threshold after %d/%d operations",
+				params.errorRate.Rate()*100, params.errorRate, i, numSamples)
+			fmt.Printf("Aborting %s test: %s\n", op, result.aborted)
+
+			// Stop submitting and wait for the requests already in flight
+			close(stop)
+			if submitted != nil {
+				total = <-submitted
+			}
+			for ; i < total; i++ {
+				<-params.responses
+			}
+			break
+		}
 	}
 
 	result.totalDuration = time.Since(startTime)
-	sort.Float64s(result.opDurations)
+	if result.timeSeries != nil {
+		result.timeSeries.finish(result.totalDuration)
+	}
+	result.keepWarmPings = atomic.LoadInt64(&params.keepWarmPings) - keepWarmPings
+	result.keepWarmErrors = atomic.LoadInt64(&params.keepWarmErrors) - keepWarmErrors
+	if liveView != nil {
+		liveView.Draw(params.liveLines(op, startTime, result.opDurations.Count()+result.numErrors, &result, window))
+	}
+	if params.influx != nil {
+		params.influx.Write(op, params.bucketName, interval)
+	}
 	return result
 }
 
-// Create an individual load request and submit it to the client queue
-func (params *Params) submitLoad(op string) {
-	bucket := aws.String(params.bucketName)
-	for i := 0; i < params.numSamples; i++ {
-		key := aws.String(fmt.Sprintf("%s%d", params.objectNamePrefix, i))
+// Remember a successfully written object for cleanup and in the manifest
+func (params *Params) recordWrite(resp Resp) {
+	params.writtenKeys = append(params.writtenKeys, resp.key)
+	if params.etags != nil {
+		params.etags.add(resp.key, resp.output.(*s3.PutObjectOutput))
+	}
+	if params.versioned != nil {
+		params.versioned.add(resp.key, resp.output.(*s3.PutObjectOutput).VersionId)
+	}
+	if params.manifest != nil {
+		output := resp.output.(*s3.PutObjectOutput)
+		etag := strings.Trim(aws.ToString(output.ETag), "\"")
+		params.manifest.Add(ManifestEntry{
+			key:          resp.key,
+			size:         resp.numBytes,
+			etag:         etag,
+			versionID:    aws.ToString(output.VersionId),
+			lastModified: resp.startTime.Add(resp.duration),
+			multipart:    params.multipartSize > 0 && resp.numBytes > params.multipartSize,
+		})
+	}
+}
+
+// Estimates the time needed to process the remaining items at the given rate
+// of items per second
+func estimateETA(remaining int, rate float64) string {
+	if rate <= 0 {
+		return "unknown"
+	}
+	return (time.Duration(float64(remaining)/rate) * time.Second).String()
+}
+
+// Create individual load requests and submit them to the client queue until
+// all samples are submitted, the duration of a timed run has elapsed or stop
+// is closed, returning the number submitted
+func (params *Params) submitLoad(op string, startTime time.Time, stop <-chan struct{}, pipeline *PipelineStats) int {
+	var pick func(i int) int
+	if op == opRead && params.accessPattern != nil {
+		numKeys := params.numSamples
+		if params.readManifest != nil {
+			numKeys = len(params.readManifest)
+		} else if params.numKeys > 0 {
+			numKeys = params.numKeys
+		}
+		pick = params.accessPattern.picker(numKeys)
+	}
+	for i := 0; params.duration > 0 || i < params.numSamples; i++ {
+		if params.duration > 0 && time.Since(startTime) >= params.duration {
+			return i
+		}
+		keyIndex := i
+		if pick != nil {
+			keyIndex = pick(i)
+		} else if params.numKeys > 0 {
+			keyIndex = i % params.numKeys
+		}
+		key := aws.String(params.objectKey(keyIndex))
+		bucket := aws.String(params.bucketFor(*key))
+		var request Req
 		if op == opWrite {
-			params.requests <- &s3.PutObjectInput{
+			size := params.objectSizeOf(keyIndex)
+			input := &s3.PutObjectInput{
+				Bucket:             bucket,
+				Key:                key,
+				Body:               params.objectData(*key, 0, size),
+				ContentLength:      aws.Int64(size),
+				ContentType:        params.contentType.pick(i, params.randomizeHeaders),
+				CacheControl:       params.cacheControl.pick(i, params.randomizeHeaders),
+				ContentDisposition: params.contentDisposition.pick(i, params.randomizeHeaders),
+			}
+			if params.search != nil {
+				params.search.apply(input, keyIndex)
+			}
+			if params.metadata != nil {
+				params.metadata.apply(input)
+			}
+			if params.sse != nil {
+				params.sse.applyPut(input)
+			}
+			request = input
+		} else if op == opCommit {
+			// Every commit is of a new object, even in a timed run
+			stagingKey, finalKey := params.commitKeys(i)
+			size := params.objectSizeOf(i)
+			request = &CommitInput{
+				Bucket:     bucket,
+				StagingKey: aws.String(stagingKey),
+				Key:        aws.String(finalKey),
+				Size:       size,
+				Body:       params.objectData(finalKey, 0, size),
+			}
+		} else if op == opRead && params.readManifest != nil {
+			entry := params.readManifest[keyIndex%len(params.readManifest)]
+			input := &s3.GetObjectInput{
 				Bucket: bucket,
-				Key:    key,
-				Body:   bytes.NewReader(bufferBytes),
+				Key:    aws.String(entry.key),
+			}
+			if entry.versionID != "" {
+				input.VersionId = aws.String(entry.versionID)
+			}
+			if params.sse != nil {
+				params.sse.applyGet(input)
 			}
+			if params.rangeRead != nil {
+				if header := params.rangeRead.header(keyIndex, entry.size); header != "" {
+					input.Range = aws.String(header)
+				}
+			}
+			request = input
 		} else if op == opRead {
-			params.requests <- &s3.GetObjectInput{
+			input := &s3.GetObjectInput{
 				Bucket: bucket,
 				Key:    key,
 			}
+			if params.sse != nil {
+				params.sse.applyGet(input)
+			}
+			if params.rangeRead != nil {
+				if header := params.rangeRead.header(keyIndex, params.expectedSize(*key, "")); header != "" {
+					input.Range = aws.String(header)
+				}
+			}
+			request = input
+		} else if op == opCopy && params.readManifest != nil {
+			entry := params.readManifest[keyIndex%len(params.readManifest)]
+			request = params.copyInput(entry.key, entry.versionID)
+		} else if op == opCopy {
+			request = params.copyInput(*key, "")
+		} else if (op == opPutAcl || op == opGetAcl) && params.readManifest != nil {
+			entry := params.readManifest[keyIndex%len(params.readManifest)]
+			request = params.aclInput(op, i, keyIndex, entry.key, entry.versionID)
+		} else if op == opPutAcl || op == opGetAcl {
+			request = params.aclInput(op, i, keyIndex, *key, "")
 		} else {
 			panic("Developer error")
 		}
+
+		if params.presign != nil && (op == opWrite || op == opRead) {
+			var err error
+			if request, err = params.presign.wrap(op, request, keyIndex); err != nil {
+				fmt.Printf("Could not presign %s: %v\n", *key, err)
+				os.Exit(1)
+			}
+		}
+
+		if params.quiet != nil {
+			params.waitQuiet(startTime)
+		}
+		if params.rateLimit != nil {
+			params.rateLimit.Wait()
+		}
+		ready := time.Now()
+		select {
+		case params.requests <- request:
+			pipeline.addDispatch(time.Since(ready))
+		case <-stop:
+			return i
+		}
 	}
+	return params.numSamples
 }
 
-func (params *Params) StartClients(cfg *aws.Config) {
+func (params *Params) StartClients(cfg aws.Config) {
 	for i := 0; i < int(params.numClients); i++ {
-		cfg.Endpoint = aws.String(params.endpoints[i%len(params.endpoints)])
-		go params.startClient(cfg)
+		clientCfg := cfg.Copy()
+		var tenant *Tenant
+		if params.tenants != nil {
+			tenant = params.tenants[i]
+			clientCfg.Credentials = credentials.NewStaticCredentialsProvider(tenant.accessKey, tenant.accessSecret, "")
+			if tenant.pools != nil {
+				clientCfg.HTTPClient = tenant.pools[poolOther]
+			}
+		}
+		go params.startClient(i, params.endpoints[i%len(params.endpoints)], clientCfg, tenant)
 		time.Sleep(1 * time.Millisecond)
 	}
 }
 
 // Run an individual load request
-func (params *Params) startClient(cfg *aws.Config) {
-	svc := s3.New(session.New(), cfg)
+func (params *Params) startClient(client int, endpoint string, cfg aws.Config, tenant *Tenant) {
+	ctx := context.Background()
+	// The client of the endpoint of this client, and of each endpoint of
+	// the endpoint map requests were routed to, per connection pool
+	type poolClient struct{ endpoint, pool string }
+	clients := map[poolClient]*s3.Client{}
+	tenantName := ""
+	pools := params.pools
+	if tenant != nil {
+		tenantName = tenant.name
+		if tenant.pools != nil && pools != nil {
+			pools = tenant.pools
+		}
+	}
 	for request := range params.requests {
+		target, shard := endpoint, ""
+		if params.endpointMap != nil {
+			if route, ok := params.endpointMap.route(requestTarget(request)); ok {
+				target, shard = route.endpoint, route.shard
+			}
+		}
+		poolCfg, pool := cfg, poolOther
+		if pools != nil {
+			pool = requestPool(request)
+			if pooled, ok := pools[pool]; ok {
+				poolCfg.HTTPClient = pooled
+			}
+		}
+		svc, ok := clients[poolClient{target, pool}]
+		if !ok {
+			svc = params.newS3Client(poolCfg, target)
+			clients[poolClient{target, pool}] = svc
+		}
+		if input, ok := request.(*KeepWarmInput); ok {
+			params.sendKeepWarm(ctx, svc, input)
+			continue
+		}
+		if tenant != nil && tenant.limiter != nil {
+			tenant.limiter.Wait()
+		}
+		atomic.AddInt64(&params.inFlight, 1)
 		putStartTime := time.Now()
 		var err error
+		var op, key string
+		var output interface{}
 		numBytes := params.objectSize
 
+		var traceID, spanID string
+		if params.tracer != nil {
+			traceID, spanID = newSpanContext()
+		}
+
+		// The outputs are only kept when the request succeeded, the
+		// response to the last request sent is kept either way
+		capture := &responseCapture{}
+		var partDurations, phases []float64
+		var cacheBusted bool
+		var keyFormat string
+		var undeleted []string
 		switch r := request.(type) {
 		case *s3.PutObjectInput:
-			req, _ := svc.PutObjectRequest(r)
-			// Disable payload checksum calculation (very expensive)
-			req.HTTPRequest.Header.Add("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
-			err = req.Send()
+			op, key = opWrite, *r.Key
+			numBytes = aws.ToInt64(r.ContentLength)
+			var put *s3.PutObjectOutput
+			if params.multipartSize > 0 && numBytes > params.multipartSize {
+				put, partDurations, err = params.uploadMultipart(ctx, svc, r, capture, traceID, spanID)
+			} else {
+				params.addChecksum(r)
+				var optFns []func(*s3.Options)
+				if optFns, err = params.writeOptions(traceID, spanID, capture, r.Body); err == nil {
+					put, err = svc.PutObject(ctx, r, optFns...)
+				}
+			}
+			if err == nil {
+				output = put
+			}
+		case *PresignedInput:
+			op, key = r.op, r.key
+			numBytes = r.size
+			var response *http.Response
+			response, err = params.sendPresigned(ctx, poolCfg.HTTPClient, r)
+			capture.response, capture.attempts = response, 1
+			if err == nil && op == opWrite {
+				io.Copy(ioutil.Discard, response.Body)
+				response.Body.Close()
+				output = &s3.PutObjectOutput{
+					ETag:      aws.String(response.Header.Get("ETag")),
+					VersionId: aws.String(response.Header.Get("X-Amz-Version-Id")),
+				}
+			} else if err == nil {
+				output = &s3.GetObjectOutput{
+					Body:          response.Body,
+					ContentLength: aws.Int64(response.ContentLength),
+					ETag:          aws.String(response.Header.Get("ETag")),
+				}
+			}
+		case *CommitInput:
+			op, key = opCommit, *r.Key
+			numBytes = r.Size
+			var committed *s3.PutObjectOutput
+			committed, phases, err = params.commitObject(ctx, svc, r, capture, traceID, spanID)
+			if committed != nil {
+				output = committed
+			}
 		case *s3.GetObjectInput:
-			req, resp := svc.GetObjectRequest(r)
-			err = req.Send()
+			op, key = opRead, *r.Key
+			optFns := requestOptions(traceID, spanID, capture, false)
+			if params.cdn != nil {
+				var cdnOptFns []func(*s3.Options)
+				cdnOptFns, cacheBusted = params.cdn.readOptions()
+				optFns = append(optFns, cdnOptFns...)
+			}
+			if params.checksumAlgorithm() != "" {
+				r.ChecksumMode = types.ChecksumModeEnabled
+			}
+			var got *s3.GetObjectOutput
+			got, err = svc.GetObject(ctx, r, optFns...)
+			if err != nil && params.legacyKeyFormats != nil {
+				got, keyFormat, err = params.readLegacyKey(ctx, svc, r, err, optFns)
+			}
+			if err == nil {
+				output = got
+			}
+		case *s3.ListObjectsV2Input:
+			op, key = opList, aws.ToString(r.Prefix)
+			var listed *s3.ListObjectsV2Output
+			listed, err = svc.ListObjectsV2(ctx, r, requestOptions(traceID, spanID, capture, false)...)
+			if err == nil {
+				output = listed
+			}
 			numBytes = 0
+		case *BucketCycleInput:
+			op, key = opBucketCycle, r.Bucket
+			phases, undeleted, err = params.cycleBucket(ctx, svc, r, capture, traceID, spanID)
+			numBytes = 0
+		case *s3.ListObjectVersionsInput:
+			op, key = opListVersions, aws.ToString(r.Prefix)
+			var listed *s3.ListObjectVersionsOutput
+			listed, err = svc.ListObjectVersions(ctx, r, requestOptions(traceID, spanID, capture, false)...)
+			if err == nil {
+				output = listed
+			}
+			numBytes = 0
+		case *s3.GetObjectTaggingInput:
+			op, key = opSearch, *r.Key
+			var tagging *s3.GetObjectTaggingOutput
+			tagging, err = svc.GetObjectTagging(ctx, r, requestOptions(traceID, spanID, capture, false)...)
+			if err == nil {
+				output = tagging
+			}
+			numBytes = 0
+		case *s3.DeleteObjectInput:
+			op, key = opDelete, *r.Key
+			_, err = svc.DeleteObject(ctx, r, requestOptions(traceID, spanID, capture, false)...)
+			if err != nil {
+				undeleted = []string{key}
+			}
+			numBytes = 0
+		case *s3.DeleteObjectsInput:
+			op, key = opDelete, aws.ToString(r.Delete.Objects[0].Key)
+			var deleted *s3.DeleteObjectsOutput
+			deleted, err = svc.DeleteObjects(ctx, r, requestOptions(traceID, spanID, capture, false)...)
+			undeleted, err = undeletedKeys(r, deleted, err)
+			if err == nil {
+				output = deleted
+			}
+			numBytes = 0
+		case *CopyInput:
+			op, key = opCopy, *r.Key
+			numBytes = r.Size
+			var copied *s3.CopyObjectOutput
+			copied, err = svc.CopyObject(ctx, &r.CopyObjectInput, requestOptions(traceID, spanID, capture, false)...)
 			if err == nil {
-				numBytes, err = io.Copy(ioutil.Discard, resp.Body)
+				output = copied
+			}
+		case *s3.PutObjectAclInput:
+			op, key = opPutAcl, *r.Key
+			_, err = svc.PutObjectAcl(ctx, r, requestOptions(traceID, spanID, capture, false)...)
+			numBytes = 0
+		case *s3.GetObjectAclInput:
+			op, key = opGetAcl, *r.Key
+			var acl *s3.GetObjectAclOutput
+			acl, err = svc.GetObjectAcl(ctx, r, requestOptions(traceID, spanID, capture, false)...)
+			if err == nil {
+				output = acl
+			}
+			numBytes = 0
+		case *s3.HeadObjectInput:
+			op, key = opSearch, *r.Key
+			var head *s3.HeadObjectOutput
+			head, err = svc.HeadObject(ctx, r, requestOptions(traceID, spanID, capture, false)...)
+			if err == nil && params.metadata != nil {
+				err = params.metadata.check(key, head.Metadata)
 			}
-			if numBytes != params.objectSize {
-				err = fmt.Errorf("expected object length %d, actual %d", params.objectSize, numBytes)
+			if err == nil {
+				output = head
 			}
+			numBytes = 0
 		default:
 			panic("Developer error")
 		}
+		// Requests return once the response headers are in, before the body
+		// of a GET has been read
+		ttfb := time.Since(putStartTime)
+		var rangeViolations []string
+		var checksum string
+		var corrupt bool
+		if op == opRead {
+			numBytes = 0
+			input := readInput(request)
+			expectedSize := params.expectedSize(key, aws.ToString(input.VersionId))
+			// The data of objects written by this run is known
+			var expected *RandomReader
+			if !params.skipWrite && params.readManifest == nil && keyFormat == "" {
+				expected = params.objectData(key, 0, expectedSize)
+			}
+			var check *DataCheck
+			if err == nil && input.Range == nil && params.verifyContent && expected != nil {
+				got := output.(*s3.GetObjectOutput)
+				check = NewDataCheck(got.Body, expected)
+				got.Body = check
+			}
+			if err == nil && input.Range != nil {
+				body := output.(*s3.GetObjectOutput).Body
+				numBytes, rangeViolations, err = readRange(body, *input.Range, capture.response, expected)
+				body.Close()
+				if err == nil && len(rangeViolations) > 0 {
+					err = fmt.Errorf("range %s not honoured: %s", *input.Range, strings.Join(rangeViolations, ", "))
+				}
+			} else if err == nil && params.checksum != checksumNone && keyFormat == "" {
+				got := output.(*s3.GetObjectOutput)
+				numBytes, checksum, err = params.readVerified(got)
+				got.Body.Close()
+			} else if err == nil {
+				body := output.(*s3.GetObjectOutput).Body
+				numBytes, err = io.Copy(ioutil.Discard, body)
+				body.Close()
+			}
+			if input.Range != nil {
+				expectedSize = rangeLength(*input.Range)
+			}
+			if keyFormat != "" {
+				// The size of objects under a legacy name was not detected
+				expectedSize = aws.ToInt64(output.(*s3.GetObjectOutput).ContentLength)
+			}
+			if err == nil && numBytes != expectedSize {
+				err = fmt.Errorf("expected object length %d, actual %d", expectedSize, numBytes)
+				corrupt = expected != nil && input.Range == nil
+			}
+			if err == nil && check != nil && !check.matches {
+				err = fmt.Errorf("data of %s differs from the data written", key)
+				corrupt = true
+			}
+			if err == nil && params.sse != nil {
+				err = params.sse.check(output.(*s3.GetObjectOutput))
+			}
+			if err == nil && params.metadata != nil && keyFormat == "" {
+				err = params.metadata.check(key, output.(*s3.GetObjectOutput).Metadata)
+			}
+		}
+
+		// The server's clock and request ID, to correlate with server logs
+		header := capture.header()
+		serverDate, _ := http.ParseTime(header.Get("Date"))
+
+		if params.tracer != nil {
+			bucket, _ := requestTarget(request)
+			params.tracer.Record(Span{
+				traceID:   traceID,
+				spanID:    spanID,
+				operation: op,
+				bucket:    bucket,
+				key:       key,
+				size:      numBytes,
+				endpoint:  target,
+				startTime: putStartTime,
+				endTime:   time.Now(),
+				err:       err,
+			})
+		}
+
+		atomic.AddInt64(&params.inFlight, -1)
+		resp := Resp{
+			err:             err,
+			duration:        time.Since(putStartTime),
+			finished:        time.Now(),
+			ttfb:            ttfb,
+			status:          capture.status(),
+			numBytes:        numBytes,
+			request:         request,
+			output:          output,
+			op:              op,
+			key:             key,
+			endpoint:        target,
+			client:          client,
+			startTime:       putStartTime,
+			tenant:          tenantName,
+			serverDate:      serverDate,
+			requestID:       capture.requestID(),
+			serverHeaders:   parseServerHeaders(header, params.timingHeaders),
+			partDurations:   partDurations,
+			phases:          phases,
+			header:          header,
+			cacheBusted:     cacheBusted,
+			corrupt:         corrupt,
+			keyFormat:       keyFormat,
+			retries:         capture.retries(),
+			shard:           shard,
+			undeleted:       undeleted,
+			rangeViolations: rangeViolations,
+			checksum:        checksum,
+		}
+		// Classifying the ETag hashes the data written, once the write is
+		// timed so that its latency does not include the hashing
+		if _, ok := request.(*s3.PutObjectInput); ok && err == nil && params.etagMD5s != nil {
+			resp.etagFormat = params.etagFormat(key, numBytes, output.(*s3.PutObjectOutput).ETag)
+			resp.finished = time.Now()
+		}
+		params.responses <- resp
+	}
+}
+
+// Lists the objects under objectNamePrefix and remembers their actual sizes,
+// returning how many of the keys used by the test were found
+func (params *Params) detectObjectSizes(svc *s3.Client) (int, error) {
+	sizes := make(map[string]int64)
+	for _, bucket := range params.buckets {
+		pages := s3.NewListObjectsV2Paginator(svc, &s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(params.objectNamePrefix),
+		})
+		for pages.HasMorePages() {
+			page, err := pages.NextPage(context.Background())
+			if err != nil {
+				return 0, err
+			}
+			for _, obj := range page.Contents {
+				// Objects in other buckets than theirs are not read
+				if params.bucketFor(*obj.Key) == bucket {
+					sizes[*obj.Key] = aws.ToInt64(obj.Size)
+				}
+			}
+		}
+	}
+
+	params.objectSizes = make(map[string]int64)
+	for i := 0; i < params.numSamples; i++ {
+		key := params.objectKey(i)
+		if size, ok := sizes[key]; ok {
+			params.objectSizes[key] = size
+		}
+	}
+	return len(params.objectSizes), nil
+}
+
+// Checks that the objects a read run expects were all detected and, when sizes
+// were given explicitly, are of the expected size. Returns a description of
+// the problem, or an empty string if there is none.
+func (params *Params) checkExistingObjects(checkSizes bool) string {
+	var missing, wrongSize []string
+	for i := 0; i < params.numSamples; i++ {
+		key := params.objectKey(i)
+		size, ok := params.objectSizes[key]
+		if !ok {
+			missing = append(missing, key)
+		} else if checkSizes && size != params.objectSizeOf(i) {
+			wrongSize = append(wrongSize, fmt.Sprintf("%s (%d bytes, expected %d)", key, size, params.objectSizeOf(i)))
+		}
+	}
+	examples := func(keys []string) string {
+		if len(keys) > 3 {
+			return strings.Join(keys[:3], ", ") + ", ..."
+		}
+		return strings.Join(keys, ", ")
+	}
+	switch {
+	case len(missing) > 0 && params.legacyKeyFormats == nil:
+		return fmt.Sprintf("%d of the %d objects to read do not exist under s3://%s/%s: %s",
+			len(missing), params.numSamples, params.bucketName, params.objectNamePrefix, examples(missing))
+	case len(wrongSize) > 0:
+		return fmt.Sprintf("%d of the %d objects to read are not of the expected size: %s",
+			len(wrongSize), params.numSamples, examples(wrongSize))
+	}
+	return ""
+}
+
+// Returns the size a read of the given key and version should return, which
+// is the detected size when available and objectSize otherwise
+func (params *Params) expectedSize(key, versionID string) int64 {
+	if versionID != "" {
+		if size, ok := params.versionSizes[key+"\x00"+versionID]; ok {
+			return size
+		}
+	}
+	if size, ok := params.objectSizes[key]; ok {
+		return size
+	}
+	if i, ok := params.keyNumber(key); ok {
+		return params.objectSizeOf(i)
+	}
+	return params.objectSize
+}
 
-		params.responses <- Resp{err, time.Since(putStartTime), numBytes}
+// Returns the size of the i-th object written
+func (params *Params) objectSizeOf(i int) int64 {
+	if params.sizeDist != nil {
+		return params.sizeDist.Size(i)
 	}
+	return params.objectSize
+}
+
+// Read the objects listed in a manifest, whose sizes are known in advance
+func (params *Params) useManifest(entries []ManifestEntry) {
+	params.readManifest = entries
+	params.objectSizes = make(map[string]int64)
+	params.versionSizes = make(map[string]int64)
+	for _, entry := range entries {
+		if entry.versionID != "" {
+			params.versionSizes[entry.key+"\x00"+entry.versionID] = entry.size
+		} else {
+			params.objectSizes[entry.key] = entry.size
+		}
+	}
+}
+
+// Whether the named flag was given on the command line
+func flagIsSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
 // Specifies the parameters for a given test
 type Params struct {
-	operation        string
-	requests         chan Req
-	responses        chan Resp
-	numSamples       int
-	numClients       uint
-	objectSize       int64
-	objectNamePrefix string
-	bucketName       string
-	endpoints        []string
-	verbose          bool
+	// Requests being sent by the clients and keepWarm requests sent, first
+	// for 64-bit alignment
+	inFlight       int64
+	keepWarmPings  int64
+	keepWarmErrors int64
+
+	operation            string
+	requests             chan Req
+	responses            chan Resp
+	numSamples           int
+	duration             time.Duration
+	stageDelay           time.Duration
+	numStages            int
+	startAt              time.Time
+	streamStages         bool
+	multipartSize        int64
+	multipartConcurrency int
+	keyCharset           string
+	sizeDist             *SizeDistribution
+	captureHeaders       int
+	accessPattern        *AccessPattern
+	presign              *Presigner
+	versioned            *Versioned
+	rangeRead            *RangeRead
+	sse                  *SSE
+	metadata             *UserMetadata
+	objAcls              CannedACLs
+	checksum             string
+	etags                ETags
+	verifyContent        bool
+	readAfterWrite       *ReadAfterWrite
+	getObjAcl            bool
+	pools                map[string]aws.HTTPClient
+	sourcePorts          map[string]*PortRange
+	deleteBatchSize      int
+	deleteObj            bool
+	deleteKeys           []string
+	deleteBatchDelay     time.Duration
+	deleteRate           float64
+	runID                string
+	numClients           uint
+	objectSize           int64
+	objectNamePrefix     string
+	bucketName           string
+	buckets              []string
+	bucketSpread         string
+	endpoints            []string
+	verbose              bool
+	skipWrite            bool
+	commit               bool
+	linkSpeed            LinkSpeed
+	search               *SearchParams
+	bucketCycle          *BucketCycleParams
+	statsInterval        time.Duration
+	live                 bool
+	perClientStats       bool
+	timelineInterval     time.Duration
+	statsWindow          time.Duration
+	objectSizes          map[string]int64
+	versionSizes         map[string]int64
+	readManifest         []ManifestEntry
+	repair               bool
+	numKeys              int
+	rateLimit            *RateLimiter
+	tracer               *SpanExporter
+	contentType          HeaderVariants
+	cacheControl         HeaderVariants
+	contentDisposition   HeaderVariants
+	randomizeHeaders     bool
+	addressingStyle      string
+	legacyKeyFormats     LegacyKeyFormats
+	payloadHashes        *PayloadHashes
+	etagMD5s             *PayloadHashes
+	endpointMap          *EndpointMap
+	copy                 *CopyParams
+	copiedKeys           []string
+	trafficClass         string
+	list                 *ListParams
+	checkpoints          *Checkpoints
+	cdn                  *CDNParams
+	errorRate            *ErrorRateMonitor
+	requestLog           *RequestLog
+	latencyLog           *RequestLog
+	influx               *InfluxWriter
+	tenants              []*Tenant
+	clockOffset          *ClockOffsetTracker
+	writtenKeys          []string
+	manifest             *Manifest
+	quiet                *QuietSchedule
+	keepWarm             bool
+	timingHeaders        []string
+	batchJob             *BatchJobParams
 }
 
 func (params Params) String() string {
 	output := fmt.Sprintln("Test parameters")
 	output += fmt.Sprintf("endpoint(s):      %s\n", params.endpoints)
-	output += fmt.Sprintf("bucket:           %s\n", params.bucketName)
+	if len(params.buckets) > 1 {
+		output += fmt.Sprintf("buckets:          %s (%s)\n", strings.Join(params.buckets, ","), params.bucketSpread)
+	} else {
+		output += fmt.Sprintf("bucket:           %s\n", params.bucketName)
+	}
+	if params.addressingStyle == addressingVirtual {
+		output += fmt.Sprintf("addressingStyle:  %s\n", params.addressingStyle)
+	}
+	if params.payloadHashes != nil {
+		output += fmt.Sprintln("signedPayload:    true")
+	}
+	if params.checksum != checksumNone {
+		output += fmt.Sprintf("checksum:         %s\n", params.checksum)
+	}
+	if params.etags != nil {
+		output += fmt.Sprintln("verifyETag:       true")
+	}
+	if params.etagMD5s != nil {
+		output += fmt.Sprintln("checkETagFormat:  true")
+	}
+	if params.verifyContent {
+		output += fmt.Sprintf("verifyContent:    %t\n", params.verifyContent)
+	}
+	if params.readAfterWrite != nil {
+		output += fmt.Sprintf("readAfterWrite:   every %s for up to %s\n", params.readAfterWrite.poll, params.readAfterWrite.timeout)
+	}
 	output += fmt.Sprintf("objectNamePrefix: %s\n", params.objectNamePrefix)
-	output += fmt.Sprintf("objectSize:       %0.4f MB\n", float64(params.objectSize)/(1024*1024))
+	if params.runID != "" {
+		output += fmt.Sprintf("runID:            %s\n", params.runID)
+	}
+	if params.trafficClass != "" {
+		output += fmt.Sprintf("trafficClass:     %s\n", params.trafficClass)
+	}
+	if params.rateLimit != nil {
+		output += fmt.Sprintf("rateLimit:        %s\n", params.rateLimit)
+	}
+	if params.accessPattern != nil {
+		output += fmt.Sprintf("accessPattern:    %s\n", params.accessPattern)
+	}
+	if params.rangeRead != nil {
+		output += fmt.Sprintf("rangeRead:        %s\n", params.rangeRead)
+	}
+	if params.sse != nil {
+		output += fmt.Sprintf("sse:              %s\n", params.sse)
+	}
+	if params.metadata != nil {
+		output += fmt.Sprintf("metadata:         %s\n", params.metadata)
+	}
+	if params.objAcls != nil {
+		output += fmt.Sprintf("putObjAcl:        %s\n", params.objAcls)
+	}
+	if params.getObjAcl {
+		output += fmt.Sprintf("getObjAcl:        %t\n", params.getObjAcl)
+	}
+	if params.pools != nil {
+		output += fmt.Sprintf("poolPerOp:        %s\n", poolsString(params.sourcePorts))
+	}
+	if params.sizeDist != nil {
+		output += fmt.Sprintf("objectSizeDist:   %s\n", params.sizeDist)
+	} else {
+		output += fmt.Sprintf("objectSize:       %0.4f MB\n", float64(params.objectSize)/(1024*1024))
+	}
+	if params.multipartSize > 0 {
+		output += fmt.Sprintf("multipartSize:    %0.4f MB x %d parallel\n", float64(params.multipartSize)/(1024*1024), params.multipartConcurrency)
+	}
 	output += fmt.Sprintf("numClients:       %d\n", params.numClients)
-	output += fmt.Sprintf("numSamples:       %d\n", params.numSamples)
-	output += fmt.Sprintf("verbose:       %d\n", params.verbose)
+	if params.linkSpeed > 0 {
+		output += fmt.Sprintf("linkSpeed:        %s\n", params.linkSpeed)
+	}
+	if params.duration > 0 {
+		output += fmt.Sprintf("duration:         %s\n", params.duration)
+	} else {
+		output += fmt.Sprintf("numSamples:       %d\n", params.numSamples)
+	}
+	output += fmt.Sprintf("verbose:          %t\n", params.verbose)
+	output += fmt.Sprintf("skipWrite:        %t\n", params.skipWrite)
+	if params.repair {
+		output += fmt.Sprintln("repair:           true")
+	}
+	if params.commit {
+		output += fmt.Sprintf("commit:           %t\n", params.commit)
+	}
+	if !params.startAt.IsZero() {
+		output += fmt.Sprintf("startAt:          %s\n", params.startAt.Format(time.RFC3339Nano))
+	}
+	if params.stageDelay > 0 {
+		output += fmt.Sprintf("stageDelay:       %s\n", params.stageDelay)
+	}
+	if params.streamStages {
+		output += fmt.Sprintf("streamStages:     %t\n", params.streamStages)
+	}
+	output += fmt.Sprintf("statsInterval:    %s\n", params.statsInterval)
+	output += fmt.Sprintf("statsWindow:      %s\n", params.statsWindow)
+	if exactStats {
+		output += fmt.Sprintf("statsMode:        %s\n", statsModeExact)
+	}
+	if params.quiet != nil {
+		output += fmt.Sprintf("quiet:            %s\n", params.quiet)
+		output += fmt.Sprintf("keepWarm:         %t\n", params.keepWarm)
+	}
+	if params.tenants != nil {
+		seen := make(map[*Tenant]bool)
+		for _, tenant := range params.tenants {
+			if !seen[tenant] {
+				seen[tenant] = true
+				output += fmt.Sprintf("tenant:           %s\n", tenant)
+			}
+		}
+	}
+	if len(params.contentType) > 0 || len(params.cacheControl) > 0 || len(params.contentDisposition) > 0 {
+		output += fmt.Sprintf("contentType:      %q\n", []string(params.contentType))
+		output += fmt.Sprintf("cacheControl:     %q\n", []string(params.cacheControl))
+		output += fmt.Sprintf("contentDisposition: %q\n", []string(params.contentDisposition))
+		output += fmt.Sprintf("randomizeHeaders: %t\n", params.randomizeHeaders)
+	}
+	if params.cdn != nil {
+		if params.cdn.bustQuery != "" {
+			output += fmt.Sprintf("cacheBustQuery:   %s on %g%% of reads\n", params.cdn.bustQuery, params.cdn.bustPercent)
+		}
+		if params.cdn.cacheControl != "" {
+			output += fmt.Sprintf("readCacheControl: %s\n", params.cdn.cacheControl)
+		}
+	}
 	return output
 }
 
@@ -264,8 +2437,47 @@ type Result struct {
 	operation        string
 	bytesTransmitted int64
 	numErrors        int
-	opDurations      []float64
+	numRetries       int
+	numRetried       int
+	opDurations      Histogram
 	totalDuration    time.Duration
+	stageDelay       time.Duration
+	aborted          string
+	sizeBuckets      map[int64]*SizeBucket
+	tenants          map[string]*TenantStats
+	timeline         []TimelinePoint
+	timeSeries       *TimeSeries
+	endpoints        map[string]*EndpointStats
+	shards           map[string]*EndpointStats
+	numDeleted       int
+	numListings      int
+	numListed        int
+	clients          []*ClientStats
+	recoveries       map[int][]float64
+	quiet            *QuietSchedule
+	keepWarmPings    int64
+	keepWarmErrors   int64
+	serverTiming     *ServerTimingStats
+	cache            *CacheStats
+	legacyKeys       map[string]int
+	corruptKeys      map[string]bool
+	numRepaired      int
+	numUnrepairable  int
+	versionAges      map[int]*Histogram
+	partDurations    Histogram
+	keyClasses       map[string]*KeyClassStats
+	headers          *HeaderCapture
+	phases           []Histogram
+	bucketsLeft      []string
+	pipeline         *PipelineStats
+	rangeViolations  map[string]int
+	checksums        map[string]int
+	etagsChecked     int
+	etagMismatches   int
+	etagExamples     []string
+	etagFormats      map[string]int
+	streak           int
+	longestStreak    int
 }
 
 func (r Result) String() string {
@@ -273,10 +2485,34 @@ func (r Result) String() string {
 	report += fmt.Sprintf("Total Transferred: %0.3f MB\n", float64(r.bytesTransmitted)/(1024*1024))
 	report += fmt.Sprintf("Total Throughput:  %0.2f MB/s\n", (float64(r.bytesTransmitted)/(1024*1024))/r.totalDuration.Seconds())
 	report += fmt.Sprintf("Total Duration:    %0.3f s\n", r.totalDuration.Seconds())
+	if r.stageDelay > 0 {
+		report += fmt.Sprintf("Preceded By:       %s stage delay\n", r.stageDelay)
+	}
 	report += fmt.Sprintf("Number of Errors:  %d\n", r.numErrors)
-	if len(r.opDurations) > 0 {
+	if r.operation == opList || r.operation == opListVersions {
+		report += r.listReport()
+	}
+	if r.operation == opBucketCycle {
+		report += r.bucketCycleReport()
+	}
+	if r.operation == opDelete {
+		report += fmt.Sprintf("Objects Deleted:   %d (%0.1f objects/s)\n", r.numDeleted, float64(r.numDeleted)/r.totalDuration.Seconds())
+	}
+	if r.numRetries > 0 {
+		report += fmt.Sprintf("Retries:           %d (%d ops retried)\n", r.numRetries, r.numRetried)
+	}
+	if r.aborted != "" {
+		report += fmt.Sprintf("Aborted:           %s\n", r.aborted)
+	}
+	if r.opDurations.Count() > 0 {
 		report += fmt.Sprintln("------------------------------------")
 		report += fmt.Sprintf("%s times Max:       %0.3f s\n", r.operation, r.percentile(100))
+		if r.opDurations.Count() >= 10000 {
+			report += fmt.Sprintf("%s times 99.99th %%ile: %0.3f s\n", r.operation, r.percentile(99.99))
+		}
+		if r.opDurations.Count() >= 1000 {
+			report += fmt.Sprintf("%s times 99.9th %%ile: %0.3f s\n", r.operation, r.percentile(99.9))
+		}
 		report += fmt.Sprintf("%s times 99th %%ile: %0.3f s\n", r.operation, r.percentile(99))
 		report += fmt.Sprintf("%s times 90th %%ile: %0.3f s\n", r.operation, r.percentile(90))
 		report += fmt.Sprintf("%s times 75th %%ile: %0.3f s\n", r.operation, r.percentile(75))
@@ -284,22 +2520,142 @@ func (r Result) String() string {
 		report += fmt.Sprintf("%s times 25th %%ile: %0.3f s\n", r.operation, r.percentile(25))
 		report += fmt.Sprintf("%s times Min:       %0.3f s\n", r.operation, r.percentile(0))
 	}
+	if r.partDurations.Count() > 0 {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.partReport()
+	}
+	if len(r.phases) > 0 {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.phaseReport()
+	}
+	if len(r.sizeBuckets) > 1 {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.sizeBucketReport()
+	}
+	if len(r.keyClasses) > 0 {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.keyClassReport()
+	}
+	if len(r.endpoints) > 1 {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.endpointReport()
+	}
+	if len(r.shards) > 0 {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.shardReport()
+	}
+	if len(r.clients) > 0 {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.clientReport()
+	}
+	if len(r.tenants) > 0 {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.tenantReport()
+	}
+	if len(r.versionAges) > 0 {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.versionAgeReport()
+	}
+	if r.serverTiming != nil {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.serverTimingReport()
+	}
+	if r.cache != nil {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.cacheReport()
+	}
+	if len(r.legacyKeys) > 0 {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.legacyKeyReport()
+	}
+	if len(r.corruptKeys) > 0 {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.repairReport()
+	}
+	if len(r.recoveries) > 0 && r.opDurations.Count() > 0 {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.recoveryReport(r.quiet)
+	}
+	if r.headers != nil {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.headers.report(r.operation)
+	}
+	if len(r.rangeViolations) > 0 {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.rangeViolationReport()
+	}
+	if len(r.checksums) > 0 {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.checksumReport()
+	}
+	if r.etagsChecked > 0 {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.etagReport()
+	}
+	if len(r.etagFormats) > 0 {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.etagFormatReport()
+	}
+	if r.pipeline != nil {
+		report += fmt.Sprintln("------------------------------------")
+		report += r.pipelineReport()
+	}
 	return report
 }
 
-func (r Result) percentile(i int) float64 {
-	if i >= 100 {
-		i = len(r.opDurations) - 1
-	} else if i > 0 && i < 100 {
-		i = int(float64(i) / 100 * float64(len(r.opDurations)))
+func (r Result) percentile(p float64) float64 {
+	return r.opDurations.Percentile(p)
+}
+
+// Returns the p-th percentile of the given sorted durations by nearest rank
+func percentile(sorted []float64, p float64) float64 {
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	} else if i >= len(sorted) {
+		i = len(sorted) - 1
 	}
-	return r.opDurations[i]
+	return sorted[i]
 }
 
 type Req interface{}
 
 type Resp struct {
-	err      error
-	duration time.Duration
-	numBytes int64
+	err           error
+	duration      time.Duration
+	numBytes      int64
+	request       Req
+	output        interface{}
+	op            string
+	key           string
+	endpoint      string
+	client        int
+	startTime     time.Time
+	tenant        string
+	serverDate    time.Time
+	requestID     string
+	serverHeaders ServerHeaders
+	partDurations []float64
+	phases        []float64
+	header        http.Header
+	ttfb          time.Duration
+	status        int
+	cacheBusted   bool
+	// Whether a read failed verification, its object not being the one written
+	corrupt bool
+	// Legacy format of the name the object was found under, if any
+	keyFormat string
+	retries   int
+	// Route of the request in the endpoint map, if any
+	shard string
+	// Keys a delete request failed to delete
+	undeleted []string
+	// When the client handed the response to the collector
+	finished time.Time
+	// How a ranged read was not honoured, if it was not
+	rangeViolations []string
+	// Whether the checksum of a read was verified
+	checksum string
+	// How the ETag of a write relates to the data written
+	etagFormat string
 }
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Loads the config of the clients, with the given static credentials or else
+// those found by the default credential chain: environment variables, the
+// shared credentials and config files, of profile when given, and then ECS
+// task or EC2 instance roles
+func loadConfig(region, profile, accessKey, accessSecret string) (aws.Config, error) {
+	opts := []func(*config.LoadOptions) error{config.WithRegion(region)}
+	if accessKey != "" {
+		opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKey, accessSecret, "")))
+	} else if profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(profile))
+	}
+	return config.LoadDefaultConfig(context.Background(), opts...)
+}
+
+// Replaces the credentials of cfg by those of roleArn, assumed with the
+// current credentials or, when webIdentityTokenFile is given, with the OIDC
+// token it holds as EKS provides to service accounts. The credentials are
+// cached and assumed again before they expire, so that runs may outlast the
+// session.
+func assumeRole(cfg *aws.Config, roleArn, externalID, webIdentityTokenFile, sessionName string) {
+	client := sts.NewFromConfig(*cfg)
+	var provider aws.CredentialsProvider
+	if webIdentityTokenFile != "" {
+		provider = stscreds.NewWebIdentityRoleProvider(client, roleArn, stscreds.IdentityTokenFile(webIdentityTokenFile),
+			func(o *stscreds.WebIdentityRoleOptions) {
+				o.RoleSessionName = sessionName
+			})
+	} else {
+		provider = stscreds.NewAssumeRoleProvider(client, roleArn, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = sessionName
+			if externalID != "" {
+				o.ExternalID = aws.String(externalID)
+			}
+		})
+	}
+	cfg.Credentials = aws.NewCredentialsCache(provider)
+}
+
+const (
+	addressingPath    = "path"
+	addressingVirtual = "virtual"
+)
+
+const (
+	retryStandard = "standard"
+	retryAdaptive = "adaptive"
+)
+
+// Returns the retryer of the clients, retrying a failed request up to
+// maxRetries times with exponential backoff of at most maxBackoff. The
+// adaptive mode also slows requests down while the server throttles them.
+func newRetryer(mode string, maxRetries int, maxBackoff time.Duration) (func() aws.Retryer, error) {
+	if maxRetries < 0 || maxBackoff <= 0 {
+		return nil, fmt.Errorf("maxRetries can not be negative and maxBackoff needs to be greater than 0")
+	}
+	standard := func(o *retry.StandardOptions) {
+		o.MaxAttempts = maxRetries + 1
+		o.MaxBackoff = maxBackoff
+	}
+	switch mode {
+	case retryStandard:
+		return func() aws.Retryer { return retry.NewStandard(standard) }, nil
+	case retryAdaptive:
+		return func() aws.Retryer {
+			return retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+				o.StandardOptions = append(o.StandardOptions, standard)
+			})
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid retryMode %q, expected %s or %s", mode, retryStandard, retryAdaptive)
+}
+
+// Header carrying the traffic class of requests
+const trafficClassHeader = "X-S3bench-Traffic-Class"
+
+// Returns a client sending requests to endpoint, path-style unless the
+// addressing style is virtual since most S3-compatible stores do not resolve
+// bucket subdomains. Requests of a run carry its ID in their User-Agent, and
+// its traffic class there and in trafficClassHeader.
+func (params *Params) newS3Client(cfg aws.Config, endpoint string) *s3.Client {
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(endpoint)
+		o.UsePathStyle = params.addressingStyle != addressingVirtual
+		// Checksums of the payload are very expensive to compute for large
+		// objects, only send and check them when an operation requires it
+		o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+		o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+		if params.runID != "" {
+			o.APIOptions = append(o.APIOptions, awsmiddleware.AddUserAgentKeyValue("s3bench-run", params.runID))
+		}
+		if params.trafficClass != "" {
+			o.APIOptions = append(o.APIOptions,
+				awsmiddleware.AddUserAgentKeyValue("s3bench-class", params.trafficClass),
+				smithyhttp.SetHeaderValue(trafficClassHeader, params.trafficClass))
+		}
+	})
+}
+
+// Keeps the HTTP response to the last attempt of a request, whether or not
+// the request failed, for its status, date and request ID, and counts the
+// attempts made
+type responseCapture struct {
+	response *http.Response
+	attempts int
+}
+
+func (c *responseCapture) option(o *s3.Options) {
+	o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Deserialize.Add(middleware.DeserializeMiddlewareFunc("s3benchResponseCapture",
+			func(ctx context.Context, in middleware.DeserializeInput, next middleware.DeserializeHandler) (middleware.DeserializeOutput, middleware.Metadata, error) {
+				c.attempts++
+				out, metadata, err := next.HandleDeserialize(ctx, in)
+				if resp, ok := out.RawResponse.(*smithyhttp.Response); ok {
+					c.response = resp.Response
+				}
+				return out, metadata, err
+			}), middleware.After)
+	})
+}
+
+func (c *responseCapture) header() http.Header {
+	if c.response == nil {
+		return nil
+	}
+	return c.response.Header
+}
+
+func (c *responseCapture) status() int {
+	if c.response == nil {
+		return 0
+	}
+	return c.response.StatusCode
+}
+
+// Returns the number of times the request was retried
+func (c *responseCapture) retries() int {
+	if c.attempts < 2 {
+		return 0
+	}
+	return c.attempts - 1
+}
+
+func (c *responseCapture) requestID() string {
+	return c.header().Get("X-Amz-Request-Id")
+}
+
+// Returns the options of a request: the span of traceID is propagated to the
+// server when tracing, the response is kept in capture unless it is nil and
+// with unsigned the payload is not hashed to sign the request, which is very
+// expensive
+func requestOptions(traceID, spanID string, capture *responseCapture, unsigned bool) []func(*s3.Options) {
+	var optFns []func(*s3.Options)
+	if traceID != "" {
+		optFns = append(optFns, func(o *s3.Options) {
+			o.APIOptions = append(o.APIOptions, smithyhttp.SetHeaderValue("traceparent", traceparent(traceID, spanID)))
+		})
+	}
+	if capture != nil {
+		optFns = append(optFns, capture.option)
+	}
+	if unsigned {
+		optFns = append(optFns, func(o *s3.Options) {
+			o.APIOptions = append(o.APIOptions, v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware)
+		})
+	}
+	return optFns
+}
+
+// The hashes of the payloads written, computed once per payload: their
+// SHA256, so that writes can be signed with the hash of their payload without
+// reading it for every request, for endpoints rejecting unsigned payloads, or
+// their MD5 to check ETags. Payloads are the size bytes found at start in the
+// data stream of a seed. Only the maxPayloadHashes most recently used hashes
+// are kept, as payloads are distinct for every object with verifyContent or
+// a size distribution.
+type PayloadHashes struct {
+	newHash func() hash.Hash
+	mu      sync.Mutex
+	hashes  map[payloadKey]*list.Element
+	// Least recently used last
+	recent *list.List
+}
+
+const maxPayloadHashes = 4096
+
+type payloadKey struct {
+	seed        uint64
+	start, size int64
+}
+
+type payloadHash struct {
+	key  payloadKey
+	once sync.Once
+	hash string
+}
+
+func NewPayloadHashes(newHash func() hash.Hash) *PayloadHashes {
+	return &PayloadHashes{newHash: newHash, hashes: make(map[payloadKey]*list.Element), recent: list.New()}
+}
+
+// Returns the hex encoded hash of a payload, computing it if it is not kept
+// and waiting for it if another request is computing it
+func (h *PayloadHashes) get(payload *RandomReader) string {
+	key := payloadKey{seed: payload.seed, start: payload.start, size: payload.size}
+	h.mu.Lock()
+	element, ok := h.hashes[key]
+	if ok {
+		h.recent.MoveToFront(element)
+	} else {
+		element = h.recent.PushFront(&payloadHash{key: key})
+		h.hashes[key] = element
+		if h.recent.Len() > maxPayloadHashes {
+			delete(h.hashes, h.recent.Remove(h.recent.Back()).(*payloadHash).key)
+		}
+	}
+	entry := element.Value.(*payloadHash)
+	h.mu.Unlock()
+	entry.once.Do(func() {
+		sum := h.newHash()
+		io.Copy(sum, NewRandomReader(key.seed, key.start, key.size))
+		entry.hash = hex.EncodeToString(sum.Sum(nil))
+	})
+	return entry.hash
+}
+
+// Returns the options of a request writing payload: unsigned, or signed with
+// the SHA256 of payload when payload hashes are kept, which needs a payload
+// generated by the benchmark
+func (params *Params) writeOptions(traceID, spanID string, capture *responseCapture, payload io.Reader) ([]func(*s3.Options), error) {
+	if params.payloadHashes == nil {
+		return requestOptions(traceID, spanID, capture, true), nil
+	}
+	data, ok := payload.(*RandomReader)
+	if !ok {
+		return nil, fmt.Errorf("signedPayload can not sign a payload of type %T", payload)
+	}
+	hash := params.payloadHashes.get(data)
+	return append(requestOptions(traceID, spanID, capture, false), func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			// Both the middleware computing the hash and the one leaving
+			// the payload unsigned keep a hash already set
+			return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("s3benchPayloadHash",
+				func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+					return next.HandleFinalize(v4.SetPayloadHash(ctx, hash), in)
+				}), "ComputePayloadHash", middleware.Before)
+		})
+	}), nil
+}
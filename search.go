@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	opSearch = "Search"
+
+	searchByTagging  = "tagging"
+	searchByMetadata = "metadata"
+)
+
+// Emulates a search by attribute on a store without a metadata index: every
+// query lists the prefix and fetches the tags, or the user metadata with a
+// HEAD, of every object listed to find those carrying the wanted value
+type SearchParams struct {
+	key   string
+	value string
+	by    string
+	// Number of queries run, and percentage of written objects given the
+	// wanted value
+	queries   int
+	matchRate float64
+}
+
+func ParseSearchParams(tag, by string, queries int, matchRate float64) (*SearchParams, error) {
+	kv := strings.SplitN(tag, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return nil, fmt.Errorf("invalid searchTag %q, expected key=value", tag)
+	}
+	if by != searchByTagging && by != searchByMetadata {
+		return nil, fmt.Errorf("invalid searchBy %q, expected %s or %s", by, searchByTagging, searchByMetadata)
+	}
+	if queries < 1 || matchRate < 0 || matchRate > 100 {
+		return nil, fmt.Errorf("searchQueries needs to be greater than 0 and searchMatch between 0 and 100")
+	}
+	return &SearchParams{key: kv[0], value: kv[1], by: by, queries: queries, matchRate: matchRate}, nil
+}
+
+// Returns the value of the searched attribute of the i-th object written,
+// the wanted value for searchMatch percent of them
+func (s *SearchParams) valueOf(i int) string {
+	// Independent of the numbers SizeDistribution draws from
+	u := float64(NewRandomReader(1, 0, 0).word(int64(i))>>11) / (1 << 53)
+	if u*100 < s.matchRate {
+		return s.value
+	}
+	return s.value + "-other"
+}
+
+// Sets the searched attribute on an object about to be written
+func (s *SearchParams) apply(input *s3.PutObjectInput, i int) {
+	if s.by == searchByTagging {
+		input.Tagging = aws.String(url.QueryEscape(s.key) + "=" + url.QueryEscape(s.valueOf(i)))
+	} else {
+		input.Metadata = map[string]string{s.key: s.valueOf(i)}
+	}
+}
+
+// Returns whether the response to a GetObjectTagging or HeadObject request
+// carries the wanted value
+func (s *SearchParams) matches(output interface{}) bool {
+	switch o := output.(type) {
+	case *s3.GetObjectTaggingOutput:
+		for _, tag := range o.TagSet {
+			if aws.ToString(tag.Key) == s.key && aws.ToString(tag.Value) == s.value {
+				return true
+			}
+		}
+	case *s3.HeadObjectOutput:
+		// The SDK lowercases metadata names
+		for name, value := range o.Metadata {
+			if strings.EqualFold(name, s.key) && value == s.value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// The timing of the queries of a search test
+type SearchReport struct {
+	params        *SearchParams
+	prefix        string
+	queryTimes    Histogram
+	listTimes     Histogram
+	numExamined   int
+	numMatched    int
+	numErrors     int
+	totalDuration time.Duration
+}
+
+// Runs searchQueries queries one after the other, each listing the prefix
+// and then examining the objects listed through the client pool
+func (params *Params) RunSearch(svc *s3.Client) SearchReport {
+	report := SearchReport{params: params.search, prefix: params.objectNamePrefix}
+	startTime := time.Now()
+	for q := 0; q < params.search.queries; q++ {
+		queryStartTime := time.Now()
+		var keys []string
+		input := &s3.ListObjectsV2Input{
+			Bucket: aws.String(params.bucketName),
+			Prefix: aws.String(params.objectNamePrefix),
+		}
+		var err error
+		for pages := s3.NewListObjectsV2Paginator(svc, input); err == nil && pages.HasMorePages(); {
+			var page *s3.ListObjectsV2Output
+			if page, err = pages.NextPage(context.Background()); err == nil {
+				for _, obj := range page.Contents {
+					keys = append(keys, *obj.Key)
+				}
+			}
+		}
+		if err != nil {
+			fmt.Printf("Query %d failed to list s3://%s/%s (%v)\n", q+1, params.bucketName, params.objectNamePrefix, err)
+			report.numErrors++
+			continue
+		}
+		report.listTimes.Record(time.Since(queryStartTime).Seconds())
+
+		// Offer the examination of every key to the clients while
+		// collecting the responses
+		numMatched, pending, outstanding := 0, keys, len(keys)
+		for outstanding > 0 {
+			var requests chan Req
+			var next Req
+			if len(pending) > 0 {
+				requests = params.requests
+				if params.search.by == searchByTagging {
+					next = &s3.GetObjectTaggingInput{Bucket: input.Bucket, Key: aws.String(pending[0])}
+				} else {
+					head := &s3.HeadObjectInput{Bucket: input.Bucket, Key: aws.String(pending[0])}
+					if params.sse != nil {
+						params.sse.applyHead(head)
+					}
+					next = head
+				}
+			}
+			select {
+			case requests <- next:
+				pending = pending[1:]
+			case resp := <-params.responses:
+				outstanding--
+				if resp.err != nil {
+					report.numErrors++
+				} else if params.search.matches(resp.output) {
+					numMatched++
+				}
+			}
+		}
+		report.queryTimes.Record(time.Since(queryStartTime).Seconds())
+		report.numExamined += len(keys)
+		report.numMatched += numMatched
+		if params.verbose {
+			fmt.Printf("Query %d matched %d/%d objects in %s\n", q+1, numMatched, len(keys), time.Since(queryStartTime))
+		}
+	}
+	report.totalDuration = time.Since(startTime)
+	return report
+}
+
+func (r SearchReport) String() string {
+	s := r.params
+	report := fmt.Sprintf("Results Summary for %s by %s %s=%s under %s\n", opSearch, s.by, s.key, s.value, r.prefix)
+	queries := r.queryTimes.Count()
+	report += fmt.Sprintf("Queries:           %d\n", queries)
+	report += fmt.Sprintf("Number of Errors:  %d\n", r.numErrors)
+	if queries == 0 {
+		return report
+	}
+	report += fmt.Sprintf("Objects Examined:  %d per query\n", r.numExamined/queries)
+	report += fmt.Sprintf("Objects Matched:   %d per query\n", r.numMatched/queries)
+	report += fmt.Sprintf("Examined Rate:     %0.1f objects/s\n", float64(r.numExamined)/r.queryTimes.Sum())
+	report += fmt.Sprintf("Listing Share:     %0.1f%% of query time\n", 100*r.listTimes.Sum()/r.queryTimes.Sum())
+	report += fmt.Sprintln("------------------------------------")
+	report += fmt.Sprintf("Query times Max:       %0.3f s\n", r.queryTimes.Percentile(100))
+	report += fmt.Sprintf("Query times 90th %%ile: %0.3f s\n", r.queryTimes.Percentile(90))
+	report += fmt.Sprintf("Query times 50th %%ile: %0.3f s\n", r.queryTimes.Percentile(50))
+	report += fmt.Sprintf("Query times Min:       %0.3f s\n", r.queryTimes.Percentile(0))
+	return report
+}
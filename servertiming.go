@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timing and quota information reported by the server in response headers
+type ServerHeaders struct {
+	// Server processing time, only valid when hasServerTime is set
+	serverTime    time.Duration
+	hasServerTime bool
+	// x-ratelimit-remaining and x-ratelimit-limit, -1 when absent
+	rateLimitRemaining int64
+	rateLimitLimit     int64
+	requestCharged     bool
+}
+
+// Extracts server side timing from a response. Server-Timing is used when
+// present, taking its "total" metric or else the sum of all metrics, followed
+// by the custom gateway headers given, whose values are in milliseconds
+// unless they carry a unit.
+func parseServerHeaders(header http.Header, timingHeaders []string) ServerHeaders {
+	h := ServerHeaders{rateLimitRemaining: -1, rateLimitLimit: -1}
+	if header == nil {
+		return h
+	}
+
+	if values := header.Values("Server-Timing"); len(values) > 0 {
+		h.serverTime, h.hasServerTime = parseServerTiming(strings.Join(values, ","))
+	}
+	for _, name := range timingHeaders {
+		if h.hasServerTime {
+			break
+		}
+		if value := strings.TrimSpace(header.Get(name)); value != "" {
+			h.serverTime, h.hasServerTime = parseTimingValue(value)
+		}
+	}
+
+	if value, err := strconv.ParseInt(header.Get("X-Ratelimit-Remaining"), 10, 64); err == nil {
+		h.rateLimitRemaining = value
+	}
+	if value, err := strconv.ParseInt(header.Get("X-Ratelimit-Limit"), 10, 64); err == nil {
+		h.rateLimitLimit = value
+	}
+	h.requestCharged = header.Get("X-Amz-Request-Charged") != ""
+	return h
+}
+
+// Parses a Server-Timing header, eg: db;dur=53, app;dur=47.2;desc="app"
+func parseServerTiming(value string) (time.Duration, bool) {
+	var sum time.Duration
+	found := false
+	for _, metric := range strings.Split(value, ",") {
+		params := strings.Split(metric, ";")
+		name := strings.TrimSpace(params[0])
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) != 2 || kv[0] != "dur" {
+				continue
+			}
+			ms, err := strconv.ParseFloat(strings.Trim(kv[1], "\""), 64)
+			if err != nil {
+				continue
+			}
+			dur := time.Duration(ms * float64(time.Millisecond))
+			if name == "total" {
+				return dur, true
+			}
+			sum += dur
+			found = true
+		}
+	}
+	return sum, found
+}
+
+func parseTimingValue(value string) (time.Duration, bool) {
+	if ms, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return d, true
+	}
+	return 0, false
+}
+
+// Server reported timings of the successful operations of a test
+type ServerTimingStats struct {
+	serverTimes        Histogram
+	networkTimes       Histogram
+	numRequestCharged  int
+	minRateLimitRemain int64
+	rateLimitLimit     int64
+	numRateLimited     int
+}
+
+func (r *Result) addServerHeaders(resp Resp) {
+	h := resp.serverHeaders
+	if !h.hasServerTime && h.rateLimitRemaining < 0 && !h.requestCharged {
+		return
+	}
+	if r.serverTiming == nil {
+		r.serverTiming = &ServerTimingStats{minRateLimitRemain: -1, rateLimitLimit: -1}
+	}
+	s := r.serverTiming
+	if h.hasServerTime && resp.err == nil {
+		// Whatever the server did not account for was spent on the network
+		// and in the client
+		s.serverTimes.Record(h.serverTime.Seconds())
+		s.networkTimes.Record((resp.duration - h.serverTime).Seconds())
+	}
+	if h.requestCharged {
+		s.numRequestCharged++
+	}
+	if h.rateLimitRemaining >= 0 {
+		s.numRateLimited++
+		if s.minRateLimitRemain < 0 || h.rateLimitRemaining < s.minRateLimitRemain {
+			s.minRateLimitRemain = h.rateLimitRemaining
+		}
+	}
+	if h.rateLimitLimit >= 0 {
+		s.rateLimitLimit = h.rateLimitLimit
+	}
+}
+
+func (r Result) serverTimingReport() string {
+	s := r.serverTiming
+	report := ""
+	if s.serverTimes.Count() > 0 {
+		report += fmt.Sprintf("%s server vs network time (%d ops with server timing):\n", r.operation, s.serverTimes.Count())
+		for _, p := range []float64{50, 90, 99} {
+			report += fmt.Sprintf("%gth %%ile: server %0.3f s, network %0.3f s\n",
+				p, s.serverTimes.Percentile(p), s.networkTimes.Percentile(p))
+		}
+	}
+	if s.numRateLimited > 0 {
+		report += fmt.Sprintf("Rate limit: %d ops reported quota, lowest remaining %d of %d\n",
+			s.numRateLimited, s.minRateLimitRemain, s.rateLimitLimit)
+	}
+	if s.numRequestCharged > 0 {
+		report += fmt.Sprintf("Requester charged: %d ops\n", s.numRequestCharged)
+	}
+	return report
+}
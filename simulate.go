@@ -0,0 +1,514 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An in-memory S3 server covering the requests the benchmark makes, so that
+// workloads, reporting and manifests can be exercised without an endpoint.
+// Keys are only stored per bucket and versions are not kept, a version ID in
+// a request is ignored. Objects completed from multipart uploads get the
+// attributes of the request creating the upload, kept in created.
+type SimulatedS3 struct {
+	mu       sync.Mutex
+	buckets  map[string]map[string]*simulatedObject
+	uploads  map[string]map[int]simulatedPart
+	created  map[string]*simulatedObject
+	listener net.Listener
+}
+
+type simulatedObject struct {
+	data         []byte
+	etag         string
+	lastModified time.Time
+	// The X-Amz-Tagging, X-Amz-Meta-* and server-side encryption headers of
+	// the PUT, the latter two returned by reads
+	tags     url.Values
+	metadata http.Header
+	// The canned ACL last set, private when empty
+	acl string
+	// The X-Amz-Checksum-* headers of the PUT, returned by reads of the
+	// whole object in checksum mode
+	checksums http.Header
+}
+
+// Default object size of runs against the simulated S3, which keeps every
+// object in memory
+const simulatedObjectSize = 1024 * 1024
+
+// A part of a multipart upload and its MD5
+type simulatedPart struct {
+	data []byte
+	sum  [md5.Size]byte
+}
+
+// Serves the given buckets on a random local port
+func StartSimulatedS3(buckets ...string) (*SimulatedS3, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &SimulatedS3{
+		buckets:  make(map[string]map[string]*simulatedObject),
+		uploads:  make(map[string]map[int]simulatedPart),
+		created:  make(map[string]*simulatedObject),
+		listener: listener,
+	}
+	for _, bucket := range buckets {
+		s.buckets[bucket] = make(map[string]*simulatedObject)
+	}
+	go http.Serve(listener, s)
+	return s, nil
+}
+
+func (s *SimulatedS3) Endpoint() string {
+	return "http://" + s.listener.Addr().String()
+}
+
+func (s *SimulatedS3) Close() error {
+	return s.listener.Close()
+}
+
+// Keeps the tags and user metadata sent with a PUT
+func (obj *simulatedObject) setAttributes(r *http.Request) {
+	obj.tags, _ = url.ParseQuery(r.Header.Get("X-Amz-Tagging"))
+	obj.metadata = make(http.Header)
+	obj.checksums = make(http.Header)
+	for name, values := range r.Header {
+		if strings.HasPrefix(name, "X-Amz-Checksum-") && name != "X-Amz-Checksum-Algorithm" {
+			obj.checksums[name] = values
+		}
+		// Customer-provided keys are not kept, only their MD5
+		if strings.HasPrefix(name, "X-Amz-Meta-") ||
+			strings.HasPrefix(name, "X-Amz-Server-Side-Encryption") && name != "X-Amz-Server-Side-Encryption-Customer-Key" {
+			obj.metadata[name] = values
+		}
+	}
+}
+
+// Requests are path style, /bucket/key. Bodies are transferred outside the
+// lock, which is only held to look up and update the buckets, so that
+// requests are served concurrently as by a real endpoint.
+func (s *SimulatedS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucketName := parts[0]
+	key := ""
+	if len(parts) == 2 {
+		key = parts[1]
+	}
+
+	w.Header().Set("x-amz-request-id", strconv.FormatInt(time.Now().UnixNano(), 36))
+	var body []byte
+	var sum [md5.Size]byte
+	if r.Method == http.MethodPut || r.Method == http.MethodPost {
+		var err error
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			simulatedError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		sum = md5.Sum(body)
+	}
+	s.mu.Lock()
+	data := s.serve(w, r, bucketName, key, body, sum)
+	s.mu.Unlock()
+	if data != nil {
+		w.Write(data)
+	}
+}
+
+// Serves a request with the lock held, given the body of a PUT or POST and
+// its MD5, returning the data of the response body, if any, to send once the
+// lock is released
+func (s *SimulatedS3) serve(w http.ResponseWriter, r *http.Request, bucketName, key string, body []byte, sum [md5.Size]byte) []byte {
+	bucket, ok := s.buckets[bucketName]
+	if !ok && key == "" && r.Method == http.MethodPut {
+		// CreateBucket
+		s.buckets[bucketName] = make(map[string]*simulatedObject)
+		return nil
+	}
+	if !ok {
+		simulatedError(w, http.StatusNotFound, "NoSuchBucket")
+		return nil
+	}
+
+	query := r.URL.Query()
+	switch {
+	case key != "" && (query["uploads"] != nil || query.Get("uploadId") != ""):
+		s.multipart(w, r, bucketName, bucket, key, body, sum)
+	case key == "" && r.Method == http.MethodHead:
+		// HeadBucket
+	case key == "" && r.Method == http.MethodPut && len(query) > 0:
+		// Bucket configuration such as versioning or policies
+		simulatedError(w, http.StatusNotImplemented, "NotImplemented")
+	case key == "" && r.Method == http.MethodPut:
+		simulatedError(w, http.StatusConflict, "BucketAlreadyOwnedByYou")
+	case key == "" && r.Method == http.MethodDelete && len(bucket) > 0:
+		simulatedError(w, http.StatusConflict, "BucketNotEmpty")
+	case key == "" && r.Method == http.MethodDelete:
+		delete(s.buckets, bucketName)
+		w.WriteHeader(http.StatusNoContent)
+	case key == "" && r.Method == http.MethodGet:
+		s.list(w, r, bucket)
+	case key == "" && r.Method == http.MethodPost && query["delete"] != nil:
+		s.deleteObjects(w, bucket, body)
+	case key == "":
+		simulatedError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	case query["acl"] != nil && (r.Method == http.MethodPut || r.Method == http.MethodGet):
+		s.acl(w, r, bucket, key)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		s.copyObject(w, r, bucket, key)
+	case r.Method == http.MethodPut:
+		if contentMD5 := r.Header.Get("Content-Md5"); contentMD5 != "" && contentMD5 != base64.StdEncoding.EncodeToString(sum[:]) {
+			simulatedError(w, http.StatusBadRequest, "BadDigest")
+			return nil
+		}
+		obj := &simulatedObject{data: body, etag: simulatedETag(sum), lastModified: time.Now()}
+		obj.setAttributes(r)
+		bucket[key] = obj
+		w.Header().Set("ETag", obj.etag)
+	case r.Method == http.MethodGet && query["tagging"] != nil:
+		s.tagging(w, bucket, key)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		obj, ok := bucket[key]
+		if !ok {
+			simulatedError(w, http.StatusNotFound, "NoSuchKey")
+			return nil
+		}
+		if md5 := obj.metadata.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5"); md5 != "" &&
+			r.Header.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5") != md5 {
+			simulatedError(w, http.StatusBadRequest, "InvalidRequest")
+			return nil
+		}
+		w.Header().Set("ETag", obj.etag)
+		w.Header().Set("Last-Modified", obj.lastModified.UTC().Format(http.TimeFormat))
+		for name, values := range obj.metadata {
+			w.Header()[name] = values
+		}
+		data := obj.data
+		var first, last int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &first, &last); err == nil && r.Method == http.MethodGet {
+			// Only the bytes=first-last form the read test sends
+			if first > last || first >= len(data) {
+				simulatedError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+				return nil
+			}
+			if last >= len(data) {
+				last = len(data) - 1
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, len(data)))
+			w.Header().Set("Content-Length", strconv.Itoa(last-first+1))
+			w.WriteHeader(http.StatusPartialContent)
+			return data[first : last+1]
+		}
+		if r.Header.Get("X-Amz-Checksum-Mode") == "ENABLED" {
+			for name, values := range obj.checksums {
+				w.Header()[name] = values
+			}
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if r.Method == http.MethodGet {
+			// Objects are replaced rather than modified, so their data
+			// can be sent without the lock
+			return data
+		}
+	case r.Method == http.MethodDelete:
+		delete(bucket, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		simulatedError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+	return nil
+}
+
+// CopyObject, the source is /bucket/key URL-encoded
+func (s *SimulatedS3) copyObject(w http.ResponseWriter, r *http.Request, bucket map[string]*simulatedObject, key string) {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		simulatedError(w, http.StatusBadRequest, "InvalidArgument")
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
+	var src *simulatedObject
+	if len(parts) == 2 {
+		src = s.buckets[parts[0]][parts[1]]
+	}
+	if src == nil {
+		simulatedError(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+	obj := &simulatedObject{data: src.data, etag: src.etag, lastModified: time.Now(), tags: src.tags, metadata: src.metadata}
+	bucket[key] = obj
+	simulatedXML(w, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		ETag         string
+		LastModified string
+	}{ETag: obj.etag, LastModified: obj.lastModified.UTC().Format(time.RFC3339)})
+}
+
+// PutObjectAcl of a canned ACL, and GetObjectAcl granting the owner full
+// control and everyone read access under the public canned ACLs
+func (s *SimulatedS3) acl(w http.ResponseWriter, r *http.Request, bucket map[string]*simulatedObject, key string) {
+	obj, ok := bucket[key]
+	if !ok {
+		simulatedError(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+	if r.Method == http.MethodPut {
+		obj.acl = r.Header.Get("X-Amz-Acl")
+		return
+	}
+	type grant struct {
+		ID         string `xml:"Grantee>ID,omitempty"`
+		URI        string `xml:"Grantee>URI,omitempty"`
+		Permission string
+	}
+	policy := struct {
+		XMLName xml.Name `xml:"AccessControlPolicy"`
+		OwnerID string   `xml:"Owner>ID"`
+		Grants  []grant  `xml:"AccessControlList>Grant"`
+	}{OwnerID: "s3bench", Grants: []grant{{ID: "s3bench", Permission: "FULL_CONTROL"}}}
+	if strings.HasPrefix(obj.acl, "public-read") {
+		policy.Grants = append(policy.Grants, grant{URI: "http://acs.amazonaws.com/groups/global/AllUsers", Permission: "READ"})
+	}
+	simulatedXML(w, policy)
+}
+
+// GetObjectTagging
+func (s *SimulatedS3) tagging(w http.ResponseWriter, bucket map[string]*simulatedObject, key string) {
+	obj, ok := bucket[key]
+	if !ok {
+		simulatedError(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+	type tag struct {
+		Key   string
+		Value string
+	}
+	tagging := struct {
+		XMLName xml.Name `xml:"Tagging"`
+		TagSet  []tag    `xml:"TagSet>Tag"`
+	}{}
+	for name, values := range obj.tags {
+		for _, value := range values {
+			tagging.TagSet = append(tagging.TagSet, tag{name, value})
+		}
+	}
+	simulatedXML(w, tagging)
+}
+
+func simulatedETag(sum [md5.Size]byte) string {
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// Creating, uploading parts of, completing and aborting multipart uploads.
+// Completing an upload uses every part uploaded, in part number order.
+func (s *SimulatedS3) multipart(w http.ResponseWriter, r *http.Request, bucketName string, bucket map[string]*simulatedObject, key string, body []byte, sum [md5.Size]byte) {
+	query := r.URL.Query()
+	uploadID := query.Get("uploadId")
+	if query["uploads"] != nil && r.Method == http.MethodPost {
+		uploadID = strconv.FormatInt(time.Now().UnixNano(), 36)
+		s.uploads[uploadID] = make(map[int]simulatedPart)
+		s.created[uploadID] = &simulatedObject{}
+		s.created[uploadID].setAttributes(r)
+		simulatedXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: bucketName, Key: key, UploadId: uploadID})
+		return
+	}
+	parts, ok := s.uploads[uploadID]
+	if !ok {
+		simulatedError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		partNumber, err := strconv.Atoi(query.Get("partNumber"))
+		if err != nil || partNumber < 1 {
+			simulatedError(w, http.StatusBadRequest, "InvalidArgument")
+			return
+		}
+		parts[partNumber] = simulatedPart{data: body, sum: sum}
+		w.Header().Set("ETag", simulatedETag(sum))
+	case http.MethodPost:
+		numbers := make([]int, 0, len(parts))
+		for partNumber := range parts {
+			numbers = append(numbers, partNumber)
+		}
+		sort.Ints(numbers)
+		var data, sums []byte
+		for _, partNumber := range numbers {
+			part := parts[partNumber]
+			data = append(data, part.data...)
+			sums = append(sums, part.sum[:]...)
+		}
+		sumOfSums := md5.Sum(sums)
+		obj := &simulatedObject{
+			data:         data,
+			etag:         fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sumOfSums[:]), len(numbers)),
+			lastModified: time.Now(),
+			tags:         s.created[uploadID].tags,
+			metadata:     s.created[uploadID].metadata,
+		}
+		bucket[key] = obj
+		delete(s.uploads, uploadID)
+		delete(s.created, uploadID)
+		simulatedXML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: bucketName, Key: key, ETag: obj.etag})
+	case http.MethodDelete:
+		delete(s.uploads, uploadID)
+		delete(s.created, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		simulatedError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+type simulatedListing struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Name                  string
+	Prefix                string
+	Delimiter             string `xml:",omitempty"`
+	KeyCount              int
+	MaxKeys               int
+	IsTruncated           bool
+	NextContinuationToken string `xml:",omitempty"`
+	Contents              []struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+}
+
+// ListObjectsV2, the continuation token is the last key returned
+func (s *SimulatedS3) list(w http.ResponseWriter, r *http.Request, bucket map[string]*simulatedObject) {
+	query := r.URL.Query()
+	listing := simulatedListing{
+		Name:      strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0],
+		Prefix:    query.Get("prefix"),
+		Delimiter: query.Get("delimiter"),
+		MaxKeys:   1000,
+	}
+	if maxKeys, err := strconv.Atoi(query.Get("max-keys")); err == nil && maxKeys > 0 && maxKeys < listing.MaxKeys {
+		listing.MaxKeys = maxKeys
+	}
+	after := query.Get("continuation-token")
+	if after == "" {
+		after = query.Get("start-after")
+	}
+
+	keys := make([]string, 0, len(bucket))
+	for key := range bucket {
+		if strings.HasPrefix(key, listing.Prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	seenPrefixes := make(map[string]bool)
+	for _, key := range keys {
+		if listing.KeyCount == listing.MaxKeys {
+			listing.IsTruncated = true
+			break
+		}
+		if listing.Delimiter != "" {
+			if i := strings.Index(key[len(listing.Prefix):], listing.Delimiter); i >= 0 {
+				commonPrefix := key[:len(listing.Prefix)+i+len(listing.Delimiter)]
+				if !seenPrefixes[commonPrefix] {
+					seenPrefixes[commonPrefix] = true
+					listing.CommonPrefixes = append(listing.CommonPrefixes, struct{ Prefix string }{commonPrefix})
+					listing.KeyCount++
+				}
+				listing.NextContinuationToken = key
+				continue
+			}
+		}
+		obj := bucket[key]
+		listing.Contents = append(listing.Contents, struct {
+			Key          string
+			LastModified string
+			ETag         string
+			Size         int
+		}{key, obj.lastModified.UTC().Format(time.RFC3339Nano), obj.etag, len(obj.data)})
+		listing.KeyCount++
+		listing.NextContinuationToken = key
+	}
+	if !listing.IsTruncated {
+		listing.NextContinuationToken = ""
+	} else if listing.Delimiter != "" {
+		// Continue after every key under the last common prefix returned
+		if n := len(listing.CommonPrefixes); n > 0 && strings.HasPrefix(listing.NextContinuationToken, listing.CommonPrefixes[n-1].Prefix) {
+			listing.NextContinuationToken = listing.CommonPrefixes[n-1].Prefix + "\xff"
+		}
+	}
+	simulatedXML(w, listing)
+}
+
+// DeleteObjects, every key is reported as deleted whether it existed or not
+func (s *SimulatedS3) deleteObjects(w http.ResponseWriter, bucket map[string]*simulatedObject, body []byte) {
+	var request struct {
+		Object []struct {
+			Key string
+		}
+		Quiet bool
+	}
+	if err := xml.Unmarshal(body, &request); err != nil {
+		simulatedError(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+	type deleted struct {
+		Key string
+	}
+	result := struct {
+		XMLName xml.Name `xml:"DeleteResult"`
+		Deleted []deleted
+	}{}
+	for _, obj := range request.Object {
+		delete(bucket, obj.Key)
+		if !request.Quiet {
+			result.Deleted = append(result.Deleted, deleted{obj.Key})
+		}
+	}
+	simulatedXML(w, result)
+}
+
+func simulatedXML(w http.ResponseWriter, v interface{}) {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		simulatedError(w, http.StatusInternalServerError, "InternalError")
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	w.Write(body)
+}
+
+func simulatedError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "%s<Error><Code>%s</Code><Message>%s</Message></Error>", xml.Header, code, http.StatusText(status))
+}
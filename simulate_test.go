@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/md5"
+	"testing"
+)
+
+const testBucket = "bench"
+
+// Returns the parameters of a run against a simulated S3, with its clients
+// started. They stop when the requests channel is closed.
+func newSimulatedParams(t *testing.T, s *SimulatedS3, numSamples int, objectSize int64) *Params {
+	params := &Params{
+		requests:         make(chan Req),
+		responses:        make(chan Resp),
+		clockOffset:      &ClockOffsetTracker{},
+		numSamples:       numSamples,
+		numClients:       4,
+		objectSize:       objectSize,
+		objectNamePrefix: "loadgen_test_",
+		bucketName:       testBucket,
+		buckets:          []string{testBucket},
+		bucketSpread:     bucketSpreadRoundRobin,
+		endpoints:        []string{s.Endpoint()},
+		deleteBatchSize:  commitSize,
+		keyCharset:       keyCharsetASCII,
+		addressingStyle:  addressingPath,
+	}
+	cfg, err := loadConfig("igneous-test", "", "simulated", "simulated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params.StartClients(cfg)
+	t.Cleanup(func() { close(params.requests) })
+	return params
+}
+
+func (s *SimulatedS3) numObjects(bucket string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets[bucket])
+}
+
+func TestSimulatedWorkloads(t *testing.T) {
+	tests := []struct {
+		name          string
+		numSamples    int
+		objectSize    int64
+		multipartSize int64
+		verifyContent bool
+		verifyETag    bool
+		etagFormat    bool
+	}{
+		{name: "small objects", numSamples: 20, objectSize: 1024},
+		{name: "empty objects", numSamples: 8, objectSize: 0},
+		{name: "multipart", numSamples: 8, objectSize: 3 * 1024 * 1024, multipartSize: 1024 * 1024, etagFormat: true},
+		{name: "verified content", numSamples: 20, objectSize: 64 * 1024, verifyContent: true, verifyETag: true, etagFormat: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := StartSimulatedS3(testBucket)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			params := newSimulatedParams(t, s, tt.numSamples, tt.objectSize)
+			params.multipartSize = tt.multipartSize
+			params.multipartConcurrency = 2
+			params.verifyContent = tt.verifyContent
+			if tt.verifyETag {
+				params.etags = make(ETags)
+			}
+			if tt.etagFormat {
+				params.etagMD5s = NewPayloadHashes(md5.New)
+			}
+
+			write := params.Run(opWrite)
+			if write.numErrors != 0 || write.opDurations.Count() != tt.numSamples {
+				t.Fatalf("write: %d errors, %d operations, expected %d", write.numErrors, write.opDurations.Count(), tt.numSamples)
+			}
+			if want := int64(tt.numSamples) * tt.objectSize; write.bytesTransmitted != want {
+				t.Errorf("write: %d bytes transmitted, expected %d", write.bytesTransmitted, want)
+			}
+			if n := s.numObjects(testBucket); n != tt.numSamples {
+				t.Fatalf("%d objects in the bucket after the write test, expected %d", n, tt.numSamples)
+			}
+			if conforming, _ := write.etagConformance(); tt.etagFormat && conforming != tt.numSamples {
+				t.Errorf("write: %d conforming ETags, expected %d: %v", conforming, tt.numSamples, write.etagFormats)
+			}
+
+			read := params.Run(opRead)
+			if read.numErrors != 0 || read.opDurations.Count() != tt.numSamples {
+				t.Fatalf("read: %d errors, %d operations, expected %d", read.numErrors, read.opDurations.Count(), tt.numSamples)
+			}
+			if tt.verifyETag && read.etagsChecked != tt.numSamples {
+				t.Errorf("read: %d ETags checked, expected %d", read.etagsChecked, tt.numSamples)
+			}
+
+			deleted := params.RunDelete()
+			if deleted.numErrors != 0 || deleted.numDeleted != tt.numSamples {
+				t.Fatalf("delete: %d errors, %d objects deleted, expected %d", deleted.numErrors, deleted.numDeleted, tt.numSamples)
+			}
+			if n := s.numObjects(testBucket); n != 0 {
+				t.Errorf("%d objects left in the bucket after the delete test", n)
+			}
+		})
+	}
+}
+
+func TestSimulatedReadOfOtherData(t *testing.T) {
+	s, err := StartSimulatedS3(testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	params := newSimulatedParams(t, s, 8, 4096)
+	params.verifyContent = true
+	if write := params.Run(opWrite); write.numErrors != 0 {
+		t.Fatalf("write: %d errors", write.numErrors)
+	}
+
+	// Serve every object with the data of the first one
+	s.mu.Lock()
+	first := s.buckets[testBucket][params.writtenKeys[0]]
+	for key, obj := range s.buckets[testBucket] {
+		if key != params.writtenKeys[0] {
+			obj.data = first.data
+		}
+	}
+	s.mu.Unlock()
+
+	read := params.Run(opRead)
+	if read.numErrors != 7 {
+		t.Errorf("read: %d errors, expected 7 reads of the data of another object to fail", read.numErrors)
+	}
+}
+
+func TestSimulatedRepair(t *testing.T) {
+	s, err := StartSimulatedS3(testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	params := newSimulatedParams(t, s, 8, 4096)
+	params.verifyContent = true
+	params.repair = true
+	if write := params.Run(opWrite); write.numErrors != 0 {
+		t.Fatalf("write: %d errors", write.numErrors)
+	}
+
+	// Corrupt the data of two objects
+	s.mu.Lock()
+	for _, key := range params.writtenKeys[:2] {
+		obj := s.buckets[testBucket][key]
+		data := append([]byte(nil), obj.data...)
+		data[0]++
+		obj.data = data
+	}
+	s.mu.Unlock()
+
+	read := params.Run(opRead)
+	if read.numErrors != 2 || len(read.corruptKeys) != 2 {
+		t.Fatalf("read: %d errors, %d corrupt objects, expected 2", read.numErrors, len(read.corruptKeys))
+	}
+	cfg, err := loadConfig("igneous-test", "", "simulated", "simulated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params.repairObjects(params.newS3Client(cfg, s.Endpoint()), &read)
+	if read.numRepaired != 2 || read.numUnrepairable != 0 {
+		t.Errorf("%d objects repaired and %d unrepairable, expected 2 and 0", read.numRepaired, read.numUnrepairable)
+	}
+	if read := params.Run(opRead); read.numErrors != 0 {
+		t.Errorf("read after the repair: %d errors", read.numErrors)
+	}
+}
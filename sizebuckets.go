@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Latencies of the successful operations on objects within a size range.
+// Ranges are powers of two so that small and large objects, whose latencies
+// are not comparable, never share a bucket.
+type SizeBucket struct {
+	minSize          int64
+	bytesTransmitted int64
+	opDurations      Histogram
+}
+
+// Returns the lower bound of the power of two range the size falls in
+func sizeBucketFloor(size int64) int64 {
+	if size == 0 {
+		return 0
+	}
+	floor := int64(1)
+	for floor*2 <= size {
+		floor *= 2
+	}
+	return floor
+}
+
+func (r *Result) addToSizeBucket(resp Resp) {
+	if r.sizeBuckets == nil {
+		r.sizeBuckets = make(map[int64]*SizeBucket)
+	}
+	floor := sizeBucketFloor(resp.numBytes)
+	bucket, ok := r.sizeBuckets[floor]
+	if !ok {
+		bucket = &SizeBucket{minSize: floor}
+		r.sizeBuckets[floor] = bucket
+	}
+	bucket.bytesTransmitted += resp.numBytes
+	bucket.opDurations.Record(resp.duration.Seconds())
+}
+
+// Formats a byte count using the largest binary unit it reaches
+func formatSize(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%g %s", value, units[unit])
+}
+
+// Parses sizes such as 4096, 4KiB, 16MB or 500GiB. KB, MB, GB, TB and PB are
+// powers of 1000, while KiB and the like are powers of 1024 as are K and Kb,
+// which sizes were given as before decimal units were told apart.
+func parseSize(spec string) (int64, error) {
+	number := strings.TrimRightFunc(spec, unicode.IsLetter)
+	unit := spec[len(number):]
+	base := int64(1024)
+	switch {
+	case strings.HasSuffix(unit, "iB") || strings.HasSuffix(unit, "i") || strings.HasSuffix(unit, "b"):
+		unit = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(unit, "B"), "b"), "i")
+	case strings.HasSuffix(unit, "B") && len(unit) > 1:
+		unit = strings.TrimSuffix(unit, "B")
+		base = 1000
+	case unit == "B":
+		unit = ""
+	}
+	exponent, ok := map[string]int{"": 0, "K": 1, "M": 2, "G": 3, "T": 4, "P": 5}[strings.ToUpper(unit)]
+	value, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || !ok || value < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 4096, 4KiB, 16MiB or 1GB", spec)
+	}
+	multiplier := int64(1)
+	for i := 0; i < exponent; i++ {
+		multiplier *= base
+	}
+	size := int64(value * float64(multiplier))
+	if base == 1000 && exponent > 0 {
+		// Decimal units used to be powers of 1024, so a size given as
+		// before now means fewer bytes
+		fmt.Printf("Note: %s is %d bytes, %sB being a power of 1000, use %siB for a power of 1024\n",
+			spec, size, strings.ToUpper(unit), strings.ToUpper(unit))
+	}
+	return size, nil
+}
+
+// A size flag accepting the units of parseSize
+type sizeFlag int64
+
+func (s *sizeFlag) String() string {
+	return strconv.FormatInt(int64(*s), 10)
+}
+
+func (s *sizeFlag) Set(spec string) error {
+	size, err := parseSize(spec)
+	*s = sizeFlag(size)
+	return err
+}
+
+// Parses counts such as 200, 10k, 1.5M or 1G, units being powers of 1000
+func parseCount(spec string) (int, error) {
+	number := strings.TrimRightFunc(spec, unicode.IsLetter)
+	multiplier, ok := map[string]float64{"": 1, "K": 1e3, "M": 1e6, "G": 1e9}[strings.ToUpper(spec[len(number):])]
+	value, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	count := math.Round(value * multiplier)
+	if err != nil || !ok || value < 0 || math.Abs(value*multiplier-count) > 1e-6 {
+		return 0, fmt.Errorf("invalid count %q, expected e.g. 200, 10k or 1M", spec)
+	}
+	return int(count), nil
+}
+
+// A count flag accepting the units of parseCount
+type countFlag int
+
+func (c *countFlag) String() string {
+	return strconv.Itoa(int(*c))
+}
+
+func (c *countFlag) Set(spec string) error {
+	count, err := parseCount(spec)
+	*c = countFlag(count)
+	return err
+}
+
+func (r Result) sizeBucketReport() string {
+	floors := make([]int64, 0, len(r.sizeBuckets))
+	for floor := range r.sizeBuckets {
+		floors = append(floors, floor)
+	}
+	sort.Slice(floors, func(i, j int) bool { return floors[i] < floors[j] })
+
+	report := fmt.Sprintf("%s times by object size:\n", r.operation)
+	report += fmt.Sprintf("%-22s %8s %10s %9s %9s %9s\n", "size range", "count", "MB/s/op", "50th s", "90th s", "99th s")
+	for _, floor := range floors {
+		b := r.sizeBuckets[floor]
+		sizeRange := fmt.Sprintf("[%s, %s)", formatSize(floor), formatSize(2*floor))
+		if floor == 0 {
+			sizeRange = "0 B"
+		}
+		report += fmt.Sprintf("%-22s %8d %10.2f %9.3f %9.3f %9.3f\n",
+			sizeRange, b.opDurations.Count(),
+			(float64(b.bytesTransmitted)/(1024*1024))/b.opDurations.Sum(),
+			b.opDurations.Percentile(50), b.opDurations.Percentile(90), b.opDurations.Percentile(99))
+	}
+	return report
+}
@@ -0,0 +1,92 @@
+package main
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		spec string
+		size int64
+		ok   bool
+	}{
+		{"4096", 4096, true},
+		{"0", 0, true},
+		{"500B", 500, true},
+		{"4KiB", 4096, true},
+		{"4Ki", 4096, true},
+		{"4K", 4096, true},
+		{"4k", 4096, true},
+		{"4Kb", 4096, true},
+		{"16MiB", 16 << 20, true},
+		{"16Mb", 16 << 20, true},
+		{"1.5GiB", 3 << 29, true},
+		{"2TiB", 2 << 40, true},
+		{"1PiB", 1 << 50, true},
+		{"4 KiB", 4096, true},
+		{"4KB", 4000, true},
+		{"4kB", 4000, true},
+		{"16MB", 16000000, true},
+		{"1GB", 1000000000, true},
+		{"2TB", 2000000000000, true},
+		{"", 0, false},
+		{"KiB", 0, false},
+		{"-1", 0, false},
+		{"-4KiB", 0, false},
+		{"4XB", 0, false},
+		{"4EiB", 0, false},
+		{"four", 0, false},
+	}
+	for _, test := range tests {
+		size, err := parseSize(test.spec)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %d", test.spec, size)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+		} else if size != test.size {
+			t.Errorf("%q: %d bytes, expected %d", test.spec, size, test.size)
+		}
+	}
+}
+
+func TestParseCount(t *testing.T) {
+	tests := []struct {
+		spec  string
+		count int
+		ok    bool
+	}{
+		{"200", 200, true},
+		{"0", 0, true},
+		{"10k", 10000, true},
+		{"10K", 10000, true},
+		{"1.5M", 1500000, true},
+		{"2m", 2000000, true},
+		{"1G", 1000000000, true},
+		{"0.001k", 1, true},
+		{" 5", 5, true},
+		{"1.5", 0, false},
+		{"0.0001k", 0, false},
+		{"", 0, false},
+		{"k", 0, false},
+		{"-1", 0, false},
+		{"10KiB", 0, false},
+		{"10T", 0, false},
+		{"many", 0, false},
+	}
+	for _, test := range tests {
+		count, err := parseCount(test.spec)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %d", test.spec, count)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+		} else if count != test.count {
+			t.Errorf("%q: %d, expected %d", test.spec, count, test.count)
+		}
+	}
+}
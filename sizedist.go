@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	sizeDistUniform   = "uniform"
+	sizeDistLognormal = "lognormal"
+	sizeDistWeighted  = "weighted"
+	sizeDistNormal    = "normal"
+)
+
+// A distribution of object sizes. The size of each object is derived from its
+// number alone, so a read test knows the sizes written by an earlier run with
+// the same distribution.
+type SizeDistribution struct {
+	spec string
+	kind string
+	// uniform bounds, or the median and sigma of a lognormal distribution,
+	// or the mean and standard deviation of a normal one
+	min, max int64
+	median   float64
+	sigma    float64
+	// weighted sizes and their cumulative weights
+	sizes   []int64
+	weights []float64
+}
+
+// Parses uniform:MIN-MAX, lognormal:MEDIAN,SIGMA or a weighted list of
+// SIZE:WEIGHT pairs such as 4KiB:70,1MiB:25,64MiB:5
+func ParseSizeDistribution(spec string) (*SizeDistribution, error) {
+	d := &SizeDistribution{spec: spec}
+	invalid := fmt.Errorf("invalid size distribution %q, expected uniform:4KiB-16MiB, lognormal:64KiB,1.5 or 4KiB:70,1MiB:30", spec)
+	switch {
+	case strings.HasPrefix(spec, sizeDistUniform+":"):
+		d.kind = sizeDistUniform
+		bounds := strings.SplitN(strings.TrimPrefix(spec, sizeDistUniform+":"), "-", 2)
+		if len(bounds) != 2 {
+			return nil, invalid
+		}
+		var err error
+		if d.min, err = parseSize(bounds[0]); err != nil {
+			return nil, err
+		}
+		if d.max, err = parseSize(bounds[1]); err != nil {
+			return nil, err
+		}
+		if d.min > d.max {
+			return nil, invalid
+		}
+	case strings.HasPrefix(spec, sizeDistLognormal+":"):
+		d.kind = sizeDistLognormal
+		fields := strings.Split(strings.TrimPrefix(spec, sizeDistLognormal+":"), ",")
+		if len(fields) != 2 {
+			return nil, invalid
+		}
+		median, err := parseSize(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		d.median = float64(median)
+		if d.sigma, err = strconv.ParseFloat(fields[1], 64); err != nil || d.sigma <= 0 || median <= 0 {
+			return nil, invalid
+		}
+	default:
+		d.kind = sizeDistWeighted
+		total := 0.0
+		for _, pair := range strings.Split(spec, ",") {
+			fields := strings.SplitN(pair, ":", 2)
+			if len(fields) != 2 {
+				return nil, invalid
+			}
+			size, err := parseSize(fields[0])
+			if err != nil {
+				return nil, err
+			}
+			weight, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil || weight <= 0 {
+				return nil, invalid
+			}
+			total += weight
+			d.sizes = append(d.sizes, size)
+			d.weights = append(d.weights, total)
+		}
+		for i := range d.weights {
+			d.weights[i] /= total
+		}
+	}
+	return d, nil
+}
+
+// Parses a jitter such as 10% around mean, spread uniformly within 10% of the
+// mean, or 10%,normal for a normal distribution with a standard deviation of
+// 10% of the mean
+func ParseSizeJitter(mean int64, spec string) (*SizeDistribution, error) {
+	invalid := fmt.Errorf("invalid objectSizeJitter %q, expected e.g. 10%% or 10%%,normal", spec)
+	fields := strings.SplitN(spec, ",", 2)
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(fields[0], "%"), 64)
+	if err != nil || percent <= 0 || percent > 100 {
+		return nil, invalid
+	}
+	spread := float64(mean) * percent / 100
+	d := &SizeDistribution{spec: fmt.Sprintf("%d bytes +/- %g%%", mean, percent)}
+	if len(fields) == 1 || fields[1] == sizeDistUniform {
+		d.kind = sizeDistUniform
+		d.min, d.max = mean-int64(spread), mean+int64(spread)
+		if d.min < 1 {
+			d.min = 1
+		}
+		return d, nil
+	}
+	if fields[1] != sizeDistNormal {
+		return nil, invalid
+	}
+	d.kind = sizeDistNormal
+	d.spec += " " + sizeDistNormal
+	d.median, d.sigma = float64(mean), spread
+	return d, nil
+}
+
+// Returns the size of the i-th object
+func (d *SizeDistribution) Size(i int) int64 {
+	// Independent uniform numbers in [0, 1) for this object
+	numbers := NewRandomReader(0, 0, 0)
+	u1 := float64(numbers.word(2*int64(i))>>11) / (1 << 53)
+	u2 := float64(numbers.word(2*int64(i)+1)>>11) / (1 << 53)
+	switch d.kind {
+	case sizeDistUniform:
+		return d.min + int64(u1*float64(d.max-d.min+1))
+	case sizeDistLognormal:
+		// Box-Muller transform of the uniform numbers to a standard normal
+		normal := math.Sqrt(-2*math.Log(1-u1)) * math.Cos(2*math.Pi*u2)
+		return int64(math.Round(d.median * math.Exp(d.sigma*normal)))
+	case sizeDistNormal:
+		normal := math.Sqrt(-2*math.Log(1-u1)) * math.Cos(2*math.Pi*u2)
+		// Clamped to 3 standard deviations so that no object is huge, and
+		// to a positive size
+		return int64(math.Max(1, math.Round(d.median+d.sigma*math.Max(-3, math.Min(3, normal)))))
+	}
+	for i, weight := range d.weights {
+		if u1 < weight {
+			return d.sizes[i]
+		}
+	}
+	return d.sizes[len(d.sizes)-1]
+}
+
+// Returns the expected size of an object, ignoring the clamping of normal
+// sizes
+func (d *SizeDistribution) Mean() float64 {
+	switch d.kind {
+	case sizeDistUniform:
+		return float64(d.min+d.max) / 2
+	case sizeDistLognormal:
+		return d.median * math.Exp(d.sigma*d.sigma/2)
+	case sizeDistNormal:
+		return d.median
+	}
+	mean, previous := 0.0, 0.0
+	for i, weight := range d.weights {
+		mean += float64(d.sizes[i]) * (weight - previous)
+		previous = weight
+	}
+	return mean
+}
+
+func (d *SizeDistribution) String() string {
+	return d.spec
+}
@@ -0,0 +1,82 @@
+//go:build sqlite
+
+package main
+
+import (
+	"database/sql"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// Inserts one row per result into the results table, created when missing
+type sqliteSink struct {
+	db *sql.DB
+}
+
+func openSQLiteSink(path string) (OutputSink, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	columns := []string{"timestamp TEXT", "operation TEXT", "bucket TEXT", "object_size INTEGER", "num_clients INTEGER",
+		"operations INTEGER", "errors INTEGER", "bytes INTEGER", "duration REAL", "throughput_mbps REAL"}
+	for _, p := range summaryPercentiles {
+		columns = append(columns, "latency_"+p.name+" REAL")
+	}
+	columns = append(columns, "headers TEXT")
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS results (" + strings.Join(columns, ", ") + ")"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := addHeadersColumn(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteSink{db: db}, nil
+}
+
+// Adds the headers column to a results table created before headers were
+// exported, rows being inserted by position
+func addHeadersColumn(db *sql.DB) error {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('results') WHERE name = 'headers'").Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err := db.Exec("ALTER TABLE results ADD COLUMN headers TEXT")
+	return err
+}
+
+func (s *sqliteSink) Write(report *Report) error {
+	placeholders := strings.Repeat(", ?", 10+len(summaryPercentiles))
+	insert := "INSERT INTO results VALUES (?" + placeholders + ")"
+	for _, result := range report.results {
+		summary := result.Summary()
+		values := []interface{}{report.time.UTC().Format("2006-01-02T15:04:05Z"), summary.Operation,
+			report.params.bucketName, report.params.objectSize, report.params.numClients,
+			summary.Operations, summary.Errors, summary.Bytes, summary.DurationSeconds, summary.ThroughputMBps}
+		for _, p := range summaryPercentiles {
+			if value, ok := summary.Latency[p.name]; ok {
+				values = append(values, value)
+			} else {
+				values = append(values, nil)
+			}
+		}
+		if headers := summary.headersJSON(); headers != "" {
+			values = append(values, headers)
+		} else {
+			values = append(values, nil)
+		}
+		if _, err := s.db.Exec(insert, values...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteSink) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,11 @@
+//go:build !sqlite
+
+package main
+
+import "errors"
+
+// The SQLite driver is large, so the sink is only available in binaries built
+// with the sqlite tag
+func openSQLiteSink(path string) (OutputSink, error) {
+	return nil, errors.New("s3bench was built without SQLite support, rebuild it with -tags sqlite")
+}
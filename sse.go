@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// The only algorithm of customer-provided keys
+const sseCustomerAlgorithm = "AES256"
+
+// The server-side encryption requested by the writes, and checked by the
+// reads. With a customer-provided key (SSE-C), every request on an object
+// supplies the key instead.
+type SSE struct {
+	algorithm types.ServerSideEncryption
+	// The KMS key of aws:kms, the bucket's default key when empty
+	kmsKeyID string
+	// The base64 encoded customer-provided key and its MD5
+	customerKey    string
+	customerKeyMD5 string
+}
+
+// Parses -sse, -kmsKeyId and -sseCustomerKey, a base64 encoded 256-bit key
+func ParseSSE(algorithm, kmsKeyID, customerKey string) (*SSE, error) {
+	if customerKey != "" {
+		if algorithm != "" || kmsKeyID != "" {
+			return nil, fmt.Errorf("sseCustomerKey can not be used with sse or kmsKeyId")
+		}
+		key, err := base64.StdEncoding.DecodeString(customerKey)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("sseCustomerKey needs to be a base64 encoded 256-bit key")
+		}
+		sum := md5.Sum(key)
+		return &SSE{customerKey: customerKey, customerKeyMD5: base64.StdEncoding.EncodeToString(sum[:])}, nil
+	}
+	switch types.ServerSideEncryption(algorithm) {
+	case types.ServerSideEncryptionAes256:
+		if kmsKeyID != "" {
+			return nil, fmt.Errorf("kmsKeyId needs sse aws:kms")
+		}
+	case types.ServerSideEncryptionAwsKms:
+	default:
+		return nil, fmt.Errorf("invalid sse %q, expected AES256 or aws:kms", algorithm)
+	}
+	return &SSE{algorithm: types.ServerSideEncryption(algorithm), kmsKeyID: kmsKeyID}, nil
+}
+
+func (s *SSE) String() string {
+	if s.customerKey != "" {
+		return fmt.Sprintf("customer-provided key, MD5 %s", s.customerKeyMD5)
+	}
+	if s.kmsKeyID != "" {
+		return fmt.Sprintf("%s, key %s", s.algorithm, s.kmsKeyID)
+	}
+	return string(s.algorithm)
+}
+
+// The EncryptionStatus of the objects in S3 Inventory reports
+func (s *SSE) inventoryStatus() string {
+	switch {
+	case s.customerKey != "":
+		return "SSE-C"
+	case s.algorithm == types.ServerSideEncryptionAwsKms:
+		return "SSE-KMS"
+	}
+	return "SSE-S3"
+}
+
+func (s *SSE) applyPut(input *s3.PutObjectInput) {
+	if s.customerKey != "" {
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = s.customerHeaders()
+		return
+	}
+	input.ServerSideEncryption = s.algorithm
+	if s.kmsKeyID != "" {
+		input.SSEKMSKeyId = aws.String(s.kmsKeyID)
+	}
+}
+
+// Copies read the source with the customer-provided key and encrypt the copy
+// with it too
+func (s *SSE) applyCopy(input *s3.CopyObjectInput) {
+	if s.customerKey != "" {
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = s.customerHeaders()
+		input.CopySourceSSECustomerAlgorithm, input.CopySourceSSECustomerKey, input.CopySourceSSECustomerKeyMD5 = s.customerHeaders()
+		return
+	}
+	input.ServerSideEncryption = s.algorithm
+	if s.kmsKeyID != "" {
+		input.SSEKMSKeyId = aws.String(s.kmsKeyID)
+	}
+}
+
+// Reads only need the key of SSE-C objects, others are decrypted by the server
+func (s *SSE) applyGet(input *s3.GetObjectInput) {
+	if s.customerKey != "" {
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = s.customerHeaders()
+	}
+}
+
+func (s *SSE) applyHead(input *s3.HeadObjectInput) {
+	if s.customerKey != "" {
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = s.customerHeaders()
+	}
+}
+
+func (s *SSE) customerHeaders() (*string, *string, *string) {
+	return aws.String(sseCustomerAlgorithm), aws.String(s.customerKey), aws.String(s.customerKeyMD5)
+}
+
+// Checks that a read returned the encryption headers of the objects written.
+// Servers return the ARN of the KMS key, which only names the key given by ID
+// or ARN, not by alias.
+func (s *SSE) check(output *s3.GetObjectOutput) error {
+	if s.customerKey != "" {
+		if aws.ToString(output.SSECustomerAlgorithm) != sseCustomerAlgorithm || aws.ToString(output.SSECustomerKeyMD5) != s.customerKeyMD5 {
+			return fmt.Errorf("expected a customer-provided key with MD5 %s, got %q with MD5 %q", s.customerKeyMD5,
+				aws.ToString(output.SSECustomerAlgorithm), aws.ToString(output.SSECustomerKeyMD5))
+		}
+		return nil
+	}
+	if output.ServerSideEncryption != s.algorithm {
+		return fmt.Errorf("expected server-side encryption %s, got %q", s.algorithm, output.ServerSideEncryption)
+	}
+	keyID := aws.ToString(output.SSEKMSKeyId)
+	if s.kmsKeyID != "" && !strings.HasPrefix(s.kmsKeyID, "alias/") &&
+		keyID != s.kmsKeyID && !strings.HasSuffix(keyID, ":key/"+s.kmsKeyID) {
+		return fmt.Errorf("expected KMS key %s, got %q", s.kmsKeyID, keyID)
+	}
+	return nil
+}
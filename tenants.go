@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// A set of credentials sharing the load, optionally capped to a number of
+// concurrent clients and a rate of operations per second
+type Tenant struct {
+	name         string
+	accessKey    string
+	accessSecret string
+	rate         float64
+	concurrency  int
+	limiter      *RateLimiter
+	// Client certificate presented by the tenant for mutual TLS, and the
+	// connection pools of its clients presenting it
+	certificate *tls.Certificate
+	pools       map[string]aws.HTTPClient
+}
+
+// Reads a tenants file, one tenant per line:
+//
+//	name accessKey accessSecret [rate=<ops/s>] [concurrency=<clients>] [cert=<file> key=<file>]
+//
+// Empty lines and lines starting with # are ignored.
+func LoadTenants(path string) ([]*Tenant, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var tenants []*Tenant
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%s:%d: expected name, access key and secret", path, lineNum)
+		}
+		tenant := &Tenant{name: fields[0], accessKey: fields[1], accessSecret: fields[2]}
+		var certFile, keyFile string
+		for _, option := range fields[3:] {
+			parts := strings.SplitN(option, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("%s:%d: invalid option %q", path, lineNum, option)
+			}
+			switch parts[0] {
+			case "rate":
+				tenant.rate, err = strconv.ParseFloat(parts[1], 64)
+				if err == nil && tenant.rate <= 0 {
+					err = fmt.Errorf("needs to be greater than 0")
+				}
+				if err == nil {
+					tenant.limiter = NewRateLimiter(tenant.rate)
+				}
+			case "concurrency":
+				tenant.concurrency, err = strconv.Atoi(parts[1])
+				if err == nil && tenant.concurrency <= 0 {
+					err = fmt.Errorf("needs to be greater than 0")
+				}
+			case "cert":
+				certFile = parts[1]
+			case "key":
+				keyFile = parts[1]
+			default:
+				err = fmt.Errorf("unknown option")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid option %q: %v", path, lineNum, option, err)
+			}
+		}
+		if (certFile == "") != (keyFile == "") {
+			return nil, fmt.Errorf("%s:%d: cert and key need to be given together", path, lineNum)
+		}
+		if certFile != "" {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: could not load the client certificate: %v", path, lineNum, err)
+			}
+			tenant.certificate = &cert
+		}
+		tenants = append(tenants, tenant)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(tenants) == 0 {
+		return nil, fmt.Errorf("%s: no tenants defined", path)
+	}
+	return tenants, nil
+}
+
+// Decides which tenant each client runs as. Tenants with a concurrency cap
+// get exactly that many clients and the remaining clients are spread over
+// the uncapped tenants. When every tenant is capped the number of clients is
+// the sum of the caps.
+func assignTenants(tenants []*Tenant, numClients int) ([]*Tenant, error) {
+	var assignment, uncapped []*Tenant
+	for _, tenant := range tenants {
+		if tenant.concurrency == 0 {
+			uncapped = append(uncapped, tenant)
+			continue
+		}
+		for i := 0; i < tenant.concurrency; i++ {
+			assignment = append(assignment, tenant)
+		}
+	}
+	if len(uncapped) == 0 {
+		return assignment, nil
+	}
+	if len(assignment)+len(uncapped) > numClients {
+		return nil, fmt.Errorf("numClients(%d) is too small for the %d capped clients and %d uncapped tenants",
+			numClients, len(assignment), len(uncapped))
+	}
+	for i := 0; len(assignment) < numClients; i++ {
+		assignment = append(assignment, uncapped[i%len(uncapped)])
+	}
+	return assignment, nil
+}
+
+// Gives every tenant with a client certificate connection pools of its own
+// presenting it, one per pool of the run
+func (params *Params) newTenantPools(transports transportOptions) error {
+	for _, tenant := range params.tenants {
+		if tenant.certificate == nil || tenant.pools != nil {
+			continue
+		}
+		if !transports.http3 && !usesTLS(transports.endpoints) {
+			return fmt.Errorf("the client certificate of tenant %s needs https endpoints", tenant.name)
+		}
+		options := transports
+		options.tlsConfig = transports.tlsConfig.Clone()
+		options.tlsConfig.Certificates = []tls.Certificate{*tenant.certificate}
+		tenant.pools = make(map[string]aws.HTTPClient)
+		pools := []string{poolOther}
+		if params.pools != nil {
+			pools = append(pools, poolWrite, poolRead)
+		}
+		for _, pool := range pools {
+			client, err := options.newHTTPClient(params.sourcePorts[pool])
+			if err != nil {
+				return err
+			}
+			tenant.pools[pool] = client
+		}
+	}
+	return nil
+}
+
+func (t *Tenant) String() string {
+	limits := ""
+	if t.concurrency > 0 {
+		limits += fmt.Sprintf(" concurrency=%d", t.concurrency)
+	}
+	if t.rate > 0 {
+		limits += fmt.Sprintf(" rate=%g/s", t.rate)
+	}
+	if t.certificate != nil {
+		limits += " cert"
+	}
+	return t.name + limits
+}
+
+// Results of the operations performed by a single tenant
+type TenantStats struct {
+	numOps           int
+	numErrors        int
+	bytesTransmitted int64
+	opDurations      Histogram
+}
+
+func (r *Result) addToTenant(resp Resp) {
+	if r.tenants == nil {
+		r.tenants = make(map[string]*TenantStats)
+	}
+	stats, ok := r.tenants[resp.tenant]
+	if !ok {
+		stats = &TenantStats{}
+		r.tenants[resp.tenant] = stats
+	}
+	stats.numOps++
+	if resp.err != nil {
+		stats.numErrors++
+		return
+	}
+	stats.bytesTransmitted += resp.numBytes
+	stats.opDurations.Record(resp.duration.Seconds())
+}
+
+func (r Result) tenantReport() string {
+	names := make([]string, 0, len(r.tenants))
+	for name := range r.tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := fmt.Sprintf("%s results by tenant:\n", r.operation)
+	report += fmt.Sprintf("%-16s %8s %8s %10s %8s %9s %9s\n", "tenant", "ops", "errors", "MB/s", "ops/s", "50th s", "99th s")
+	for _, name := range names {
+		t := r.tenants[name]
+		seconds := r.totalDuration.Seconds()
+		p50, p99 := 0.0, 0.0
+		if t.opDurations.Count() > 0 {
+			p50, p99 = t.opDurations.Percentile(50), t.opDurations.Percentile(99)
+		}
+		report += fmt.Sprintf("%-16s %8d %8d %10.2f %8.1f %9.3f %9.3f\n",
+			name, t.numOps, t.numErrors, (float64(t.bytesTransmitted)/(1024*1024))/seconds,
+			float64(t.numOps)/seconds, p50, p99)
+	}
+	return report
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Writes a self-signed client certificate and its key to dir
+func writeTestCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "tenant"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestLoadTenants(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, dir)
+	certOptions := "cert=" + certFile + " key=" + keyFile
+
+	tests := []struct {
+		name    string
+		content string
+		// Name, rate, concurrency and whether a certificate is presented,
+		// of every tenant
+		tenants []string
+		// Part of the expected error
+		err string
+	}{
+		{"plain", "a KEY1 SECRET1\nb KEY2 SECRET2\n", []string{"a 0 0 false", "b 0 0 false"}, ""},
+		{"caps", "steady KEY1 SECRET1 rate=100 concurrency=4\nnoisy KEY2 SECRET2 rate=2.5\n", []string{"steady 100 4 false", "noisy 2.5 0 false"}, ""},
+		{"comments", "# name key secret\n\n  a KEY1 SECRET1  \n", []string{"a 0 0 false"}, ""},
+		{"certificate", "a KEY1 SECRET1 " + certOptions + "\n", []string{"a 0 0 true"}, ""},
+		{"empty", "# nothing\n", nil, "no tenants defined"},
+		{"missing secret", "a KEY1 SECRET1\nb KEY2\n", nil, ":2: expected name, access key and secret"},
+		{"no value", "a KEY1 SECRET1 rate\n", nil, `:1: invalid option "rate"`},
+		{"unknown option", "a KEY1 SECRET1 burst=3\n", nil, ":1: invalid option \"burst=3\": unknown option"},
+		{"invalid rate", "a KEY1 SECRET1 rate=fast\n", nil, ":1: invalid option \"rate=fast\""},
+		{"zero rate", "a KEY1 SECRET1\n\nb KEY2 SECRET2 rate=0\n", nil, ":3: invalid option \"rate=0\": needs to be greater than 0"},
+		{"negative rate", "a KEY1 SECRET1 rate=-5\n", nil, ":1: invalid option \"rate=-5\": needs to be greater than 0"},
+		{"zero concurrency", "a KEY1 SECRET1 concurrency=0\n", nil, ":1: invalid option \"concurrency=0\": needs to be greater than 0"},
+		{"negative concurrency", "a KEY1 SECRET1 concurrency=-1\n", nil, ":1: invalid option \"concurrency=-1\": needs to be greater than 0"},
+		{"cert without key", "a KEY1 SECRET1 cert=" + certFile + "\n", nil, ":1: cert and key need to be given together"},
+		{"missing cert", "a KEY1 SECRET1 cert=" + filepath.Join(dir, "none.pem") + " key=" + keyFile + "\n", nil, ":1: could not load the client certificate"},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, "tenants.txt")
+		if err := os.WriteFile(path, []byte(test.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		tenants, err := LoadTenants(path)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: error %v, expected one containing %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		var got []string
+		for _, tenant := range tenants {
+			got = append(got, fmt.Sprintf("%s %g %d %t", tenant.name, tenant.rate, tenant.concurrency, tenant.certificate != nil))
+			if (tenant.rate > 0) != (tenant.limiter != nil) {
+				t.Errorf("%s: tenant %s with rate %g has limiter %v", test.name, tenant.name, tenant.rate, tenant.limiter)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(test.tenants, ",") {
+			t.Errorf("%s: tenants %q, expected %q", test.name, got, test.tenants)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"runtime"
+	"time"
+)
+
+// Throughput and operation times of the operations completed during one
+// interval of a test, as exported by the machine readable sinks
+type TimelineBucket struct {
+	StartSeconds   float64            `json:"startSeconds"`
+	Operations     int                `json:"operations"`
+	Errors         int                `json:"errors"`
+	Bytes          int64              `json:"bytes"`
+	ThroughputMBps float64            `json:"throughputMBps"`
+	OpsPerSecond   float64            `json:"opsPerSecond"`
+	Latency        map[string]float64 `json:"latencySeconds,omitempty"`
+	// The state of the benchmark's own Go runtime, to tell client-side GC
+	// pauses from server issues
+	Runtime *RuntimeSample `json:"runtime,omitempty"`
+}
+
+// The Go runtime at the end of a bucket, and its garbage collections during
+// the bucket
+type RuntimeSample struct {
+	HeapBytes         uint64  `json:"heapBytes"`
+	Goroutines        int     `json:"goroutines"`
+	GCs               uint32  `json:"gcs"`
+	GCPauseSeconds    float64 `json:"gcPauseSeconds"`
+	MaxGCPauseSeconds float64 `json:"maxGCPauseSeconds"`
+}
+
+// The operation time percentiles exported per bucket
+var bucketPercentiles = []struct {
+	name       string
+	percentile float64
+}{{"p50", 50}, {"p90", 90}, {"p99", 99}, {"max", 100}}
+
+// Splits a test into buckets of a fixed interval, so that ramp-up, steady
+// state and mid-run throttling show instead of a single total. Operations
+// complete in order of elapsed time, so only the bucket being filled keeps
+// its operation times and memory does not grow with the length of the test.
+type TimeSeries struct {
+	interval    time.Duration
+	buckets     []TimelineBucket
+	opDurations Histogram
+	// Garbage collections up to the previous bucket
+	numGC        uint32
+	pauseTotalNs uint64
+}
+
+func NewTimeSeries(interval time.Duration) *TimeSeries {
+	ts := &TimeSeries{interval: interval}
+	ts.sampleRuntime()
+	return ts
+}
+
+// Returns the state of the runtime and its garbage collections since the
+// previous sample. Buckets are closed as the first operation of the next one
+// completes, so the sample is taken slightly after the end of the bucket.
+func (ts *TimeSeries) sampleRuntime() *RuntimeSample {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	sample := &RuntimeSample{
+		HeapBytes:      stats.HeapAlloc,
+		Goroutines:     runtime.NumGoroutine(),
+		GCs:            stats.NumGC - ts.numGC,
+		GCPauseSeconds: time.Duration(stats.PauseTotalNs - ts.pauseTotalNs).Seconds(),
+	}
+	// The pauses of the most recent collections are kept in a circular buffer
+	for gc := stats.NumGC; gc > ts.numGC && stats.NumGC-gc < uint32(len(stats.PauseNs)); gc-- {
+		pause := time.Duration(stats.PauseNs[(gc+uint32(len(stats.PauseNs))-1)%uint32(len(stats.PauseNs))]).Seconds()
+		if pause > sample.MaxGCPauseSeconds {
+			sample.MaxGCPauseSeconds = pause
+		}
+	}
+	ts.numGC, ts.pauseTotalNs = stats.NumGC, stats.PauseTotalNs
+	return sample
+}
+
+func (ts *TimeSeries) add(resp Resp, elapsed time.Duration) {
+	index := int(elapsed / ts.interval)
+	if len(ts.buckets) == 0 {
+		ts.buckets = append(ts.buckets, TimelineBucket{})
+	}
+	for len(ts.buckets) <= index {
+		ts.close(ts.interval)
+		ts.buckets = append(ts.buckets, TimelineBucket{StartSeconds: (time.Duration(len(ts.buckets)) * ts.interval).Seconds()})
+	}
+	bucket := &ts.buckets[len(ts.buckets)-1]
+	bucket.Operations++
+	if resp.err != nil {
+		bucket.Errors++
+		return
+	}
+	bucket.Bytes += resp.numBytes
+	ts.opDurations.Record(resp.duration.Seconds())
+}
+
+// Computes the rates and percentiles of the last bucket, which lasted length
+func (ts *TimeSeries) close(length time.Duration) {
+	bucket := &ts.buckets[len(ts.buckets)-1]
+	if seconds := length.Seconds(); seconds > 0 {
+		bucket.ThroughputMBps = (float64(bucket.Bytes) / (1024 * 1024)) / seconds
+		bucket.OpsPerSecond = float64(bucket.Operations) / seconds
+	}
+	if ts.opDurations.Count() > 0 {
+		bucket.Latency = make(map[string]float64)
+		for _, p := range bucketPercentiles {
+			bucket.Latency[p.name] = ts.opDurations.Percentile(p.percentile)
+		}
+	}
+	ts.opDurations = Histogram{}
+	bucket.Runtime = ts.sampleRuntime()
+}
+
+// Closes the last bucket, cut short by the end of a test lasting total
+func (ts *TimeSeries) finish(total time.Duration) {
+	if len(ts.buckets) == 0 {
+		return
+	}
+	last := len(ts.buckets) - 1
+	ts.close(total - time.Duration(last)*ts.interval)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Grand totals over every test of a run
+type RunTotals struct {
+	Operations       int           `json:"operations"`
+	Errors           int           `json:"errors"`
+	BytesWritten     int64         `json:"bytesWritten"`
+	BytesRead        int64         `json:"bytesRead"`
+	WallClockSeconds float64       `json:"wallClockSeconds"`
+	ErrorRate        float64       `json:"errorRate"`
+	Cost             *CostEstimate `json:"cost,omitempty"`
+	Availability     *Availability `json:"availability,omitempty"`
+}
+
+func computeTotals(results []Result, wallClock time.Duration, costs CostModel) RunTotals {
+	totals := RunTotals{WallClockSeconds: wallClock.Seconds()}
+	for _, r := range results {
+		totals.Operations += r.opDurations.Count() + r.numErrors
+		totals.Errors += r.numErrors
+		switch r.operation {
+		case opWrite, opCommit, opVersionWrite:
+			totals.BytesWritten += r.bytesTransmitted
+		case opRead, opVersionRead:
+			totals.BytesRead += r.bytesTransmitted
+		}
+	}
+	if totals.Operations > 0 {
+		totals.ErrorRate = float64(totals.Errors) / float64(totals.Operations)
+	}
+	if costs.isSet() {
+		totals.Cost = costs.estimate(results, wallClock)
+	}
+	return totals
+}
+
+func (t RunTotals) String() string {
+	report := fmt.Sprintln("Totals")
+	report += fmt.Sprintf("Operations:        %d\n", t.Operations)
+	report += fmt.Sprintf("Written:           %0.3f MB\n", float64(t.BytesWritten)/(1024*1024))
+	report += fmt.Sprintf("Read:              %0.3f MB\n", float64(t.BytesRead)/(1024*1024))
+	report += fmt.Sprintf("Wall Clock:        %0.3f s\n", t.WallClockSeconds)
+	report += fmt.Sprintf("Error Rate:        %0.2f%% (%d errors)\n", 100*t.ErrorRate, t.Errors)
+	if t.Availability != nil {
+		report += t.Availability.String()
+	}
+	if t.Cost != nil {
+		report += "\n" + t.Cost.String()
+	}
+	return report
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of spans sent to the collector in a single export request
+	spanBatchSize = 512
+	// Longest time a finished span waits before being exported
+	spanFlushInterval = 5 * time.Second
+	// OTLP span kind and status codes, see opentelemetry-proto trace.proto
+	spanKindClient  = 3
+	spanStatusOk    = 1
+	spanStatusError = 2
+)
+
+// A finished operation to be exported as a span
+type Span struct {
+	traceID   string
+	spanID    string
+	operation string
+	bucket    string
+	key       string
+	size      int64
+	endpoint  string
+	startTime time.Time
+	endTime   time.Time
+	err       error
+}
+
+// Exports one span per operation to an OpenTelemetry collector using OTLP
+// over HTTP with JSON encoding. Spans are exported in the background so that
+// a slow collector does not slow down the benchmark, spans which do not fit
+// in the queue are dropped and counted instead.
+type SpanExporter struct {
+	url        string
+	httpClient *http.Client
+	spans      chan Span
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+	numDropped int
+	numFailed  int
+}
+
+func NewSpanExporter(endpoint string) *SpanExporter {
+	e := &SpanExporter{
+		url:        strings.TrimRight(endpoint, "/") + "/v1/traces",
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		spans:      make(chan Span, 8*spanBatchSize),
+	}
+	e.wg.Add(1)
+	go e.exportLoop()
+	return e
+}
+
+// Generates random W3C trace context identifiers for a new span
+func newSpanContext() (traceID string, spanID string) {
+	ids := make([]byte, 24)
+	rand.Read(ids)
+	return hex.EncodeToString(ids[:16]), hex.EncodeToString(ids[16:])
+}
+
+// Returns the traceparent header propagating the span to the server, so that
+// its own traces can be correlated
+func traceparent(traceID, spanID string) string {
+	return fmt.Sprintf("00-%s-%s-01", traceID, spanID)
+}
+
+// Queue a finished span for export without ever blocking the caller
+func (e *SpanExporter) Record(span Span) {
+	select {
+	case e.spans <- span:
+	default:
+		e.mu.Lock()
+		e.numDropped++
+		e.mu.Unlock()
+	}
+}
+
+// Flush all queued spans and stop exporting
+func (e *SpanExporter) Shutdown() {
+	close(e.spans)
+	e.wg.Wait()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.numDropped > 0 || e.numFailed > 0 {
+		fmt.Printf("Span export: %d dropped, %d failed to send to %s\n", e.numDropped, e.numFailed, e.url)
+	}
+}
+
+func (e *SpanExporter) exportLoop() {
+	defer e.wg.Done()
+	ticker := time.NewTicker(spanFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Span, 0, spanBatchSize)
+	for {
+		select {
+		case span, ok := <-e.spans:
+			if !ok {
+				e.export(batch)
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) < spanBatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		e.export(batch)
+		batch = batch[:0]
+	}
+}
+
+func (e *SpanExporter) export(batch []Span) {
+	if len(batch) == 0 {
+		return
+	}
+	body, err := json.Marshal(otlpRequest(batch))
+	if err == nil {
+		var resp *http.Response
+		resp, err = e.httpClient.Post(e.url, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				err = fmt.Errorf("unexpected status %s", resp.Status)
+			}
+		}
+	}
+	if err != nil {
+		e.mu.Lock()
+		e.numFailed += len(batch)
+		e.mu.Unlock()
+	}
+}
+
+// The JSON encoding of an OTLP ExportTraceServiceRequest
+type otlpAttribute struct {
+	Key   string            `json:"key"`
+	Value map[string]string `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]string{"stringValue": value}}
+}
+
+func intAttribute(key string, value int64) otlpAttribute {
+	// 64 bit integers are encoded as strings in the OTLP JSON mapping
+	return otlpAttribute{Key: key, Value: map[string]string{"intValue": strconv.FormatInt(value, 10)}}
+}
+
+func otlpRequest(batch []Span) interface{} {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		status := "ok"
+		span := otlpSpan{
+			TraceID:           s.traceID,
+			SpanID:            s.spanID,
+			Name:              s.operation,
+			Kind:              spanKindClient,
+			StartTimeUnixNano: strconv.FormatInt(s.startTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.endTime.UnixNano(), 10),
+		}
+		span.Status.Code = spanStatusOk
+		if s.err != nil {
+			status = "error"
+			span.Status.Code = spanStatusError
+			span.Status.Message = s.err.Error()
+		}
+		span.Attributes = []otlpAttribute{
+			stringAttribute("s3bench.op", s.operation),
+			stringAttribute("aws.s3.bucket", s.bucket),
+			stringAttribute("aws.s3.key", s.key),
+			intAttribute("s3bench.size", s.size),
+			stringAttribute("s3bench.endpoint", s.endpoint),
+			stringAttribute("s3bench.status", status),
+		}
+		spans = append(spans, span)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otlpAttribute{stringAttribute("service.name", "s3bench")},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": "s3bench"},
+						"spans": spans,
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+// Connection handshake statistics per server address, collected by the
+// custom transports
+type TransportStats struct {
+	mu     sync.Mutex
+	byAddr map[string]*handshakeStats
+	// The transfer counters of every QUIC connection per server address, read
+	// when reporting as connections stay open until the end of the run
+	transfers map[string][]func() transferStats
+}
+
+type handshakeStats struct {
+	numHandshakes int
+	numResumed    int
+	numFailed     int
+	totalTime     time.Duration
+	maxTime       time.Duration
+}
+
+// What went over a connection, only known for QUIC connections whose packets
+// are handled by s3bench itself
+type transferStats struct {
+	bytesSent     uint64
+	bytesReceived uint64
+	packetsSent   uint64
+	packetsLost   uint64
+	smoothedRTT   time.Duration
+}
+
+func NewTransportStats() *TransportStats {
+	return &TransportStats{byAddr: make(map[string]*handshakeStats), transfers: make(map[string][]func() transferStats)}
+}
+
+// Returns the TLS configuration of the connections to the endpoints, trusting
+// the certificates of caCert on top of the system's, presenting the client
+// certificate of clientCert and clientKey when given for mutual TLS, and not
+// verifying the certificate of the server at all with insecure
+func loadTLSConfig(caCert, clientCert, clientKey string, insecure bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecure}
+	if caCert != "" {
+		pem, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificate found in caCert %s", caCert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if (clientCert == "") != (clientKey == "") {
+		return nil, fmt.Errorf("clientCert and clientKey need to be given together")
+	}
+	if clientCert != "" {
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Returns the proxy of requests: proxyURL, an HTTP proxy, or else socksProxy,
+// a SOCKS5 proxy, or else the proxy given by the HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY environment variables
+func proxyFunc(proxyURL, socksProxy string) (func(*http.Request) (*url.URL, error), error) {
+	if proxyURL != "" && socksProxy != "" {
+		return nil, fmt.Errorf("proxy and socksProxy can not be used together")
+	}
+	spec, scheme := proxyURL, "http"
+	if socksProxy != "" {
+		spec, scheme = socksProxy, "socks5"
+	}
+	if spec == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	if !strings.Contains(spec, "://") {
+		spec = scheme + "://" + spec
+	}
+	u, err := url.Parse(spec)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q, expected host:port", spec)
+	}
+	return http.ProxyURL(u), nil
+}
+
+// Whether requests to any of the endpoints go through a proxy
+func usesProxy(proxy func(*http.Request) (*url.URL, error), endpoints []string) bool {
+	for _, endpoint := range endpoints {
+		req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+		if err != nil {
+			continue
+		}
+		if u, err := proxy(req); err == nil && u != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// How the HTTP clients of the run reach the endpoints
+type transportOptions struct {
+	http3                bool
+	tlsConfig            *tls.Config
+	disableTLSResumption bool
+	// Whether a proxy was given, proxy honouring the environment otherwise
+	proxied   bool
+	proxy     func(*http.Request) (*url.URL, error)
+	endpoints []string
+	stats     *TransportStats
+	// The client of the loaded config, which honours AWS_CA_BUNDLE
+	sdkClient aws.HTTPClient
+}
+
+// Returns an HTTP client with a connection pool of its own, connecting from
+// the given ports when not nil
+func (o transportOptions) newHTTPClient(ports *PortRange) (aws.HTTPClient, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	dial := dialer.DialContext
+	if ports != nil {
+		dial = ports.dialContext
+	}
+	switch {
+	case o.http3:
+		transport, err := newHTTP3Transport(o.stats, o.tlsConfig, o.disableTLSResumption)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Client{Transport: transport}, nil
+	case usesTLS(o.endpoints):
+		return &http.Client{Transport: newTLSTransport(o.stats, o.tlsConfig, o.disableTLSResumption, o.proxy, o.endpoints, dial)}, nil
+	case o.proxied:
+		// The default client of the SDK only honors the proxy environment
+		// variables
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = o.proxy
+		transport.DialContext = dial
+		return &http.Client{Transport: transport}, nil
+	}
+	client, ok := o.sdkClient.(*awshttp.BuildableClient)
+	if !ok {
+		client = awshttp.NewBuildableClient()
+	}
+	// Copies of the client have transports of their own
+	return client.WithTransportOptions(func(transport *http.Transport) {
+		if ports != nil {
+			transport.DialContext = dial
+		}
+	}), nil
+}
+
+// Returns a transport equivalent to the default one, sending requests through
+// proxy, which records every TLS handshake in stats. Session resumption lets
+// new connections skip the full handshake, which can hide the front end's
+// handshake cost during short runs, so it can be disabled. Handshakes with
+// endpoints reached through a proxy are made by the standard transport and
+// not recorded.
+func newTLSTransport(stats *TransportStats, tlsConfig *tls.Config, disableResumption bool,
+	proxy func(*http.Request) (*url.URL, error), endpoints []string,
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)) *http.Transport {
+	tlsConfig = tlsConfig.Clone()
+	if disableResumption {
+		tlsConfig.SessionTicketsDisabled = true
+	} else {
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	transport.DialContext = dial
+	if usesProxy(proxy, endpoints) {
+		// A custom TLS dialer would connect to the proxy itself rather
+		// than tunnel through it
+		transport.TLSClientConfig = tlsConfig
+		return transport
+	}
+	transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		config := tlsConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		tlsConn := tls.Client(conn, config)
+		start := time.Now()
+		err = tlsConn.HandshakeContext(ctx)
+		stats.addHandshake(addr, time.Since(start), err == nil && tlsConn.ConnectionState().DidResume, err)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+	return transport
+}
+
+// Whether any of the endpoints is reached over TLS
+func usesTLS(endpoints []string) bool {
+	for _, endpoint := range endpoints {
+		if strings.HasPrefix(strings.ToLower(endpoint), "https://") {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *TransportStats) empty() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.byAddr) == 0 && len(t.transfers) == 0
+}
+
+// Records a connection whose transfer counters stats returns
+func (t *TransportStats) addConnection(addr string, stats func() transferStats) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.transfers[addr] = append(t.transfers[addr], stats)
+}
+
+// Record a completed handshake, resumed tells whether a previous session
+// was reused instead of a full handshake being performed
+func (t *TransportStats) addHandshake(addr string, duration time.Duration, resumed bool, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats, ok := t.byAddr[addr]
+	if !ok {
+		stats = &handshakeStats{}
+		t.byAddr[addr] = stats
+	}
+	if err != nil {
+		stats.numFailed++
+		return
+	}
+	stats.numHandshakes++
+	if resumed {
+		stats.numResumed++
+	}
+	stats.totalTime += duration
+	if duration > stats.maxTime {
+		stats.maxTime = duration
+	}
+}
+
+func (t *TransportStats) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	addrs := make([]string, 0, len(t.byAddr))
+	for addr := range t.byAddr {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	report := fmt.Sprintln("Connection handshakes")
+	for _, addr := range addrs {
+		s := t.byAddr[addr]
+		var avg time.Duration
+		var resumedRate float64
+		if s.numHandshakes > 0 {
+			avg = s.totalTime / time.Duration(s.numHandshakes)
+			resumedRate = 100 * float64(s.numResumed) / float64(s.numHandshakes)
+		}
+		report += fmt.Sprintf("%s: %d handshakes (%d resumed, %0.1f%%, %d failed), avg %0.3f ms, max %0.3f ms\n",
+			addr, s.numHandshakes, s.numResumed, resumedRate, s.numFailed,
+			avg.Seconds()*1000, s.maxTime.Seconds()*1000)
+	}
+	if len(t.transfers) > 0 {
+		report += t.transferReport()
+	}
+	return report
+}
+
+// Totals the counters of the QUIC connections to every address, with the
+// share of the packets sent which were lost and the average smoothed RTT
+func (t *TransportStats) transferReport() string {
+	addrs := make([]string, 0, len(t.transfers))
+	for addr := range t.transfers {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	report := fmt.Sprintln("QUIC transfers")
+	for _, addr := range addrs {
+		var total transferStats
+		var rtt time.Duration
+		for _, stats := range t.transfers[addr] {
+			s := stats()
+			total.bytesSent += s.bytesSent
+			total.bytesReceived += s.bytesReceived
+			total.packetsSent += s.packetsSent
+			total.packetsLost += s.packetsLost
+			rtt += s.smoothedRTT
+		}
+		numConns := len(t.transfers[addr])
+		var lossRate float64
+		if total.packetsSent > 0 {
+			lossRate = 100 * float64(total.packetsLost) / float64(total.packetsSent)
+		}
+		report += fmt.Sprintf("%s: %d connections, %0.3f MB sent, %0.3f MB received, %d of %d packets lost (%0.2f%%), avg smoothed RTT %0.3f ms\n",
+			addr, numConns, float64(total.bytesSent)/(1024*1024), float64(total.bytesReceived)/(1024*1024),
+			total.packetsLost, total.packetsSent, lossRate, (rtt/time.Duration(numConns)).Seconds()*1000)
+	}
+	return report
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Most runs shown in a sparkline, the latest ones
+const trendMaxRuns = 60
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// A run as archived by the json output
+type trendRun struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Results   []ResultSummary `json:"results"`
+}
+
+// The metrics followed for each operation
+var trendMetrics = []struct {
+	name  string
+	value func(ResultSummary) (float64, bool)
+}{
+	{"throughput MB/s", func(s ResultSummary) (float64, bool) { return s.ThroughputMBps, true }},
+	{"ops/s", func(s ResultSummary) (float64, bool) {
+		return float64(s.Operations) / s.DurationSeconds, s.DurationSeconds > 0
+	}},
+	{"p50 latency s", func(s ResultSummary) (float64, bool) { v, ok := s.Latency["p50"]; return v, ok }},
+	{"p99 latency s", func(s ResultSummary) (float64, bool) { v, ok := s.Latency["p99"]; return v, ok }},
+	{"error rate %", func(s ResultSummary) (float64, bool) {
+		return 100 * float64(s.Errors) / float64(s.Operations), s.Operations > 0
+	}},
+}
+
+// Runs "s3bench trend DIR", printing how the metrics of the JSON reports
+// archived under DIR evolved from run to run. Returns the exit status.
+func runTrend(args []string) int {
+	if len(args) != 1 {
+		fmt.Println("usage: s3bench trend DIR, where DIR holds reports of -output json:FILE")
+		return 1
+	}
+	runs, err := loadTrendRuns(args[0])
+	if err != nil {
+		fmt.Printf("Could not read the reports: %v\n", err)
+		return 1
+	}
+	if len(runs) == 0 {
+		fmt.Printf("No JSON reports found under %s\n", args[0])
+		return 1
+	}
+	fmt.Print(trendReport(runs))
+	return 0
+}
+
+// Returns the reports found under dir, oldest first. Files which are not
+// reports are skipped.
+func loadTrendRuns(dir string) ([]trendRun, error) {
+	var runs []trendRun
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".json") {
+			return err
+		}
+		body, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var run trendRun
+		if json.Unmarshal(body, &run) != nil || run.Timestamp.IsZero() || len(run.Results) == 0 {
+			return nil
+		}
+		runs = append(runs, run)
+		return nil
+	})
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].Timestamp.Before(runs[j].Timestamp) })
+	return runs, err
+}
+
+func trendReport(runs []trendRun) string {
+	total := len(runs)
+	if len(runs) > trendMaxRuns {
+		runs = runs[len(runs)-trendMaxRuns:]
+	}
+	report := fmt.Sprintf("Trends of %d runs from %s to %s", len(runs),
+		runs[0].Timestamp.Format(time.RFC3339), runs[len(runs)-1].Timestamp.Format(time.RFC3339))
+	if total > len(runs) {
+		report += fmt.Sprintf(", the latest of %d", total)
+	}
+	report += "\n"
+
+	// Operations in the order they first appear
+	var operations []string
+	seen := make(map[string]bool)
+	for _, run := range runs {
+		for _, result := range run.Results {
+			if !seen[result.Operation] {
+				seen[result.Operation] = true
+				operations = append(operations, result.Operation)
+			}
+		}
+	}
+	for _, op := range operations {
+		report += fmt.Sprintf("\n%s\n", op)
+		for _, metric := range trendMetrics {
+			values := make([]float64, len(runs))
+			present := make([]bool, len(runs))
+			for i, run := range runs {
+				for _, result := range run.Results {
+					if result.Operation == op {
+						values[i], present[i] = metric.value(result)
+						break
+					}
+				}
+			}
+			report += trendLine(metric.name, values, present)
+		}
+	}
+	return report
+}
+
+// Formats a sparkline of the values along with their min, max and latest,
+// runs without a value being blanks
+func trendLine(name string, values []float64, present []bool) string {
+	min, max := math.Inf(1), math.Inf(-1)
+	latest, found := 0.0, false
+	for i, value := range values {
+		if present[i] {
+			min, max = math.Min(min, value), math.Max(max, value)
+			latest, found = value, true
+		}
+	}
+	if !found {
+		return ""
+	}
+	spark := make([]rune, len(values))
+	for i, value := range values {
+		switch {
+		case !present[i]:
+			spark[i] = ' '
+		case max == min:
+			spark[i] = sparkBlocks[0]
+		default:
+			spark[i] = sparkBlocks[int(math.Round((value-min)/(max-min)*float64(len(sparkBlocks)-1)))]
+		}
+	}
+	return fmt.Sprintf("  %-16s %s  min %s  max %s  latest %s\n", name, string(spark),
+		trendValue(min), trendValue(max), trendValue(latest))
+}
+
+// Formats a value with 4 significant digits, whatever its magnitude
+func trendValue(value float64) string {
+	return fmt.Sprintf("%.4g", value)
+}
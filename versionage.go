@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Upper bounds of the object age ranges reads are grouped by, older versions
+// may have been moved to colder storage tiers
+var versionAgeBuckets = []struct {
+	maxAge time.Duration
+	label  string
+}{
+	{time.Hour, "< 1 hour"},
+	{24 * time.Hour, "< 1 day"},
+	{7 * 24 * time.Hour, "< 1 week"},
+	{30 * 24 * time.Hour, "< 30 days"},
+	{90 * 24 * time.Hour, "< 90 days"},
+	{1<<63 - 1, ">= 90 days"},
+}
+
+func (r *Result) addToVersionAge(resp Resp) {
+	output, ok := resp.output.(*s3.GetObjectOutput)
+	if resp.err != nil || !ok || output.LastModified == nil {
+		return
+	}
+	age := resp.startTime.Sub(*output.LastModified)
+	bucket := 0
+	for age >= versionAgeBuckets[bucket].maxAge {
+		bucket++
+	}
+	if r.versionAges == nil {
+		r.versionAges = make(map[int]*Histogram)
+	}
+	if r.versionAges[bucket] == nil {
+		r.versionAges[bucket] = &Histogram{}
+	}
+	r.versionAges[bucket].Record(resp.duration.Seconds())
+}
+
+func (r Result) versionAgeReport() string {
+	buckets := make([]int, 0, len(r.versionAges))
+	for bucket := range r.versionAges {
+		buckets = append(buckets, bucket)
+	}
+	sort.Ints(buckets)
+
+	report := fmt.Sprintf("%s times by object version age:\n", r.operation)
+	report += fmt.Sprintf("%-12s %8s %9s %9s %9s\n", "age", "count", "50th s", "90th s", "99th s")
+	for _, bucket := range buckets {
+		durations := r.versionAges[bucket]
+		report += fmt.Sprintf("%-12s %8d %9.3f %9.3f %9.3f\n", versionAgeBuckets[bucket].label, durations.Count(),
+			durations.Percentile(50), durations.Percentile(90), durations.Percentile(99))
+	}
+	return report
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	opVersionWrite = "VersionWrite"
+	opVersionRead  = "VersionRead"
+	opListVersions = "ListVersions"
+	opDeleteMarker = "DeleteMarker"
+)
+
+// The objects of the versioned workload, which writes several versions of
+// every object written by the write test, then reads given versions, lists
+// them with ListObjectVersions and deletes the objects, creating delete
+// markers. Cleanup deletes every version and marker of the objects.
+type Versioned struct {
+	// Versions written per key
+	n int
+	// The keys written by the run, in the order first written, with the IDs
+	// of their versions
+	keys []string
+	ids  map[string][]string
+	// The requests of the current stage
+	requests []Req
+}
+
+func NewVersioned(n int) *Versioned {
+	return &Versioned{n: n, ids: make(map[string][]string)}
+}
+
+// Whether the operation is a stage of the versioned workload submitted by
+// submitVersions
+func isVersionedOp(op string) bool {
+	return op == opVersionWrite || op == opVersionRead || op == opDeleteMarker
+}
+
+// Remembers a version written
+func (v *Versioned) add(key string, versionID *string) {
+	ids, ok := v.ids[key]
+	if !ok {
+		v.keys = append(v.keys, key)
+	}
+	if versionID != nil {
+		ids = append(ids, *versionID)
+	}
+	v.ids[key] = ids
+}
+
+// Enables versioning on the bucket, which can only be suspended afterwards
+func (params *Params) enableVersioning(svc *s3.Client) error {
+	_, err := svc.PutBucketVersioning(context.Background(), &s3.PutBucketVersioningInput{
+		Bucket:                  aws.String(params.bucketName),
+		VersioningConfiguration: &types.VersioningConfiguration{Status: types.BucketVersioningStatusEnabled},
+	})
+	return err
+}
+
+// Prepares the requests of a stage of the versioned workload
+func (params *Params) prepareVersions(op string) {
+	v := params.versioned
+	bucket := aws.String(params.bucketName)
+	v.requests = v.requests[:0]
+	switch op {
+	case opVersionWrite:
+		for version := 1; version < v.n; version++ {
+			for _, key := range v.keys {
+				size := params.expectedSize(key, "")
+				input := &s3.PutObjectInput{
+					Bucket:        bucket,
+					Key:           aws.String(key),
+					Body:          params.objectData(key, 0, size),
+					ContentLength: aws.Int64(size),
+				}
+				if params.sse != nil {
+					params.sse.applyPut(input)
+				}
+				if params.metadata != nil {
+					params.metadata.apply(input)
+				}
+				v.requests = append(v.requests, input)
+			}
+		}
+	case opVersionRead:
+		// Cycles over the keys, reading an older version of each on every
+		// pass
+		for i := 0; i < params.numSamples && len(v.keys) > 0; i++ {
+			key := v.keys[i%len(v.keys)]
+			ids := v.ids[key]
+			if len(ids) == 0 {
+				continue
+			}
+			input := &s3.GetObjectInput{
+				Bucket:    bucket,
+				Key:       aws.String(key),
+				VersionId: aws.String(ids[len(ids)-1-(i/len(v.keys))%len(ids)]),
+			}
+			if params.sse != nil {
+				params.sse.applyGet(input)
+			}
+			v.requests = append(v.requests, input)
+		}
+	case opDeleteMarker:
+		for _, key := range v.keys {
+			v.requests = append(v.requests, &s3.DeleteObjectInput{Bucket: bucket, Key: aws.String(key)})
+		}
+	}
+}
+
+// Submits the requests of the current stage until all are submitted or stop
+// is closed, returning the number submitted
+func (params *Params) submitVersions(startTime time.Time, stop <-chan struct{}) int {
+	for i, request := range params.versioned.requests {
+		if params.quiet != nil {
+			params.waitQuiet(startTime)
+		}
+		if params.rateLimit != nil {
+			params.rateLimit.Wait()
+		}
+		select {
+		case params.requests <- request:
+		case <-stop:
+			return i
+		}
+	}
+	return len(params.versioned.requests)
+}
+
+// Runs the stages of the versioned workload, returning their results
+func (params *Params) RunVersions() []Result {
+	var results []Result
+	for _, op := range []string{opVersionWrite, opVersionRead, opListVersions, opDeleteMarker} {
+		if op == opVersionWrite && params.versioned.n < 2 {
+			continue
+		}
+		delay := params.settle()
+		fmt.Printf("Running %s test...\n", op)
+		var result Result
+		if op == opListVersions {
+			result = params.RunListVersions()
+		} else {
+			params.prepareVersions(op)
+			result = params.Run(op)
+		}
+		result.stageDelay = delay
+		results = append(results, result)
+		params.streamStage(result)
+		fmt.Println()
+		if result.aborted != "" {
+			break
+		}
+	}
+	return results
+}
+
+// Lists the versions and delete markers of objectNamePrefix in full, one page
+// after the other
+func (params *Params) RunListVersions() Result {
+	result := Result{operation: opListVersions}
+	startTime := time.Now()
+	var request Req = &s3.ListObjectVersionsInput{
+		Bucket: aws.String(params.bucketName),
+		Prefix: aws.String(params.objectNamePrefix),
+	}
+	for request != nil {
+		params.requests <- request
+		resp := <-params.responses
+		request = nil
+		params.logRequest(resp)
+		params.clockOffset.Add(resp)
+		result.addToTimeline(resp, time.Since(startTime))
+		if resp.err != nil {
+			result.numErrors++
+			fmt.Printf("Failed to list the versions of %s (%v)\n", params.objectNamePrefix, resp.err)
+			break
+		}
+		result.opDurations.Record(resp.duration.Seconds())
+		page := resp.output.(*s3.ListObjectVersionsOutput)
+		result.numListed += len(page.Versions) + len(page.DeleteMarkers)
+		if aws.ToBool(page.IsTruncated) {
+			nextPage := *resp.request.(*s3.ListObjectVersionsInput)
+			nextPage.KeyMarker, nextPage.VersionIdMarker = page.NextKeyMarker, page.NextVersionIdMarker
+			request = &nextPage
+		} else {
+			result.numListings++
+		}
+	}
+	result.totalDuration = time.Since(startTime)
+	return result
+}
+
+// Returns every version and delete marker of the keys written by the run
+func (params *Params) listVersionsOfKeys(svc *s3.Client) ([]types.ObjectIdentifier, error) {
+	var objects []types.ObjectIdentifier
+	paginator := s3.NewListObjectVersionsPaginator(svc, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(params.bucketName),
+		Prefix: aws.String(params.objectNamePrefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return objects, err
+		}
+		for _, version := range page.Versions {
+			if _, ok := params.versioned.ids[aws.ToString(version.Key)]; ok {
+				objects = append(objects, types.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId})
+			}
+		}
+		for _, marker := range page.DeleteMarkers {
+			if _, ok := params.versioned.ids[aws.ToString(marker.Key)]; ok {
+				objects = append(objects, types.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId})
+			}
+		}
+	}
+	return objects, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The JSON body posted to the webhook when a run completes or is aborted.
+// Slack and compatible incoming webhooks display the text and ignore the
+// other fields.
+type RunNotification struct {
+	Text     string          `json:"text"`
+	Status   string          `json:"status"`
+	RunID    string          `json:"runId,omitempty"`
+	Bucket   string          `json:"bucket"`
+	Failures []string        `json:"failures,omitempty"`
+	Results  []ResultSummary `json:"results"`
+}
+
+// Summarizes a run for the webhook. The run failed when a test was aborted,
+// by abortOnErrorRate for instance, or missed the latency target when one was
+// given.
+func runNotification(report *Report, target *LatencyTarget) RunNotification {
+	params := report.params
+	n := RunNotification{Status: "passed", RunID: params.runID, Bucket: params.bucketName}
+	for _, r := range report.results {
+		n.Results = append(n.Results, r.Summary())
+		if r.aborted != "" {
+			n.Failures = append(n.Failures, fmt.Sprintf("%s test aborted: %s", r.operation, r.aborted))
+		} else if target != nil && r.opDurations.Count() > 0 && r.percentile(target.percentile) >= target.max.Seconds() {
+			n.Failures = append(n.Failures, fmt.Sprintf("%s p%g %0.3f s missed %s",
+				r.operation, target.percentile, r.percentile(target.percentile), target))
+		}
+	}
+	if report.totals != nil && report.totals.Availability != nil {
+		if a := report.totals.Availability; a.Met != nil && !*a.Met {
+			n.Failures = append(n.Failures, fmt.Sprintf("availability %0.3f%% missed %g%%", a.Percent, a.TargetPercent))
+		}
+	}
+	if len(n.Failures) > 0 {
+		n.Status = "failed"
+	}
+
+	run := "s3bench run"
+	if params.runID != "" {
+		run += " " + params.runID
+	}
+	n.Text = fmt.Sprintf("%s against s3://%s %s", run, params.bucketName, n.Status)
+	for _, r := range report.results {
+		total := r.opDurations.Count() + r.numErrors
+		errorRate := 0.0
+		if total > 0 {
+			errorRate = float64(r.numErrors) / float64(total)
+		}
+		n.Text += fmt.Sprintf("\n%s: %0.2f MB/s, p99 %0.3f s, %0.2f%% errors (%d ops in %0.1f s)",
+			r.operation, (float64(r.bytesTransmitted)/(1024*1024))/r.totalDuration.Seconds(),
+			r.percentile(99), 100*errorRate, total, r.totalDuration.Seconds())
+	}
+	for _, failure := range n.Failures {
+		n.Text += "\n" + failure
+	}
+	return n
+}
+
+// Posts a JSON body to a webhook
+func postWebhook(url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Keeps the operations completed within the last window so that live stats
+// reflect how the run is doing now rather than since it started
+type LatencyWindow struct {
+	window  time.Duration
+	start   time.Time
+	samples []windowSample
+}
+
+type windowSample struct {
+	completed time.Time
+	duration  float64
+	numBytes  int64
+	failed    bool
+}
+
+func NewLatencyWindow(window time.Duration) *LatencyWindow {
+	return &LatencyWindow{window: window, start: time.Now()}
+}
+
+func (w *LatencyWindow) Add(completed time.Time, resp Resp) {
+	w.samples = append(w.samples, windowSample{
+		completed: completed,
+		duration:  resp.duration.Seconds(),
+		numBytes:  resp.numBytes,
+		failed:    resp.err != nil,
+	})
+}
+
+// Drop the samples that completed before the window ending now
+func (w *LatencyWindow) expire(now time.Time) {
+	cutoff := now.Add(-w.window)
+	n := sort.Search(len(w.samples), func(i int) bool { return w.samples[i].completed.After(cutoff) })
+	w.samples = append(w.samples[:0], w.samples[n:]...)
+}
+
+// Returns the sorted times of the successful operations within the window
+func (w *LatencyWindow) durations(now time.Time) []float64 {
+	w.expire(now)
+	var sorted []float64
+	for _, sample := range w.samples {
+		if !sample.failed {
+			sorted = append(sorted, sample.duration)
+		}
+	}
+	sort.Float64s(sorted)
+	return sorted
+}
+
+// Returns the throughput in MB/s and the fraction of operations which failed
+// within the window
+func (w *LatencyWindow) rates(now time.Time) (float64, float64) {
+	w.expire(now)
+	span := now.Sub(w.start)
+	if span > w.window {
+		span = w.window
+	}
+	var numBytes int64
+	numFailed := 0
+	for _, sample := range w.samples {
+		numBytes += sample.numBytes
+		if sample.failed {
+			numFailed++
+		}
+	}
+	if len(w.samples) == 0 || span <= 0 {
+		return 0, 0
+	}
+	return (float64(numBytes) / (1024 * 1024)) / span.Seconds(), float64(numFailed) / float64(len(w.samples))
+}
+
+// Percentiles of the operation times within the window, for the progress line
+func (w *LatencyWindow) String() string {
+	sorted := w.durations(time.Now())
+	if len(sorted) == 0 {
+		return fmt.Sprintf("no completions in last %s", w.window)
+	}
+	return fmt.Sprintf("last %s p50 %0.3fs p99 %0.3fs", w.window, percentile(sorted, 50), percentile(sorted, 99))
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A workload file sets flags shared by every run and a matrix of flag values,
+// every combination of which is run back to back, e.g.
+//
+//	{
+//	  "flags": {"bucket": "loadgen", "numSamples": 1000},
+//	  "matrix": {
+//	    "objectSize": ["4KiB", "1MiB"],
+//	    "numClients": [8, 32],
+//	    "endpoint": ["http://a:80", "http://a:80,http://b:80"]
+//	  }
+//	}
+type Workload struct {
+	Flags  map[string]interface{}   `json:"flags"`
+	Matrix map[string][]interface{} `json:"matrix"`
+}
+
+// Matrix axes are expanded in this order, any others follow alphabetically
+var matrixAxisOrder = []string{"objectSize", "numClients", "endpoint"}
+
+// One expanded combination of the matrix
+type WorkloadRun struct {
+	values   []string
+	args     []string
+	err      error
+	summary  []ResultSummary
+	exitCode int
+}
+
+func LoadWorkload(path string) (*Workload, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// Numbers are kept as written, 1000000 rather than 1e+06, as they are
+	// passed on as flag values
+	var w Workload
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&w); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for name, values := range w.Matrix {
+		if flag.Lookup(name) == nil {
+			return nil, fmt.Errorf("%s: unknown flag %q in matrix", path, name)
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("%s: matrix flag %q has no values", path, name)
+		}
+	}
+	for name := range w.Flags {
+		if flag.Lookup(name) == nil {
+			return nil, fmt.Errorf("%s: unknown flag %q", path, name)
+		}
+	}
+	return &w, nil
+}
+
+func (w *Workload) axes() []string {
+	var axes, others []string
+	for _, name := range matrixAxisOrder {
+		if _, ok := w.Matrix[name]; ok {
+			axes = append(axes, name)
+		}
+	}
+	for name := range w.Matrix {
+		if !stringInSlice(name, matrixAxisOrder) {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	return append(axes, others...)
+}
+
+func stringInSlice(s string, list []string) bool {
+	for _, item := range list {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the flags set on the command line, except the named one, as
+// arguments for another s3bench process
+func commandLineArgs(except string) []string {
+	var args []string
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == except {
+			return
+		}
+		if specs, ok := f.Value.(*outputSpecs); ok {
+			for _, spec := range *specs {
+				args = append(args, flagArg(f.Name, spec))
+			}
+			return
+		}
+		args = append(args, flagArg(f.Name, f.Value.String()))
+	})
+	return args
+}
+
+func flagArg(name string, value interface{}) string {
+	return fmt.Sprintf("-%s=%v", name, value)
+}
+
+// Expands the matrix into runs, the last axis varying fastest. Flags given
+// on the command line are passed to every run after those of the file so
+// that they take precedence, while matrix values come last.
+func (w *Workload) expand(extraArgs []string) []*WorkloadRun {
+	var baseArgs []string
+	names := make([]string, 0, len(w.Flags))
+	for name := range w.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		baseArgs = append(baseArgs, flagArg(name, w.Flags[name]))
+	}
+	baseArgs = append(baseArgs, extraArgs...)
+
+	runs := []*WorkloadRun{{args: baseArgs}}
+	for _, axis := range w.axes() {
+		var expanded []*WorkloadRun
+		for _, run := range runs {
+			for _, value := range w.Matrix[axis] {
+				expanded = append(expanded, &WorkloadRun{
+					values: append(append([]string(nil), run.values...), fmt.Sprint(value)),
+					args:   append(append([]string(nil), run.args...), flagArg(axis, value)),
+				})
+			}
+		}
+		runs = expanded
+	}
+	return runs
+}
+
+// Runs every combination of the workload matrix as a separate s3bench
+// process, then prints their results side by side. Returns whether all runs
+// succeeded.
+func RunWorkload(path string, extraArgs []string) bool {
+	w, err := LoadWorkload(path)
+	if err != nil {
+		fmt.Printf("Invalid workload: %v\n", err)
+		return false
+	}
+	tmpDir, err := ioutil.TempDir("", "s3bench-workload")
+	if err != nil {
+		fmt.Printf("Could not create a temporary directory: %v\n", err)
+		return false
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Runs report to the console unless outputs were chosen explicitly,
+	// the summary they also write is used for the comparison
+	hasOutput := w.Flags["output"] != nil
+	for _, arg := range extraArgs {
+		hasOutput = hasOutput || strings.HasPrefix(arg, "-output=")
+	}
+
+	runs := w.expand(extraArgs)
+	succeeded := true
+	for i, run := range runs {
+		summaryPath := filepath.Join(tmpDir, fmt.Sprintf("run-%d.json", i))
+		args := append(run.args, "-output=json:"+summaryPath)
+		if !hasOutput {
+			args = append(args, "-output=console")
+		}
+		fmt.Printf("=== Run %d/%d: %s\n", i+1, len(runs), strings.Join(run.args[len(run.args)-len(run.values):], " "))
+
+		cmd := exec.Command(os.Args[0], args...)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		run.err = cmd.Run()
+		if exitErr, ok := run.err.(*exec.ExitError); ok {
+			run.exitCode = exitErr.ExitCode()
+		}
+		if run.err != nil {
+			succeeded = false
+		}
+		if data, err := ioutil.ReadFile(summaryPath); err == nil {
+			var report struct {
+				Results []ResultSummary `json:"results"`
+			}
+			if json.Unmarshal(data, &report) == nil {
+				run.summary = report.Results
+			}
+		}
+		fmt.Println()
+	}
+
+	fmt.Println(workloadReport(w.axes(), runs))
+	return succeeded
+}
+
+func workloadReport(axes []string, runs []*WorkloadRun) string {
+	widths := make([]int, len(axes))
+	for i, axis := range axes {
+		widths[i] = len(axis)
+		for _, run := range runs {
+			if len(run.values[i]) > widths[i] {
+				widths[i] = len(run.values[i])
+			}
+		}
+	}
+
+	report := fmt.Sprintln("Results Summary for Workload Matrix")
+	header := fmt.Sprintf("%4s", "run")
+	for i, axis := range axes {
+		header += fmt.Sprintf("  %-*s", widths[i], axis)
+	}
+	header += fmt.Sprintf("  %-6s %10s %10s %9s %9s %7s", "op", "MB/s", "ops/s", "50th s", "99th s", "errors")
+	report += fmt.Sprintln(header)
+
+	for n, run := range runs {
+		prefix := fmt.Sprintf("%4d", n+1)
+		for i := range axes {
+			prefix += fmt.Sprintf("  %-*s", widths[i], run.values[i])
+		}
+		if len(run.summary) == 0 {
+			report += fmt.Sprintf("%s  failed (%v)\n", prefix, run.err)
+			continue
+		}
+		for _, summary := range run.summary {
+			report += fmt.Sprintf("%s  %-6s %10.2f %10.1f %9.3f %9.3f %7d\n", prefix, summary.Operation,
+				summary.ThroughputMBps, float64(summary.Operations)/summary.DurationSeconds,
+				summary.Latency["p50"], summary.Latency["p99"], summary.Errors)
+		}
+		if run.err != nil {
+			report += fmt.Sprintf("%s  exited with status %d\n", prefix, run.exitCode)
+		}
+	}
+	return report
+}